@@ -0,0 +1,776 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/toulibre/libreregistration/internal/backup"
+	"github.com/toulibre/libreregistration/internal/config"
+	"github.com/toulibre/libreregistration/internal/database"
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/logging"
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/internal/spreadsheet"
+	"github.com/toulibre/libreregistration/internal/worker"
+)
+
+const usage = `Usage: server [command] [arguments]
+
+Commands:
+  serve                                 run the web server (default)
+  migrate up [-dry-run]                 apply the pending migrations
+  migrate down [-to VERSION] [-dry-run] [-yes]
+                                        revert the migrations above VERSION, the latest one by default
+  migrate status                        list the migrations and check those applied
+  user create [-name NAME] [-role ROLE] USERNAME
+                                        create a user, reading the password from stdin
+  user list                             list the users
+  user reset-password USERNAME          set the password of a user, read from stdin
+  user set-role USERNAME ROLE           make a user an admin or a manager
+  event list [-upcoming]                list the events
+  event export [-format FORMAT] [-lang LANG] [-o FILE] SLUG
+                                        export the attendees of an event as csv, xlsx or ods
+  backup [-o FILE]                      archive the database and the uploads
+  restore [-yes] FILE                   replace the database and the uploads with an archive
+  purge [-days DAYS] [-dry-run] [-yes]  delete the events ended DAYS days ago
+  export [-o FILE]                      dump the data as JSON lines, gzipped for a .gz file
+  import FILE                           load a dump into an empty database, of either driver
+  config check                          print the configuration, secrets hidden, and check it
+
+The commands read the same environment variables as the server, and the
+configuration file named by CONFIG_FILE.
+`
+
+// errUsage reports a command line that could not be understood, once the
+// usage has been printed.
+var errUsage = errors.New("invalid usage")
+
+// run runs the command of the arguments.
+func run(args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := logging.Setup(os.Stderr, logging.Options{Format: cfg.LogFormat, Level: cfg.LogLevel, Redact: cfg.LogRedact}); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return serve(cfg)
+	}
+	switch args[0] {
+	case "serve":
+		return serve(cfg)
+	case "migrate":
+		return migrateCommand(cfg, args[1:])
+	case "user":
+		return userCommand(cfg, args[1:])
+	case "event":
+		return eventCommand(cfg, args[1:])
+	case "backup":
+		return backupCommand(cfg, args[1:])
+	case "restore":
+		return restoreCommand(cfg, args[1:])
+	case "purge":
+		return purgeCommand(cfg, args[1:])
+	case "export":
+		return exportCommand(cfg, args[1:])
+	case "import":
+		return importCommand(cfg, args[1:])
+	case "config":
+		return configCommand(cfg, args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	}
+	return usageError("unknown command %q", args[0])
+}
+
+// usageError prints the error and the usage.
+func usageError(format string, args ...any) error {
+	fmt.Fprintf(os.Stderr, format+"\n\n", args...)
+	fmt.Fprint(os.Stderr, usage)
+	return errUsage
+}
+
+// parseFlags parses the flags of a command, and checks the number of
+// arguments left.
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%s: %v", fs.Name(), err)
+	}
+	if fs.NArg() != nargs {
+		return usageError("%s: %d argument(s) expected, got %d", fs.Name(), nargs, fs.NArg())
+	}
+	return nil
+}
+
+// databaseSource returns the driver and the data source name of the
+// configured database.
+func databaseSource(cfg *config.Config) (driver, dsn string) {
+	if cfg.DatabaseDriver == "postgres" {
+		return "pgx", cfg.DatabaseURL
+	}
+	return cfg.DatabaseDriver, cfg.DatabasePath
+}
+
+// openDB opens the configured database.
+func openDB(cfg *config.Config) (*database.DB, error) {
+	driver, dsn := databaseSource(cfg)
+	db, err := database.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+// app holds the services used by the commands.
+type app struct {
+	db            *database.DB
+	auth          *services.AuthService
+	events        *services.EventService
+	registrations *services.RegistrationService
+}
+
+// openApp opens and migrates the database, and sets up the services.
+func openApp(cfg *config.Config) (*app, error) {
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.Migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	eventStore := database.NewEventStore(db)
+	sessionStore := database.NewSessionStore(db)
+	return &app{
+		db:            db,
+		auth:          services.NewAuthService(database.NewUserStore(db)),
+		events:        services.NewEventService(eventStore, database.NewTagStore(db), sessionStore, database.NewVenueStore(db)),
+		registrations: services.NewRegistrationService(database.NewRegistrationStore(db), eventStore, sessionStore, cfg, worker.NewSupervisor()),
+	}, nil
+}
+
+func migrateCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return usageError("migrate: up, down or status expected")
+	}
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "list the migrations without running them")
+	to := fs.Int("to", -1, "version to revert to, the previous one by default")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	switch args[0] {
+	case "up", "down":
+	case "status":
+		fs = flag.NewFlagSet("migrate status", flag.ContinueOnError)
+	default:
+		return usageError("migrate: unknown command %q", args[0])
+	}
+	if err := parseFlags(fs, args[1:], 0); err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if args[0] == "up" && !*dryRun {
+		if err := database.Migrate(db); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+		version, err := database.SchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema up to date, at version %d\n", version)
+		return nil
+	}
+
+	migrations, err := database.MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		pending := 0
+		for _, m := range migrations {
+			if !m.Applied() {
+				fmt.Println(m.Name)
+				pending++
+			}
+		}
+		fmt.Printf("%d migration(s) to apply\n", pending)
+		return migrationProblems(migrations)
+	case "down":
+		return migrateDown(db, migrations, *to, *dryRun, *yes)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MIGRATION\tAPPLIED\tREVERSIBLE")
+	pending := 0
+	for _, m := range migrations {
+		applied := "pending"
+		if m.Applied() {
+			applied = m.AppliedAt.Local().Format(time.DateTime)
+		} else {
+			pending++
+		}
+		switch {
+		case m.Modified:
+			applied += " (modified since)"
+		case m.Unknown:
+			applied += " (not in this build)"
+		case m.Unrecorded:
+			applied += " (checksum unrecorded)"
+		}
+		reversible := "yes"
+		if m.Down == "" {
+			reversible = "no"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", m.Name, applied, reversible)
+	}
+	tw.Flush()
+	fmt.Printf("\n%d migration(s) pending\n", pending)
+	return migrationProblems(migrations)
+}
+
+// migrationProblems returns an error when applied migrations differ from
+// those of this build, which keeps the server from starting.
+func migrationProblems(migrations []database.Migration) error {
+	problems := 0
+	for _, m := range migrations {
+		if m.Modified || m.Unknown {
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d applied migration(s) differ from this build", problems)
+	}
+	return nil
+}
+
+func migrateDown(db *database.DB, migrations []database.Migration, to int, dryRun, yes bool) error {
+	if to < 0 {
+		// Revert the latest migration applied
+		to = 0
+		applied := database.MigrationsAbove(migrations, 0)
+		if len(applied) > 1 {
+			to = applied[1].Version
+		}
+	}
+	revert := database.MigrationsAbove(migrations, to)
+	for _, m := range revert {
+		down := m.Down
+		if down == "" {
+			down = "irreversible"
+		}
+		fmt.Printf("%s\t%s\n", m.Name, down)
+	}
+	if len(revert) == 0 || dryRun {
+		fmt.Printf("%d migration(s) to revert\n", len(revert))
+		return migrationProblems(migrations)
+	}
+	if !yes && !confirm(fmt.Sprintf("Revert these %d migration(s)? The data they hold is lost.", len(revert))) {
+		return errors.New("migration canceled")
+	}
+
+	reverted, err := database.MigrateDown(db, to)
+	if err != nil {
+		return fmt.Errorf("failed to revert migrations: %w", err)
+	}
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d migration(s) reverted, schema at version %d\n", len(reverted), version)
+	return nil
+}
+
+func userCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return usageError("user: create, list, reset-password or set-role expected")
+	}
+	var fs *flag.FlagSet
+	var nargs int
+	name := ""
+	role := string(models.RoleManager)
+	switch args[0] {
+	case "create":
+		fs = flag.NewFlagSet("user create", flag.ContinueOnError)
+		fs.StringVar(&name, "name", "", "display name")
+		fs.StringVar(&role, "role", role, "admin or manager")
+		nargs = 1
+	case "list":
+		fs = flag.NewFlagSet("user list", flag.ContinueOnError)
+	case "reset-password":
+		fs = flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+		nargs = 1
+	case "set-role":
+		fs = flag.NewFlagSet("user set-role", flag.ContinueOnError)
+		nargs = 2
+	default:
+		return usageError("user: unknown command %q", args[0])
+	}
+	if err := parseFlags(fs, args[1:], nargs); err != nil {
+		return err
+	}
+	if args[0] == "set-role" {
+		role = fs.Arg(1)
+	}
+	if role != string(models.RoleAdmin) && role != string(models.RoleManager) {
+		return usageError("%s: invalid role %q, admin or manager expected", fs.Name(), role)
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+
+	username := fs.Arg(0)
+	switch args[0] {
+	case "create":
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err := a.auth.CreateUser(username, name, password, models.Role(role)); err != nil {
+			return err
+		}
+		fmt.Printf("User %s created\n", username)
+	case "list":
+		users, err := a.auth.ListUsers()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "USERNAME\tNAME\tROLE\tCREATED")
+		for _, u := range users {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", u.Username, u.Name, u.Role, u.CreatedAt.Local().Format(time.DateTime))
+		}
+		tw.Flush()
+	case "reset-password":
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err := a.auth.ResetPassword(username, password); err != nil {
+			return err
+		}
+		fmt.Printf("Password of %s reset\n", username)
+	case "set-role":
+		if err := a.auth.SetRole(username, models.Role(role)); err != nil {
+			return err
+		}
+		fmt.Printf("%s is now %s\n", username, role)
+	}
+	return nil
+}
+
+// readPassword reads a password, without echoing it on a terminal, or from
+// the first line of stdin when piped.
+func readPassword() (string, error) {
+	var password string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		password = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+	return password, nil
+}
+
+// confirm asks a yes or no question on stdin, no being the answer by
+// default.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func eventCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return usageError("event: list or export expected")
+	}
+	switch args[0] {
+	case "list":
+		return eventListCommand(cfg, args[1:])
+	case "export":
+		return eventExportCommand(cfg, args[1:])
+	}
+	return usageError("event: unknown command %q", args[0])
+}
+
+func eventListCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("event list", flag.ContinueOnError)
+	upcoming := fs.Bool("upcoming", false, "list the published events to come only")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+
+	var events []models.Event
+	if *upcoming {
+		events, err = a.events.ListUpcoming()
+	} else {
+		events, err = a.events.ListAll()
+	}
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SLUG\tDATE\tSTATUS\tSEATS\tTITLE")
+	for _, e := range events {
+		seats := fmt.Sprint(e.RegistrationCount)
+		if e.MaxCapacity != nil {
+			seats += fmt.Sprintf("/%d", *e.MaxCapacity)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Slug, e.EventDate.Local().Format("2006-01-02 15:04"), e.Status, seats, e.Title)
+	}
+	return tw.Flush()
+}
+
+// spreadsheetWriters are the workbook formats of event export.
+var spreadsheetWriters = map[string]func(io.Writer, *spreadsheet.Workbook) error{
+	"xlsx": spreadsheet.WriteXLSX,
+	"ods":  spreadsheet.WriteODS,
+}
+
+func eventExportCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("event export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "csv, xlsx or ods")
+	lang := fs.String("lang", "fr", "language of the headers, fr or en")
+	output := fs.String("o", "-", "output file, - for stdout")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	write, ok := spreadsheetWriters[*format]
+	if !ok && *format != "csv" {
+		return usageError("event export: invalid format %q, csv, xlsx or ods expected", *format)
+	}
+	if *lang != "fr" && *lang != "en" {
+		return usageError("event export: invalid language %q, fr or en expected", *lang)
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+
+	event, err := a.events.GetBySlug(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		return fmt.Errorf("event %s: %w", fs.Arg(0), services.ErrEventNotFound)
+	}
+	regs, err := a.registrations.ListByEvent(event.ID)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	ctx := i18n.WithLocale(context.Background(), *lang)
+	if *format == "csv" {
+		return services.WriteAttendeesCSV(ctx, w, regs)
+	}
+	wb := services.AttendeeWorkbook(ctx, []models.Event{*event}, map[string][]models.Registration{event.ID: regs}, false)
+	return write(w, wb)
+}
+
+// backupOptions locates the data of the instance and its backups.
+func backupOptions(cfg *config.Config) backup.Options {
+	return backup.Options{
+		DatabasePath: cfg.DatabasePath,
+		DatabaseURL:  cfg.DatabaseURL,
+		UploadDir:    cfg.UploadDir,
+		Dir:          cfg.BackupDir,
+		Keep:         cfg.BackupKeep,
+	}
+}
+
+func backupCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := fs.String("o", "", "archive file, in BACKUP_DIR with the retention applied by default")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	s := backup.NewService(db, backupOptions(cfg))
+	path := *output
+	if path == "" {
+		path, err = s.Create(ctx)
+	} else {
+		_, err = s.WriteFile(ctx, path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup written to %s\n", path)
+	return nil
+}
+
+func restoreCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	archive := fs.Arg(0)
+	m, err := backup.ReadManifest(archive)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup of %s: %s database at schema version %d, %d uploaded file(s)\n",
+		m.CreatedAt.Local().Format(time.DateTime), m.Driver, m.SchemaVersion, m.Uploads)
+	if !*yes && !confirm("Replace the database and the uploads with this backup? The server must be stopped.") {
+		return errors.New("restore canceled")
+	}
+
+	driver, _ := databaseSource(cfg)
+	if _, err := backup.Restore(context.Background(), archive, driver, backupOptions(cfg)); err != nil {
+		return err
+	}
+	fmt.Printf("Backup %s restored\n", archive)
+	return nil
+}
+
+func purgeCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	days := fs.Int("days", 365, "age in days of the events to delete")
+	dryRun := fs.Bool("dry-run", false, "list the events without deleting them")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *days < 1 {
+		return usageError("purge: -days must be at least 1")
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+
+	events, err := a.events.ListEndedBefore(time.Now().AddDate(0, 0, -*days))
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		fmt.Printf("%s\t%s\t%s\n", e.EventDate.Local().Format("2006-01-02"), e.Slug, e.Title)
+	}
+	if len(events) == 0 || *dryRun {
+		fmt.Printf("%d event(s) to purge\n", len(events))
+		return nil
+	}
+	if !*yes && !confirm(fmt.Sprintf("Delete these %d event(s) and their registrations?", len(events))) {
+		return errors.New("purge canceled")
+	}
+
+	for _, e := range events {
+		if err := a.events.Delete(e.ID); err != nil {
+			return fmt.Errorf("purge %s: %w", e.Slug, err)
+		}
+		for _, filename := range []string{e.ImagePath, e.BannerPath} {
+			releaseUpload(a.events, cfg.UploadDir, filename)
+		}
+	}
+	fmt.Printf("%d event(s) purged\n", len(events))
+	return nil
+}
+
+// releaseUpload deletes an uploaded file no event uses anymore.
+func releaseUpload(events *services.EventService, uploadDir, filename string) {
+	if filename == "" {
+		return
+	}
+	if inUse, err := events.UploadInUse(filename); err != nil || inUse {
+		return
+	}
+	os.Remove(filepath.Join(uploadDir, filepath.Base(filename)))
+}
+
+func exportCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "-", "dump file, - for stdout")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *output != "-" {
+		if f, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	var gz *gzip.Writer
+	if strings.HasSuffix(*output, ".gz") {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	h, err := database.Dump(context.Background(), db, w)
+	if err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Exported %s at schema version %d\n", dumpCounts(h), h.SchemaVersion)
+	return nil
+}
+
+func importCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+		if strings.HasSuffix(name, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return err
+			}
+			r = gz
+		}
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	h, err := database.Load(context.Background(), db, r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %s from a %s database\n", dumpCounts(h), h.Driver)
+	return nil
+}
+
+// dumpCounts describes the number of rows of the main tables of a dump.
+func dumpCounts(h *database.DumpHeader) string {
+	rows := make(map[string]int)
+	for _, t := range h.Tables {
+		rows[t.Name] = t.Rows
+	}
+	return fmt.Sprintf("%d user(s), %d event(s), %d registration(s) and %d setting(s)",
+		rows["users"], rows["events"], rows["registrations"], rows["settings"])
+}
+
+func configCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return usageError("config: check expected")
+	}
+	if err := parseFlags(flag.NewFlagSet("config check", flag.ContinueOnError), args[1:], 0); err != nil {
+		return err
+	}
+
+	if cfg.File != "" {
+		fmt.Printf("Configuration file: %s\n\n", cfg.File)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIABLE\tVALUE\tSOURCE")
+	for _, s := range cfg.Settings() {
+		value := s.Value
+		if s.Secret && value != "" {
+			value = logging.Redacted
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, value, s.Source)
+	}
+	tw.Flush()
+
+	warnings, err := cfg.Validate()
+	fmt.Println()
+	for _, w := range warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Printf("error: %s\n", line)
+		}
+		return errors.New("invalid configuration")
+	}
+	fmt.Println("Configuration valid")
+	return nil
+}
@@ -1,41 +1,52 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/sessions"
 
+	"github.com/toulibre/libreregistration/internal/backup"
 	"github.com/toulibre/libreregistration/internal/config"
 	"github.com/toulibre/libreregistration/internal/database"
 	"github.com/toulibre/libreregistration/internal/handlers"
 	"github.com/toulibre/libreregistration/internal/middleware"
 	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/internal/worker"
 )
 
 func main() {
-	if err := run(); err != nil {
-		log.Fatal(err)
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		slog.Error("command failed", "error", err)
+		os.Exit(1)
 	}
 }
 
-func run() error {
-	cfg := config.Load()
-
-	// Open database
-	driver := cfg.DatabaseDriver
-	dsn := cfg.DatabasePath
-	if driver == "postgres" {
-		driver = "pgx"
-		dsn = cfg.DatabaseURL
+// serve runs the web server until SIGINT or SIGTERM.
+func serve(cfg *config.Config) error {
+	warnings, err := cfg.Validate()
+	for _, w := range warnings {
+		slog.Warn("configuration to check", "problem", w)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid configuration, see the config check command: %w", err)
 	}
 
-	db, err := database.Open(driver, dsn)
+	db, err := openDB(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
 	}
 	defer db.Close()
 
@@ -49,20 +60,44 @@ func run() error {
 	eventStore := database.NewEventStore(db)
 	registrationStore := database.NewRegistrationStore(db)
 	settingStore := database.NewSettingStore(db)
+	tagStore := database.NewTagStore(db)
+	seriesStore := database.NewSeriesStore(db)
+	eventSessionStore := database.NewSessionStore(db)
+	venueStore := database.NewVenueStore(db)
+
+	// Background jobs, stopped and waited for on shutdown
+	workers := worker.NewSupervisor()
 
 	// Initialize services
 	authService := services.NewAuthService(userStore)
-	eventService := services.NewEventService(eventStore)
-	registrationService := services.NewRegistrationService(registrationStore, eventStore, cfg)
+	eventService := services.NewEventService(eventStore, tagStore, eventSessionStore, venueStore)
+	tagService := services.NewTagService(tagStore)
+	registrationService := services.NewRegistrationService(registrationStore, eventStore, eventSessionStore, cfg, workers)
 	settingsService := services.NewSettingsService(settingStore)
+	seriesService := services.NewSeriesService(seriesStore, eventService)
+	venueService := services.NewVenueService(venueStore)
+	eventSessionService := services.NewSessionService(eventSessionStore)
+	analyticsService := services.NewAnalyticsService(eventStore, registrationStore)
 
 	// Seed admin user if configured
 	if cfg.AdminUsername != "" && cfg.AdminPassword != "" {
 		if err := authService.SeedAdmin(cfg.AdminUsername, cfg.AdminPassword); err != nil {
-			log.Printf("Warning: could not seed admin user: %v", err)
+			slog.Warn("could not seed admin user", "error", err)
 		}
 	}
 
+	// Publish events and open registrations when scheduled
+	workers.Go("scheduler", func(ctx context.Context) { eventService.RunScheduler(ctx, time.Minute) })
+
+	// Generate the occurrences of the series ahead
+	workers.Go("series generator", func(ctx context.Context) { seriesService.RunGenerator(ctx, time.Hour) })
+
+	// Back up the database and the uploads
+	if cfg.BackupInterval > 0 {
+		backups := backup.NewService(db, backupOptions(cfg))
+		workers.Go("backups", func(ctx context.Context) { backups.Run(ctx, cfg.BackupInterval) })
+	}
+
 	// Session store
 	sessionStore := sessions.NewCookieStore([]byte(cfg.SessionSecret))
 	sessionStore.Options = &sessions.Options{
@@ -78,20 +113,54 @@ func run() error {
 
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler(db)
+	metricsHandler := handlers.NewMetricsHandler(db, cfg.MetricsToken)
 	authHandler := handlers.NewAuthHandler(authService, settingsService)
-	eventHandler := handlers.NewEventHandler(eventService, registrationService, settingsService, cfg.UploadDir)
+	eventHandler := handlers.NewEventHandler(eventService, registrationService, tagService, seriesService, venueService, authService, settingsService, cfg.UploadDir)
+	tagHandler := handlers.NewTagHandler(tagService, settingsService)
+	seriesHandler := handlers.NewSeriesHandler(seriesService, eventService, settingsService)
+	venueHandler := handlers.NewVenueHandler(venueService, eventService, settingsService)
+	sessionHandler := handlers.NewSessionHandler(eventSessionService, eventService, settingsService, cfg.BaseURL)
 	registrationHandler := handlers.NewRegistrationHandler(registrationService, eventService, settingsService)
-	adminHandler := handlers.NewAdminHandler(eventService, registrationService, authService, settingsService)
+	adminHandler := handlers.NewAdminHandler(eventService, registrationService, analyticsService, authService, settingsService, cfg.UploadDir)
+
+	// Health check (outside the app router, no session/CSRF needed)
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", healthHandler.Healthz)
+
+	// Metrics, on their own address or behind a token
+	// The servers send why they stopped, unless shut down
+	serveErr := make(chan error, 2)
+	var metricsServer *http.Server
+	switch {
+	case cfg.MetricsAddr != "":
+		ln, err := net.Listen("tcp", cfg.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for metrics: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /metrics", metricsHandler.Metrics)
+		metricsServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		slog.Info("metrics served", "addr", ln.Addr().String())
+		go func() {
+			if err := metricsServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("metrics server: %w", err)
+			}
+		}()
+	case cfg.MetricsToken != "":
+		root.HandleFunc("GET /metrics", metricsHandler.Metrics)
+	default:
+		slog.Info("metrics disabled, set METRICS_TOKEN or METRICS_ADDR to enable them")
+	}
 
 	// Router
 	r := chi.NewRouter()
-
-	// Health check (before other middleware, no session/CSRF needed)
-	r.Get("/healthz", healthHandler.Healthz)
+	root.Handle("/", r)
 
 	// Global middleware
+	r.Use(middleware.RequestID)
 	r.Use(middleware.SecurityHeaders)
 	r.Use(middleware.Logging)
+	r.Use(middleware.Metrics)
 	r.Use(middleware.MethodOverride)
 	r.Use(middleware.Session(sessionStore))
 	r.Use(middleware.Locale)
@@ -107,7 +176,13 @@ func run() error {
 	// Public routes
 	r.Get("/", eventHandler.Home)
 	r.Get("/event/{slug}", eventHandler.Show)
+	r.Get("/event/{slug}/schedule.xml", sessionHandler.Schedule)
+	r.Get("/tag/{slug}", eventHandler.Tag)
+	r.Get("/series/{slug}", seriesHandler.Show)
+	r.Get("/venue/{slug}", venueHandler.Show)
+	r.Get("/search", eventHandler.Search)
 	r.Post("/event/{slug}/register", registrationHandler.Register)
+	r.Post("/event/{slug}/resend", registrationHandler.ResendConfirmation)
 	r.Get("/cancel/{token}", registrationHandler.Cancel)
 
 	// Admin routes
@@ -132,10 +207,52 @@ func run() error {
 			r.Put("/events/{id}", eventHandler.Update)
 			r.Delete("/events/{id}", eventHandler.Delete)
 			r.Post("/events/{id}/clone", eventHandler.Clone)
+			r.Get("/export", adminHandler.ExportEvents)
+
+			// Tag management
+			r.Get("/tags", tagHandler.List)
+			r.Put("/tags/{id}", tagHandler.Rename)
+			r.Delete("/tags/{id}", tagHandler.Delete)
+
+			// Recurring series
+			r.Get("/series", seriesHandler.List)
+			r.Get("/series/{id}", seriesHandler.Detail)
+			r.Put("/series/{id}", seriesHandler.Update)
+			r.Delete("/series/{id}", seriesHandler.Delete)
+
+			// Venues
+			r.Get("/venues", venueHandler.List)
+			r.Get("/venues/new", venueHandler.NewForm)
+			r.Post("/venues", venueHandler.Create)
+			r.Get("/venues/{id}/edit", venueHandler.EditForm)
+			r.Put("/venues/{id}", venueHandler.Update)
+			r.Delete("/venues/{id}", venueHandler.Delete)
+
 			r.Get("/events/{id}/attendees", adminHandler.Attendees)
 			r.Get("/events/{id}/attendees/csv", adminHandler.AttendeesCSV)
+			r.Get("/events/{id}/attendees/{format:xlsx|ods}", adminHandler.AttendeesSpreadsheet)
+			r.Get("/events/{id}/attendees/sign-in-sheet", adminHandler.SignInSheet)
+			r.Get("/events/{id}/attendees/badges", adminHandler.Badges)
+			r.Post("/events/{id}/attendees/review", adminHandler.ReviewAttendees)
+			r.Get("/events/{id}/attendees/import", adminHandler.ImportAttendeesForm)
+			r.Post("/events/{id}/attendees/import", adminHandler.ImportAttendees)
+			r.Get("/events/{id}/attendees/new", adminHandler.NewAttendeeForm)
+			r.Post("/events/{id}/attendees", adminHandler.CreateAttendee)
+			r.Get("/events/{id}/attendees/{regID}/edit", adminHandler.EditAttendeeForm)
+			r.Put("/events/{id}/attendees/{regID}", adminHandler.UpdateAttendee)
+			r.Post("/events/{id}/attendees/{regID}/move", adminHandler.MoveAttendee)
 			r.Delete("/events/{id}/attendees/{regID}", adminHandler.DeleteAttendee)
 
+			// Agenda
+			r.Get("/events/{id}/sessions", sessionHandler.List)
+			r.Get("/events/{id}/sessions/new", sessionHandler.NewForm)
+			r.Post("/events/{id}/sessions", sessionHandler.Create)
+			r.Post("/events/{id}/sessions/import", sessionHandler.Import)
+			r.Get("/events/{id}/sessions/{sessionID}/edit", sessionHandler.EditForm)
+			r.Put("/events/{id}/sessions/{sessionID}", sessionHandler.Update)
+			r.Delete("/events/{id}/sessions/{sessionID}", sessionHandler.Delete)
+			r.Get("/events/{id}/schedule.xml", sessionHandler.Export)
+
 			// User management (admin only)
 			r.Group(func(r chi.Router) {
 				r.Use(middleware.RequireAdmin)
@@ -154,8 +271,50 @@ func run() error {
 		})
 	})
 
-	addr := ":" + cfg.Port
-	log.Printf("Server starting on %s", addr)
+	// Serve until SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	return http.ListenAndServe(addr, r)
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           root,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+	}
+	go func() {
+		slog.Info("server starting", "addr", server.Addr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+	var failure error
+	select {
+	case failure = <-serveErr:
+		// Nothing to drain, but the background jobs are still stopped, and
+		// the error returned once they are
+	case <-ctx.Done():
+		stop() // a second signal kills the process
+
+		// Keep serving while the health check reports draining, then wait
+		// for the requests in flight and the background jobs
+		slog.Info("shutting down", "drain_delay", cfg.DrainDelay, "timeout", cfg.ShutdownTimeout)
+		healthHandler.SetDraining()
+		time.Sleep(cfg.DrainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests still in flight at shutdown", "error", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
+	}
+	if err := workers.Stop(shutdownCtx); err != nil {
+		slog.Warn("background jobs still running at shutdown", "error", err)
+	}
+	slog.Info("server stopped")
+	return failure
 }
@@ -12,6 +12,7 @@ require (
 	github.com/jackc/pgx/v5 v5.8.0
 	github.com/yuin/goldmark v1.7.16
 	golang.org/x/crypto v0.49.0
+	golang.org/x/term v0.41.0
 	golang.org/x/text v0.35.0
 	modernc.org/sqlite v1.47.0
 )
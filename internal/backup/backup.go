@@ -0,0 +1,334 @@
+// Package backup writes and restores the backups of an instance: compressed
+// archives holding a consistent snapshot of the database and the uploaded
+// files.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/database"
+	"github.com/toulibre/libreregistration/internal/metrics"
+)
+
+// FormatVersion is the version of the archive layout, raised when it changes.
+const FormatVersion = 1
+
+// Names of the entries of an archive. The manifest comes first, then the
+// database, then the uploads.
+const (
+	manifestName = "manifest.json"
+	sqliteName   = "database.sqlite"
+	pgDumpName   = "database.sql"
+	uploadsDir   = "uploads/"
+)
+
+// Names of the archives written to the backup directory, which retention
+// applies to.
+const (
+	filePrefix = "libreregistration-"
+	fileSuffix = ".tar.gz"
+	fileTime   = "20060102-150405"
+)
+
+var (
+	ErrInvalidArchive = errors.New("invalid backup archive")
+	ErrWrongDriver    = errors.New("backup of another database driver")
+	ErrNewerSchema    = errors.New("backup of a newer schema")
+)
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	Format        int       `json:"format"`
+	Driver        string    `json:"driver"`
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Uploads       int       `json:"uploads"`
+}
+
+// Options locate the data of the instance and its backups.
+type Options struct {
+	DatabasePath string // SQLite database file
+	DatabaseURL  string // PostgreSQL connection URL
+	UploadDir    string
+	Dir          string // directory of the scheduled backups
+	Keep         int    // number of scheduled backups kept, all when 0
+}
+
+type Service struct {
+	db   *database.DB
+	opts Options
+}
+
+func NewService(db *database.DB, opts Options) *Service {
+	return &Service{db: db, opts: opts}
+}
+
+// Write writes an archive of the database and the uploads to w, while the
+// application may be in use.
+func (s *Service) Write(ctx context.Context, w io.Writer) (*Manifest, error) {
+	version, err := database.SchemaVersion(s.db)
+	if err != nil {
+		return nil, err
+	}
+	uploads, err := listUploads(s.opts.UploadDir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		Format:        FormatVersion,
+		Driver:        s.db.Driver,
+		SchemaVersion: version,
+		CreatedAt:     time.Now().UTC(),
+		Uploads:       len(uploads),
+	}
+
+	// Snapshot the database to a temporary file first, as tar entries are
+	// written with their size
+	tmp, err := os.MkdirTemp("", "libreregistration-backup-")
+	if err != nil {
+		return nil, fmt.Errorf("create backup: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	dbName := sqliteName
+	if s.db.Driver == "sqlite" {
+		err = database.BackupSQLite(s.db, filepath.Join(tmp, dbName))
+	} else {
+		dbName = pgDumpName
+		err = pgDump(ctx, s.opts.DatabaseURL, filepath.Join(tmp, dbName))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, m.CreatedAt, bytes.NewReader(manifest), int64(len(manifest))); err != nil {
+		return nil, err
+	}
+	if err := addFile(tw, dbName, filepath.Join(tmp, dbName)); err != nil {
+		return nil, err
+	}
+	for _, name := range uploads {
+		if err := addFile(tw, uploadsDir+name, filepath.Join(s.opts.UploadDir, filepath.FromSlash(name))); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("write backup: %w", err)
+	}
+	return m, nil
+}
+
+// WriteFile writes an archive to path, which must not exist. The file only
+// appears once complete.
+func (s *Service) WriteFile(ctx context.Context, path string) (*Manifest, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("create backup: %s already exists", path)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".backup-*")
+	if err != nil {
+		return nil, fmt.Errorf("create backup: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	m, err := s.Write(ctx, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return nil, fmt.Errorf("create backup: %w", err)
+	}
+	return m, nil
+}
+
+// Create writes an archive to the backup directory, named after the time,
+// and then applies the retention. It returns the path of the archive.
+func (s *Service) Create(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(s.opts.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("create backup directory: %w", err)
+	}
+	path := filepath.Join(s.opts.Dir, filePrefix+time.Now().Format(fileTime)+fileSuffix)
+	if _, err := s.WriteFile(ctx, path); err != nil {
+		metrics.Backups.Inc("failed")
+		return "", err
+	}
+	metrics.Backups.Inc("created")
+
+	removed, err := s.Prune()
+	if err != nil {
+		slog.Warn("could not apply the backup retention", "error", err)
+	}
+	for _, name := range removed {
+		slog.Info("backup removed", "file", name)
+	}
+	return path, nil
+}
+
+// Prune removes the oldest archives of the backup directory beyond the
+// number to keep, and returns their names.
+func (s *Service) Prune() ([]string, error) {
+	if s.opts.Keep <= 0 {
+		return nil, nil
+	}
+	names, err := s.archives()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) <= s.opts.Keep {
+		return nil, nil
+	}
+	old := names[:len(names)-s.opts.Keep]
+	for _, name := range old {
+		if err := os.Remove(filepath.Join(s.opts.Dir, name)); err != nil {
+			return nil, fmt.Errorf("remove backup: %w", err)
+		}
+	}
+	return old, nil
+}
+
+// archives returns the names of the archives of the backup directory,
+// oldest first.
+func (s *Service) archives() ([]string, error) {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if _, ok := archiveTime(e.Name()); ok && e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	// The names sort by time
+	sort.Strings(names)
+	return names, nil
+}
+
+// archiveTime returns the time a scheduled backup was made at, from its
+// file name.
+func archiveTime(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, filePrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, fileSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(fileTime, stamp, time.Local)
+	return t, err == nil
+}
+
+// Run creates a backup at every interval, until the context is canceled.
+// The first one is due an interval after the latest backup, so that
+// restarts do not delay nor multiply them.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	next := time.Now()
+	if names, err := s.archives(); err == nil && len(names) > 0 {
+		latest, _ := archiveTime(names[len(names)-1])
+		next = latest.Add(interval)
+	}
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if path, err := s.Create(ctx); err != nil {
+			slog.Error("scheduled backup failed", "error", err)
+		} else {
+			slog.Info("backup created", "file", path)
+		}
+		next = time.Now().Add(interval)
+	}
+}
+
+// listUploads returns the slash-separated paths of the uploaded files,
+// relative to the upload directory.
+func listUploads(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list uploads: %w", err)
+	}
+	return names, nil
+}
+
+func addFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+	return writeEntry(tw, name, fi.ModTime(), f, fi.Size())
+}
+
+func writeEntry(tw *tar.Writer, name string, modTime time.Time, r io.Reader, size int64) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		return fmt.Errorf("write backup %s: %w", name, err)
+	}
+	return nil
+}
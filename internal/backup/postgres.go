@@ -0,0 +1,39 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pgDump writes a logical export of the PostgreSQL database to path with
+// pg_dump, which reads a consistent snapshot. The export drops the objects
+// it recreates, to be restored over an existing database.
+func pgDump(ctx context.Context, url, path string) error {
+	return runTool(ctx, "pg_dump", "--no-owner", "--no-privileges", "--clean", "--if-exists",
+		"--file", path, "--dbname", url)
+}
+
+// pgRestore runs a logical export with psql, in a single transaction.
+func pgRestore(ctx context.Context, url, path string) error {
+	return runTool(ctx, "psql", "--quiet", "--no-psqlrc", "--single-transaction",
+		"--set", "ON_ERROR_STOP=1", "--file", path, "--dbname", url)
+}
+
+// runTool runs a PostgreSQL client tool, reporting its error output.
+func runTool(ctx context.Context, name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%s is required to back up and restore PostgreSQL databases: %w", name, err)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/toulibre/libreregistration/internal/database"
+)
+
+// ReadManifest reads the manifest of an archive, and checks that this build
+// can restore it.
+func ReadManifest(archive string) (*Manifest, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	return readManifest(tar.NewReader(gz))
+}
+
+func readManifest(tr *tar.Reader) (*Manifest, error) {
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("%w: no manifest", ErrInvalidArchive)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if m.Format != FormatVersion {
+		return nil, fmt.Errorf("%w: format %d", ErrInvalidArchive, m.Format)
+	}
+	latest, err := database.LatestVersion(m.Driver)
+	if err != nil {
+		return nil, err
+	}
+	if m.SchemaVersion > latest {
+		return nil, fmt.Errorf("%w: version %d, this build goes up to %d", ErrNewerSchema, m.SchemaVersion, latest)
+	}
+	return &m, nil
+}
+
+// Restore replaces the database and the uploads with those of an archive.
+// The driver of the archive must be that of the instance, and nothing may
+// use the database meanwhile. An archive of an older schema is migrated on
+// the next start.
+func Restore(ctx context.Context, archive, driver string, opts Options) (*Manifest, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	tr := tar.NewReader(gz)
+	m, err := readManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+	if m.Driver != driver {
+		return nil, fmt.Errorf("%w: %s", ErrWrongDriver, m.Driver)
+	}
+
+	// Extract everything before replacing anything. The uploads are
+	// extracted within the upload directory, which may be a mount point, to
+	// be moved in place
+	tmp, err := os.MkdirTemp("", "libreregistration-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("restore backup: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.MkdirAll(opts.UploadDir, 0o755); err != nil {
+		return nil, fmt.Errorf("restore backup: %w", err)
+	}
+	uploads, err := os.MkdirTemp(opts.UploadDir, ".restore-")
+	if err != nil {
+		return nil, fmt.Errorf("restore backup: %w", err)
+	}
+	defer os.RemoveAll(uploads)
+
+	dbFile := ""
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		switch {
+		case hdr.Name == sqliteName && driver == "sqlite", hdr.Name == pgDumpName && driver != "sqlite":
+			dbFile = filepath.Join(tmp, hdr.Name)
+			err = extract(tr, dbFile)
+		case strings.HasPrefix(hdr.Name, uploadsDir):
+			name, ok := localName(strings.TrimPrefix(hdr.Name, uploadsDir))
+			if !ok {
+				return nil, fmt.Errorf("%w: invalid name %q", ErrInvalidArchive, hdr.Name)
+			}
+			err = extract(tr, filepath.Join(uploads, name))
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidArchive, hdr.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dbFile == "" {
+		return nil, fmt.Errorf("%w: no database", ErrInvalidArchive)
+	}
+
+	if driver == "sqlite" {
+		version, err := database.CheckSQLite(dbFile)
+		if err != nil {
+			return nil, err
+		}
+		if version != m.SchemaVersion {
+			return nil, fmt.Errorf("%w: database at version %d, manifest at %d", ErrInvalidArchive, version, m.SchemaVersion)
+		}
+		if err := database.RestoreSQLite(dbFile, opts.DatabasePath); err != nil {
+			return nil, err
+		}
+	} else if err := pgRestore(ctx, opts.DatabaseURL, dbFile); err != nil {
+		return nil, err
+	}
+
+	if err := replaceUploads(uploads, opts.UploadDir); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// localName checks that a slash-separated name stays within its directory,
+// and returns it as a local path.
+func localName(name string) (string, bool) {
+	local := filepath.FromSlash(name)
+	return local, filepath.IsLocal(local)
+}
+
+func extract(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("restore backup: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("restore backup: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("restore backup: %w", err)
+	}
+	return f.Close()
+}
+
+// replaceUploads replaces the content of the upload directory with that of
+// src, one of its subdirectories.
+func replaceUploads(src, uploadDir string) error {
+	entries, err := os.ReadDir(uploadDir)
+	if err != nil {
+		return fmt.Errorf("restore uploads: %w", err)
+	}
+	for _, e := range entries {
+		if e.Name() == filepath.Base(src) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(uploadDir, e.Name())); err != nil {
+			return fmt.Errorf("restore uploads: %w", err)
+		}
+	}
+
+	entries, err = os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("restore uploads: %w", err)
+	}
+	for _, e := range entries {
+		if err := os.Rename(filepath.Join(src, e.Name()), filepath.Join(uploadDir, e.Name())); err != nil {
+			return fmt.Errorf("restore uploads: %w", err)
+		}
+	}
+	return nil
+}
@@ -1,59 +1,84 @@
 package captcha
 
 import (
-	"fmt"
-	"math/rand/v2"
 	"net/http"
-	"strconv"
+	"sort"
 
-	"github.com/toulibre/libreregistration/internal/middleware"
+	"github.com/toulibre/libreregistration/internal/metrics"
 )
 
-const sessionKey = "captcha_answer"
+// DefaultProvider is the provider used when none (or an unknown one) is configured.
+const DefaultProvider = "math"
 
-// Challenge holds the question text and expected answer for a math captcha.
+// Challenge holds what the registration form needs to render for a provider.
 type Challenge struct {
-	Question string
-	Answer   int
+	Provider   string // name of the provider that issued the challenge
+	Question   string // math: question text shown to the user
+	Token      string // pow: server nonce the browser must extend
+	Difficulty int    // pow: required number of leading zero bits
 }
 
-// Generate creates a simple addition captcha and stores the answer in the session.
-func Generate(w http.ResponseWriter, r *http.Request) Challenge {
-	a := rand.IntN(10) + 1
-	b := rand.IntN(10) + 1
-	c := Challenge{
-		Question: fmt.Sprintf("%d + %d", a, b),
-		Answer:   a + b,
-	}
-	session := middleware.GetSession(r)
-	if session != nil {
-		session.Values[sessionKey] = c.Answer
-		session.Save(r, w)
-	}
-	return c
+// Provider issues anti-spam challenges and verifies the submitted answers.
+// Providers keep their state in a Store so they can be exercised without a
+// browser or an HTTP session.
+type Provider interface {
+	Name() string
+	Generate(store Store) Challenge
+	// Verify checks the answer found in the submitted form. It must always
+	// clear the stored state to prevent replay.
+	Verify(store Store, r *http.Request) bool
 }
 
-// Verify checks that the user's answer matches the stored session answer.
-// It always clears the stored answer to prevent replay.
-func Verify(w http.ResponseWriter, r *http.Request) bool {
-	session := middleware.GetSession(r)
-	if session == nil {
-		return false
+var providers = map[string]Provider{}
+
+func register(p Provider) {
+	providers[p.Name()] = p
+}
+
+func init() {
+	register(NewMathProvider())
+	register(NewProofOfWorkProvider(defaultPowDifficulty))
+	register(NewTimingProvider(defaultMinDelay, defaultMaxAge))
+}
+
+// Lookup returns the provider registered under name, falling back to the
+// default provider.
+func Lookup(name string) Provider {
+	if p, ok := providers[name]; ok {
+		return p
 	}
-	expected, ok := session.Values[sessionKey].(int)
-	delete(session.Values, sessionKey)
-	session.Save(r, w)
-	if !ok {
-		return false
+	return providers[DefaultProvider]
+}
+
+// Names returns the names of all registered providers, sorted.
+func Names() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
 	}
-	userAnswer, err := strconv.Atoi(r.FormValue("captcha"))
-	if err != nil {
+	sort.Strings(names)
+	return names
+}
+
+// Generate issues a challenge from p, keeping its state in the user's session.
+func Generate(p Provider, w http.ResponseWriter, r *http.Request) Challenge {
+	return p.Generate(SessionStore(w, r))
+}
+
+// Verify checks the submitted answer against the state kept in the user's session.
+func Verify(p Provider, w http.ResponseWriter, r *http.Request) bool {
+	if !p.Verify(SessionStore(w, r), r) {
+		metrics.CaptchaFailures.Inc(p.Name())
 		return false
 	}
-	return userAnswer == expected
+	return true
 }
 
 // IsHoneypotFilled returns true if the honeypot field was filled (likely a bot).
 func IsHoneypotFilled(r *http.Request) bool {
-	return r.FormValue("website") != ""
+	if r.FormValue("website") != "" {
+		metrics.CaptchaFailures.Inc("honeypot")
+		return true
+	}
+	return false
 }
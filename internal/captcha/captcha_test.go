@@ -0,0 +1,196 @@
+package captcha_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/toulibre/libreregistration/internal/captcha"
+	"github.com/toulibre/libreregistration/internal/middleware"
+)
+
+// post returns a form submission with the fields.
+func post(fields url.Values) *http.Request {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(fields.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestMath(t *testing.T) {
+	p := captcha.NewMathProvider()
+	p.IntN = func(n int) int { return 2 } // 3 + 3
+
+	tests := []struct {
+		name   string
+		answer string
+		want   bool
+	}{
+		{"right answer", "6", true},
+		{"right answer with spaces", " 6 ", true},
+		{"wrong answer", "7", false},
+		{"not a number", "six", false},
+		{"no answer", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := captcha.MapStore{}
+			if c := p.Generate(store); c.Question != "3 + 3" {
+				t.Fatalf("question = %q, want 3 + 3", c.Question)
+			}
+			if got := p.Verify(store, post(url.Values{"captcha": {tt.answer}})); got != tt.want {
+				t.Errorf("Verify(%q) = %v, want %v", tt.answer, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		store := captcha.MapStore{}
+		p.Generate(store)
+		if !p.Verify(store, post(url.Values{"captcha": {"6"}})) {
+			t.Fatal("first submission rejected")
+		}
+		if p.Verify(store, post(url.Values{"captcha": {"6"}})) {
+			t.Error("solved challenge accepted twice")
+		}
+	})
+
+	t.Run("no challenge", func(t *testing.T) {
+		if p.Verify(captcha.MapStore{}, post(url.Values{"captcha": {"6"}})) {
+			t.Error("answer accepted without a challenge")
+		}
+	})
+}
+
+// nonce returns the first nonce which solves the challenge, or which does
+// not.
+func nonce(t *testing.T, c captcha.Challenge, solves bool) string {
+	t.Helper()
+	for n := 0; n < 1<<20; n++ {
+		nonce := strconv.Itoa(n)
+		if captcha.SolvesProofOfWork(c.Token, nonce, c.Difficulty) == solves {
+			return nonce
+		}
+	}
+	t.Fatal("no nonce found")
+	return ""
+}
+
+func TestProofOfWork(t *testing.T) {
+	p := captcha.NewProofOfWorkProvider(8)
+
+	tests := []struct {
+		name  string
+		nonce func(t *testing.T, c captcha.Challenge) string
+		want  bool
+	}{
+		{"valid proof", func(t *testing.T, c captcha.Challenge) string { return nonce(t, c, true) }, true},
+		{"wrong nonce", func(t *testing.T, c captcha.Challenge) string { return nonce(t, c, false) }, false},
+		{"no nonce", func(*testing.T, captcha.Challenge) string { return "" }, false},
+		{"nonce too long", func(*testing.T, captcha.Challenge) string { return strings.Repeat("0", 33) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := captcha.MapStore{}
+			c := p.Generate(store)
+			if c.Token == "" || c.Difficulty != 8 {
+				t.Fatalf("challenge = %+v", c)
+			}
+			n := tt.nonce(t, c)
+			if got := p.Verify(store, post(url.Values{"pow_nonce": {n}})); got != tt.want {
+				t.Errorf("Verify(%q) = %v, want %v", n, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		store := captcha.MapStore{}
+		n := nonce(t, p.Generate(store), true)
+		if !p.Verify(store, post(url.Values{"pow_nonce": {n}})) {
+			t.Fatal("first submission rejected")
+		}
+		if p.Verify(store, post(url.Values{"pow_nonce": {n}})) {
+			t.Error("proof accepted twice")
+		}
+	})
+}
+
+func TestTiming(t *testing.T) {
+	start := time.Date(2030, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    bool
+	}{
+		{"too fast", time.Second, false},
+		{"at the minimum delay", 3 * time.Second, true},
+		{"human delay", time.Minute, true},
+		{"at the maximum age", 2 * time.Hour, true},
+		{"too old", 2*time.Hour + time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := captcha.NewTimingProvider(3*time.Second, 2*time.Hour)
+			now := start
+			p.Now = func() time.Time { return now }
+			store := captcha.MapStore{}
+			p.Generate(store)
+			now = start.Add(tt.elapsed)
+			if got := p.Verify(store, post(nil)); got != tt.want {
+				t.Errorf("Verify after %v = %v, want %v", tt.elapsed, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no challenge", func(t *testing.T) {
+		p := captcha.NewTimingProvider(3*time.Second, 2*time.Hour)
+		if p.Verify(captcha.MapStore{}, post(nil)) {
+			t.Error("submission accepted without a challenge")
+		}
+	})
+}
+
+// TestSessionReplay submits a solved challenge twice with the same session
+// cookie, as a client keeping the cookie of the form would.
+func TestSessionReplay(t *testing.T) {
+	p := captcha.NewMathProvider()
+	p.IntN = func(n int) int { return 2 } // 3 + 3
+	session := middleware.Session(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef")))
+	handler := session(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			captcha.Generate(p, w, r)
+			return
+		}
+		if !captcha.Verify(p, w, r) {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie")
+	}
+	submit := func() int {
+		r := post(url.Values{"captcha": {"6"}})
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := submit(); code != http.StatusOK {
+		t.Fatalf("first submission: status %d", code)
+	}
+	if code := submit(); code != http.StatusForbidden {
+		t.Errorf("submission replayed with the same cookie: status %d, want %d", code, http.StatusForbidden)
+	}
+}
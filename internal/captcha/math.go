@@ -0,0 +1,51 @@
+package captcha
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const mathSessionKey = "captcha_answer"
+
+// MathProvider asks the user to solve a simple addition.
+type MathProvider struct {
+	// IntN returns a random number in [0, n). It defaults to math/rand.
+	IntN func(n int) int
+}
+
+func NewMathProvider() *MathProvider {
+	return &MathProvider{IntN: rand.IntN}
+}
+
+func (p *MathProvider) Name() string {
+	return "math"
+}
+
+// Generate creates an addition of two numbers between 1 and 10 and stores the answer.
+func (p *MathProvider) Generate(store Store) Challenge {
+	a := p.IntN(10) + 1
+	b := p.IntN(10) + 1
+	store.Set(mathSessionKey, a+b)
+	return Challenge{
+		Provider: p.Name(),
+		Question: fmt.Sprintf("%d + %d", a, b),
+	}
+}
+
+// Verify checks the "captcha" form field against the stored answer.
+func (p *MathProvider) Verify(store Store, r *http.Request) bool {
+	v, _ := store.Get(mathSessionKey)
+	store.Delete(mathSessionKey)
+	expected, ok := v.(int)
+	if !ok {
+		return false
+	}
+	userAnswer, err := strconv.Atoi(strings.TrimSpace(r.FormValue("captcha")))
+	if err != nil {
+		return false
+	}
+	return userAnswer == expected
+}
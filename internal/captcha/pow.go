@@ -0,0 +1,75 @@
+package captcha
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/bits"
+	"net/http"
+	"strings"
+)
+
+const (
+	powSessionKey        = "captcha_pow"
+	defaultPowDifficulty = 16
+)
+
+// ProofOfWorkProvider makes the browser find a nonce such that
+// SHA-256(token + ":" + nonce) starts with Difficulty zero bits. The work is
+// done by static/js/pow.js without any user interaction.
+type ProofOfWorkProvider struct {
+	Difficulty int
+}
+
+func NewProofOfWorkProvider(difficulty int) *ProofOfWorkProvider {
+	return &ProofOfWorkProvider{Difficulty: difficulty}
+}
+
+func (p *ProofOfWorkProvider) Name() string {
+	return "pow"
+}
+
+// Generate creates a random token and stores it until the form is submitted.
+func (p *ProofOfWorkProvider) Generate(store Store) Challenge {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	store.Set(powSessionKey, token)
+	return Challenge{
+		Provider:   p.Name(),
+		Token:      token,
+		Difficulty: p.Difficulty,
+	}
+}
+
+// Verify checks the "pow_nonce" form field against the stored token.
+func (p *ProofOfWorkProvider) Verify(store Store, r *http.Request) bool {
+	v, _ := store.Get(powSessionKey)
+	store.Delete(powSessionKey)
+	token, ok := v.(string)
+	if !ok || token == "" {
+		return false
+	}
+	nonce := strings.TrimSpace(r.FormValue("pow_nonce"))
+	if nonce == "" || len(nonce) > 32 {
+		return false
+	}
+	return SolvesProofOfWork(token, nonce, p.Difficulty)
+}
+
+// SolvesProofOfWork reports whether nonce is a valid solution for token.
+func SolvesProofOfWork(token, nonce string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(token + ":" + nonce))
+	return leadingZeroBits(sum[:]) >= difficulty
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
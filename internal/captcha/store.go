@@ -0,0 +1,127 @@
+package captcha
+
+import (
+	"crypto/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/middleware"
+)
+
+// Store keeps challenge state between rendering the form and its submission.
+type Store interface {
+	Get(key string) (any, bool)
+	Set(key string, value any)
+	Delete(key string)
+}
+
+// SessionStore returns a Store backed by the request's session. Changes are
+// saved immediately. Without a session, nothing is kept and every
+// verification fails.
+//
+// The session lives in a cookie, which a client can send again once a
+// challenge is verified: each challenge has an ID, remembered as spent by
+// the server when the challenge is deleted, and expires after challengeTTL.
+func SessionStore(w http.ResponseWriter, r *http.Request) Store {
+	return &sessionStore{w: w, r: r}
+}
+
+// challengeTTL is how long a challenge can be answered, and spent ones are
+// remembered.
+const challengeTTL = 2 * time.Hour
+
+type sessionStore struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+func (s *sessionStore) Get(key string) (any, bool) {
+	session := middleware.GetSession(s.r)
+	if session == nil {
+		return nil, false
+	}
+	id, _ := session.Values[key+"_id"].(string)
+	issuedAt, _ := session.Values[key+"_issued_at"].(int64)
+	if id == "" || time.Since(time.Unix(issuedAt, 0)) > challengeTTL || spent.has(id) {
+		return nil, false
+	}
+	v, ok := session.Values[key]
+	return v, ok
+}
+
+func (s *sessionStore) Set(key string, value any) {
+	session := middleware.GetSession(s.r)
+	if session == nil {
+		return
+	}
+	session.Values[key] = value
+	session.Values[key+"_id"] = rand.Text()
+	session.Values[key+"_issued_at"] = time.Now().Unix()
+	session.Save(s.r, s.w)
+}
+
+func (s *sessionStore) Delete(key string) {
+	session := middleware.GetSession(s.r)
+	if session == nil {
+		return
+	}
+	if id, ok := session.Values[key+"_id"].(string); ok {
+		issuedAt, _ := session.Values[key+"_issued_at"].(int64)
+		spent.add(id, time.Unix(issuedAt, 0).Add(challengeTTL))
+	}
+	delete(session.Values, key)
+	delete(session.Values, key+"_id")
+	delete(session.Values, key+"_issued_at")
+	session.Save(s.r, s.w)
+}
+
+// spent is the set of the challenges of the sessions already verified, until
+// they expire.
+var spent = &spentChallenges{expires: make(map[string]time.Time)}
+
+type spentChallenges struct {
+	mu      sync.Mutex
+	expires map[string]time.Time // by challenge ID
+	purged  time.Time
+}
+
+func (c *spentChallenges) add(id string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.purged) > time.Minute {
+		for id, t := range c.expires {
+			if now.After(t) {
+				delete(c.expires, id)
+			}
+		}
+		c.purged = now
+	}
+	if now.Before(expires) {
+		c.expires[id] = expires
+	}
+}
+
+func (c *spentChallenges) has(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.expires[id]
+	return ok
+}
+
+// MapStore is an in-memory Store, useful in tests.
+type MapStore map[string]any
+
+func (m MapStore) Get(key string) (any, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+func (m MapStore) Set(key string, value any) {
+	m[key] = value
+}
+
+func (m MapStore) Delete(key string) {
+	delete(m, key)
+}
@@ -0,0 +1,46 @@
+package captcha
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	timingSessionKey = "captcha_issued_at"
+	defaultMinDelay  = 3 * time.Second
+	defaultMaxAge    = 2 * time.Hour
+)
+
+// TimingProvider rejects forms submitted faster than a human could fill them
+// in, or long after they were displayed. It shows nothing to the user.
+type TimingProvider struct {
+	MinDelay time.Duration
+	MaxAge   time.Duration
+	Now      func() time.Time
+}
+
+func NewTimingProvider(minDelay, maxAge time.Duration) *TimingProvider {
+	return &TimingProvider{MinDelay: minDelay, MaxAge: maxAge, Now: time.Now}
+}
+
+func (p *TimingProvider) Name() string {
+	return "timing"
+}
+
+// Generate records when the form was displayed.
+func (p *TimingProvider) Generate(store Store) Challenge {
+	store.Set(timingSessionKey, p.Now().UnixNano())
+	return Challenge{Provider: p.Name()}
+}
+
+// Verify checks that the time since the form was displayed is plausible.
+func (p *TimingProvider) Verify(store Store, r *http.Request) bool {
+	v, _ := store.Get(timingSessionKey)
+	store.Delete(timingSessionKey)
+	issuedAt, ok := v.(int64)
+	if !ok {
+		return false
+	}
+	elapsed := p.Now().Sub(time.Unix(0, issuedAt))
+	return elapsed >= p.MinDelay && elapsed <= p.MaxAge
+}
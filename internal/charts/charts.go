@@ -0,0 +1,199 @@
+// Package charts renders simple charts as standalone SVG elements, so that
+// pages can show them without scripts.
+package charts
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Palette holds the colors of the successive series.
+var Palette = []string{"#2563eb", "#dc2626", "#16a34a", "#d97706", "#7c3aed", "#0891b2", "#db2777", "#4b5563"}
+
+const (
+	fontAttrs  = `font-family="sans-serif" font-size="11" fill="#6b7280"`
+	gridColor  = "#e5e7eb"
+	axisColor  = "#9ca3af"
+	marginLeft = 40
+	marginTop  = 10
+)
+
+// Point is a point of a line, in the units of the chart.
+type Point struct {
+	X, Y float64
+}
+
+// Series is a line of a line chart.
+type Series struct {
+	Label  string
+	Points []Point // by increasing X
+}
+
+// Line is a line chart with a shared X axis. Both axes start at 0.
+type Line struct {
+	Title  string // accessible name of the chart
+	XLabel string
+	YLabel string
+	Series []Series
+	Width  int // defaults to 640
+	Height int // defaults to 280
+}
+
+// SVG renders the chart.
+func (c Line) SVG() string {
+	width, height := orDefault(c.Width, 640), orDefault(c.Height, 280)
+	legendHeight := 18 * ((len(c.Series) + 2) / 3)
+	plotW := float64(width - marginLeft - 10)
+	plotH := float64(height - marginTop - 36 - legendHeight)
+
+	maxX, maxY := 1.0, 1.0 // axes cover at least [0, 1]
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			maxX = math.Max(maxX, p.X)
+			maxY = math.Max(maxY, p.Y)
+		}
+	}
+	xTicks, yTicks := ticks(maxX, 6), ticks(maxY, 4)
+	maxX, maxY = xTicks[len(xTicks)-1], yTicks[len(yTicks)-1]
+	x := func(v float64) float64 { return marginLeft + v/maxX*plotW }
+	y := func(v float64) float64 { return marginTop + plotH - v/maxY*plotH }
+
+	var b strings.Builder
+	open(&b, width, height, c.Title)
+	for _, t := range yTicks {
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`, marginLeft, y(t), x(maxX), y(t), gridColor)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle" %s>%s</text>`, marginLeft-6, y(t), fontAttrs, formatTick(t))
+	}
+	for _, t := range xTicks {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" %s>%s</text>`, x(t), y(0)+14, fontAttrs, formatTick(t))
+	}
+	fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`, marginLeft, y(0), x(maxX), y(0), axisColor)
+	if c.XLabel != "" {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" %s>%s</text>`, x(maxX/2), y(0)+28, fontAttrs, esc(c.XLabel))
+	}
+	if c.YLabel != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" %s>%s</text>`, marginLeft+4, marginTop+4, fontAttrs, esc(c.YLabel))
+	}
+
+	for i, s := range c.Series {
+		color := Palette[i%len(Palette)]
+		points := make([]string, len(s.Points))
+		for j, p := range s.Points {
+			points[j] = fmt.Sprintf("%.1f,%.1f", x(p.X), y(p.Y))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2" stroke-linejoin="round"><title>%s</title></polyline>`,
+			strings.Join(points, " "), color, esc(s.Label))
+
+		lx := marginLeft + (i%3)*(width-marginLeft)/3
+		ly := height - legendHeight + 18*(i/3) + 4
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, lx, ly, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" %s>%s</text>`, lx+14, ly+9, fontAttrs, esc(truncate(s.Label, 40)))
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// Bar is a bar of a bar chart.
+type Bar struct {
+	Label string
+	Value float64
+	Text  string // shown after the bar, the value when empty
+}
+
+// Bars is a horizontal bar chart.
+type Bars struct {
+	Title string // accessible name of the chart
+	Bars  []Bar
+	Max   float64 // value of a full-width bar, the largest value when 0
+	Width int     // defaults to 640
+}
+
+// SVG renders the chart.
+func (c Bars) SVG() string {
+	const rowHeight, barHeight, labelWidth, textWidth = 24, 16, 180, 70
+	width := orDefault(c.Width, 640)
+	height := rowHeight*len(c.Bars) + 4
+	barW := float64(width - labelWidth - textWidth)
+
+	max := c.Max
+	for _, bar := range c.Bars {
+		max = math.Max(max, bar.Value)
+	}
+	if max <= 0 {
+		max = 1
+	}
+
+	var b strings.Builder
+	open(&b, width, height, c.Title)
+	for i, bar := range c.Bars {
+		top := i*rowHeight + 2
+		w := math.Max(bar.Value, 0) / max * barW
+		text := bar.Text
+		if text == "" {
+			text = formatTick(bar.Value)
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" dominant-baseline="middle" %s>%s</text>`, labelWidth-8, top+barHeight/2, fontAttrs, esc(truncate(bar.Label, 28)))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" rx="2" fill="%s"><title>%s</title></rect>`, labelWidth, top, barW, barHeight, gridColor, esc(bar.Label))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" rx="2" fill="%s"><title>%s: %s</title></rect>`, labelWidth, top, w, barHeight, Palette[0], esc(bar.Label), esc(text))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" dominant-baseline="middle" %s>%s</text>`, float64(labelWidth)+barW+6, top+barHeight/2, fontAttrs, esc(text))
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+func open(b *strings.Builder, width, height int, title string) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" role="img" aria-label="%s"><title>%s</title>`,
+		width, height, esc(title), esc(title))
+}
+
+// ticks returns n or so round values from 0 covering max.
+func ticks(max float64, n int) []float64 {
+	if max <= 0 {
+		return []float64{0, 1}
+	}
+	raw := max / float64(n)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*magnitude >= raw {
+			step = m * magnitude
+			break
+		}
+	}
+	var out []float64
+	for v := 0.0; ; v += step {
+		out = append(out, v)
+		if v >= max {
+			return out
+		}
+	}
+}
+
+func formatTick(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func esc(s string) string {
+	return html.EscapeString(s)
+}
+
+func orDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
@@ -1,50 +1,192 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	Port           string
-	DatabaseDriver string
-	DatabasePath   string
-	DatabaseURL    string
-	SessionSecret  string
-	CSRFKey        string
-	BaseURL        string
+	Port            string
+	DatabaseDriver  string
+	DatabasePath    string
+	DatabaseURL     string
+	SessionSecret   string
+	CSRFKey         string
+	BaseURL         string
 	AdminUsername   string
-	AdminPassword  string
-	SMTPHost       string
-	SMTPPort       string
-	SMTPUser       string
-	SMTPPassword   string
-	SMTPFrom       string
-	UploadDir      string
-}
-
-func Load() *Config {
-	return &Config{
-		Port:           envOr("PORT", "8080"),
-		DatabaseDriver: envOr("DATABASE_DRIVER", "sqlite"),
-		DatabasePath:   envOr("DATABASE_PATH", "libreregistration.db"),
-		DatabaseURL:    envOr("DATABASE_URL", ""),
-		SessionSecret: envOr("SESSION_SECRET", "change-me-in-production-32chars!"),
-		CSRFKey:       envOr("CSRF_KEY", "change-me-csrf-key-32-chars!!!!"),
-		BaseURL:       envOr("BASE_URL", "http://localhost:8080"),
-		AdminUsername: envOr("ADMIN_USERNAME", ""),
-		AdminPassword: envOr("ADMIN_PASSWORD", ""),
-		SMTPHost:      envOr("SMTP_HOST", ""),
-		SMTPPort:      envOr("SMTP_PORT", "587"),
-		SMTPUser:      envOr("SMTP_USER", ""),
-		SMTPPassword:  envOr("SMTP_PASSWORD", ""),
-		SMTPFrom:      envOr("SMTP_FROM", ""),
-		UploadDir:     envOr("UPLOAD_DIR", "uploads"),
-	}
-}
-
-func envOr(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return fallback
+	AdminPassword   string
+	SMTPHost        string
+	SMTPPort        string
+	SMTPUser        string
+	SMTPPassword    string
+	SMTPFrom        string
+	UploadDir       string
+	MetricsToken    string        // bearer token required by /metrics
+	MetricsAddr     string        // separate listen address of /metrics
+	LogFormat       string        // text or json
+	LogLevel        string        // debug, info, warn or error
+	LogRedact       bool          // hide passwords, tokens and emails in the logs
+	DrainDelay      time.Duration // serving while reported draining before shutdown
+	ShutdownTimeout time.Duration // bound on the wait for requests and jobs at shutdown
+	BackupDir       string        // directory of the scheduled backups
+	BackupInterval  time.Duration // time between scheduled backups, none when 0
+	BackupKeep      int           // number of scheduled backups kept
+	DevMode         bool          // local development: the default secrets are accepted
+	File            string        // configuration file read, if any
+
+	settings []Setting // as loaded, in order
+	invalid  []string  // values that could not be parsed, the defaults were kept
+}
+
+// Setting is a configuration variable, named after its environment variable,
+// and where its value comes from: "env", "file" or "default".
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+	Secret bool
+}
+
+// The default secrets, only accepted in dev mode.
+const (
+	defaultSessionSecret = "change-me-in-production-32chars!"
+	defaultCSRFKey       = "change-me-csrf-key-32-chars!!!!"
+)
+
+// Load reads the configuration from the environment variables, and from the
+// file named by CONFIG_FILE if set. The environment variables override the
+// file.
+func Load() (*Config, error) {
+	l := &loader{}
+	path := os.Getenv("CONFIG_FILE")
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		l.file = values
+	}
+
+	cfg := &Config{
+		Port:            l.str("PORT", "8080"),
+		DatabaseDriver:  l.str("DATABASE_DRIVER", "sqlite"),
+		DatabasePath:    l.str("DATABASE_PATH", "libreregistration.db"),
+		DatabaseURL:     l.secret("DATABASE_URL"),
+		SessionSecret:   l.secretOr("SESSION_SECRET", defaultSessionSecret),
+		CSRFKey:         l.secretOr("CSRF_KEY", defaultCSRFKey),
+		BaseURL:         l.str("BASE_URL", "http://localhost:8080"),
+		AdminUsername:   l.str("ADMIN_USERNAME", ""),
+		AdminPassword:   l.secret("ADMIN_PASSWORD"),
+		SMTPHost:        l.str("SMTP_HOST", ""),
+		SMTPPort:        l.str("SMTP_PORT", "587"),
+		SMTPUser:        l.str("SMTP_USER", ""),
+		SMTPPassword:    l.secret("SMTP_PASSWORD"),
+		SMTPFrom:        l.str("SMTP_FROM", ""),
+		UploadDir:       l.str("UPLOAD_DIR", "uploads"),
+		MetricsToken:    l.secret("METRICS_TOKEN"),
+		MetricsAddr:     l.str("METRICS_ADDR", ""),
+		LogFormat:       l.str("LOG_FORMAT", "text"),
+		LogLevel:        l.str("LOG_LEVEL", "info"),
+		LogRedact:       l.boolean("LOG_REDACT", true),
+		DrainDelay:      l.duration("DRAIN_DELAY", 0),
+		ShutdownTimeout: l.duration("SHUTDOWN_TIMEOUT", 20*time.Second),
+		BackupDir:       l.str("BACKUP_DIR", "backups"),
+		BackupInterval:  l.duration("BACKUP_INTERVAL", 0),
+		BackupKeep:      l.integer("BACKUP_KEEP", 7),
+		DevMode:         l.boolean("DEV_MODE", false),
+		File:            path,
+	}
+	for name, v := range l.file {
+		if !l.known(name) {
+			return nil, fmt.Errorf("%s:%d: unknown setting %s", path, v.line, v.key)
+		}
+	}
+	cfg.settings = l.settings
+	cfg.invalid = l.invalid
+	return cfg, nil
+}
+
+// Settings returns the variables read by Load, secrets included.
+func (c *Config) Settings() []Setting {
+	return c.settings
+}
+
+// loader reads the variables, from the environment or else from the file,
+// and records where each value comes from.
+type loader struct {
+	file     map[string]fileValue
+	settings []Setting
+	invalid  []string
+}
+
+func (l *loader) lookup(name, fallback string, secret bool) string {
+	s := Setting{Name: name, Value: fallback, Source: "default", Secret: secret}
+	if v, ok := l.file[name]; ok {
+		s.Value, s.Source = v.value, "file"
+	}
+	if v := os.Getenv(name); v != "" {
+		s.Value, s.Source = v, "env"
+	}
+	l.settings = append(l.settings, s)
+	return s.Value
+}
+
+// known reports whether the variable was read.
+func (l *loader) known(name string) bool {
+	for _, s := range l.settings {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reject records an invalid value, whose default is kept.
+func (l *loader) reject(name, kind, value string) {
+	l.invalid = append(l.invalid, fmt.Sprintf("%s: invalid %s %q", name, kind, value))
+}
+
+func (l *loader) str(name, fallback string) string {
+	return l.lookup(name, fallback, false)
+}
+
+func (l *loader) secret(name string) string {
+	return l.lookup(name, "", true)
+}
+
+func (l *loader) secretOr(name, fallback string) string {
+	return l.lookup(name, fallback, true)
+}
+
+// duration reads a duration such as "10s".
+func (l *loader) duration(name string, fallback time.Duration) time.Duration {
+	v := l.lookup(name, fallback.String(), false)
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		l.reject(name, "duration", v)
+		return fallback
+	}
+	return d
+}
+
+func (l *loader) integer(name string, fallback int) int {
+	v := l.lookup(name, strconv.Itoa(fallback), false)
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		l.reject(name, "number", v)
+		return fallback
+	}
+	return n
+}
+
+func (l *loader) boolean(name string, fallback bool) bool {
+	v := l.lookup(name, strconv.FormatBool(fallback), false)
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.reject(name, "boolean", v)
+		return fallback
+	}
+	return b
 }
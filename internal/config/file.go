@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// fileValue is a value of the configuration file, with where it was set.
+type fileValue struct {
+	key   string // as written, with its table
+	value string
+	line  int
+}
+
+// readFile reads a configuration file in TOML, by variable name.
+func readFile(path string) (map[string]fileValue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read configuration: %w", err)
+	}
+	defer f.Close()
+	return parseFile(path, f)
+}
+
+// parseFile parses a configuration file, named path in the errors. The keys
+// are the environment variables in lower case, whose first word may be a
+// table: SMTP_HOST is either smtp_host, smtp.host, or host in the [smtp]
+// table.
+//
+// Only the subset of TOML the settings need is supported: bare keys, tables,
+// comments, single-line basic and literal strings, numbers and booleans.
+// Arrays, inline tables, dates and multi-line strings are rejected.
+func parseFile(path string, r io.Reader) (map[string]fileValue, error) {
+	values := make(map[string]fileValue)
+	tables := make(map[string]int) // line by name
+	table := ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			name, rest, ok := strings.Cut(line[1:], "]")
+			name = strings.TrimSpace(name)
+			if !ok || !validKey(name) || checkEnd(rest) != nil {
+				return nil, fmt.Errorf("%s:%d: invalid table %s", path, n, line)
+			}
+			if prev, ok := tables[name]; ok {
+				return nil, fmt.Errorf("%s:%d: table [%s] already defined line %d", path, n, name, prev)
+			}
+			tables[name] = n
+			table = name
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validKey(key) {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %w", path, n, key, err)
+		}
+		name := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+		if prev, ok := values[name]; ok {
+			return nil, fmt.Errorf("%s:%d: %s already set line %d", path, n, key, prev.line)
+		}
+		values[name] = fileValue{key: key, value: value, line: n}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read configuration: %w", err)
+	}
+	return values, nil
+}
+
+// validKey reports whether the key is made of bare keys, possibly dotted.
+func validKey(key string) bool {
+	for _, part := range strings.Split(key, ".") {
+		if part == "" || strings.TrimFunc(part, func(r rune) bool {
+			return r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+		}) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// checkEnd checks that only spaces and a comment follow a value or a table
+// header.
+func checkEnd(rest string) error {
+	rest = strings.TrimLeft(rest, " \t")
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after the value", rest)
+	}
+	return nil
+}
+
+var errValue = errors.New("expected a string, a number or a boolean")
+
+// parseValue returns a value as the text of an environment variable.
+func parseValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"""`), strings.HasPrefix(raw, "'''"):
+		return "", errors.New("multi-line strings are not supported")
+
+	case strings.HasPrefix(raw, `"`):
+		s, rest, err := unescape(raw[1:])
+		if err == nil {
+			err = checkEnd(rest)
+		}
+		if err != nil {
+			return "", err
+		}
+		return s, nil
+
+	case strings.HasPrefix(raw, "'"):
+		// Literal strings have no escapes
+		s, rest, ok := strings.Cut(raw[1:], "'")
+		if !ok {
+			return "", errors.New("unterminated string")
+		}
+		if err := checkEnd(rest); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+
+	v, _, _ := strings.Cut(raw, "#")
+	v = strings.TrimSpace(v)
+	if i := strings.IndexAny(v, " \t"); i >= 0 {
+		return "", checkEnd(v[i:])
+	}
+	if v == "true" || v == "false" {
+		return v, nil
+	}
+	v = strings.ReplaceAll(v, "_", "")
+	if _, err := strconv.ParseFloat(v, 64); err != nil {
+		return "", errValue
+	}
+	return v, nil
+}
+
+// unescape reads a basic string up to its closing quote, decoding the escapes
+// of TOML, and returns the text following it.
+func unescape(s string) (value, rest string, err error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", errors.New("unterminated string")
+			}
+			switch e := s[i]; e {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				size := 4
+				if e == 'U' {
+					size = 8
+				}
+				if i+size >= len(s) {
+					return "", "", fmt.Errorf("invalid escape \\%s", s[i:])
+				}
+				code, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(code)) {
+					return "", "", fmt.Errorf("invalid escape \\%s", s[i:i+1+size])
+				}
+				b.WriteRune(rune(code))
+				i += size
+			default:
+				return "", "", fmt.Errorf("invalid escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
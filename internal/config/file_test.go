@@ -0,0 +1,133 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		// Basic strings and their escapes
+		{`"plain"`, "plain", false},
+		{`"a \"quoted\" word"`, `a "quoted" word`, false},
+		{`"C:\\data\\uploads"`, `C:\data\uploads`, false},
+		{`"tab\there\nnew line"`, "tab\there\nnew line", false},
+		{`"\b\f\r"`, "\b\f\r", false},
+		{`"caf\u00e9 \U0001F600"`, "café 😀", false},
+		{`"é"`, "é", false},
+		{`"\x41"`, "", true},
+		{`"\'"`, "", true},
+		{`"\u00e"`, "", true},
+		{`"\uD800"`, "", true},
+		{`"unterminated`, "", true},
+		{`"ends with a backslash\"`, "", true},
+
+		// Literal strings have no escapes
+		{`'C:\data\uploads'`, `C:\data\uploads`, false},
+		{`'say "hi"'`, `say "hi"`, false},
+		{`'unterminated`, "", true},
+		{`'''multi'''`, "", true},
+		{`"""multi"""`, "", true},
+
+		// Comments after values
+		{`"value" # comment`, "value", false},
+		{`"value"# comment`, "value", false},
+		{`"a # b" # comment`, "a # b", false},
+		{`"a \" # b" # comment`, `a " # b`, false},
+		{`'value' # comment`, "value", false},
+		{`'value'# it's a comment`, "value", false},
+		{`'a # b' # comment`, "a # b", false},
+		{`8080 # port`, "8080", false},
+		{`true # comment`, "true", false},
+
+		// Text after values
+		{`"a" "b"`, "", true},
+		{`'a' b`, "", true},
+		{`'a' 'b' # comment`, "", true},
+		{`80 80`, "", true},
+
+		// Numbers and booleans
+		{`587`, "587", false},
+		{`1_000`, "1000", false},
+		{`-1.5`, "-1.5", false},
+		{`false`, "false", false},
+		{`yes`, "", true},
+		{`[1, 2]`, "", true},
+		{`{ a = 1 }`, "", true},
+		{``, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseValue(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseValue(%s) = %q, %v, want %q, error %v", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	values, err := parseFile("test.toml", strings.NewReader(`# Comment
+port = 8080
+base_url = "https://events.example.org"  # trailing comment
+log.level = 'debug' # dotted key
+
+[smtp] # comment after a table
+host = "smtp.example.org"
+from = 'noreply@example.org'
+
+[database]
+path = "/data/db.sqlite"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"PORT":          "8080",
+		"BASE_URL":      "https://events.example.org",
+		"LOG_LEVEL":     "debug",
+		"SMTP_HOST":     "smtp.example.org",
+		"SMTP_FROM":     "noreply@example.org",
+		"DATABASE_PATH": "/data/db.sqlite",
+	}
+	if len(values) != len(want) {
+		t.Errorf("got %d values, want %d: %v", len(values), len(want), values)
+	}
+	for name, value := range want {
+		if values[name].value != value {
+			t.Errorf("%s = %q, want %q", name, values[name].value, value)
+		}
+	}
+	if v := values["SMTP_HOST"]; v.key != "smtp.host" || v.line != 7 {
+		t.Errorf("SMTP_HOST set by %s line %d, want smtp.host line 7", v.key, v.line)
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"same key twice", "port = 1\nport = 2", "test.toml:2: port already set line 1"},
+		{"dotted key then table", "smtp.host = \"a\"\n[smtp]\nhost = \"b\"", "test.toml:3: smtp.host already set line 1"},
+		{"underscore then table", "smtp_host = \"a\"\n[smtp]\nhost = \"b\"", "test.toml:3: smtp.host already set line 1"},
+		{"table twice", "[smtp]\nhost = \"a\"\n[smtp]\nport = 25", "test.toml:3: table [smtp] already defined line 1"},
+		{"no value", "port", "test.toml:1: expected key = value"},
+		{"quoted key", "\"port\" = 1", "test.toml:1: expected key = value"},
+		{"invalid table", "[smtp", "test.toml:1: invalid table [smtp"},
+		{"array of tables", "[[smtp]]", "test.toml:1: invalid table [[smtp]]"},
+		{"text after a table", "[smtp] host", "test.toml:1: invalid table [smtp] host"},
+		{"invalid value", "port = eighty", "test.toml:1: port: expected a string, a number or a boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFile("test.toml", strings.NewReader(tt.file))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Validate checks the configuration before the server starts. It returns
+// the errors found, joined, and warnings about settings that are likely
+// wrong but do not prevent serving.
+func (c *Config) Validate() (warnings []string, err error) {
+	var errs []error
+	for _, msg := range c.invalid {
+		errs = append(errs, errors.New(msg))
+	}
+
+	// Secrets: the defaults and the examples are public
+	for _, s := range []struct{ name, value, fallback string }{
+		{"SESSION_SECRET", c.SessionSecret, defaultSessionSecret},
+		{"CSRF_KEY", c.CSRFKey, defaultCSRFKey},
+	} {
+		var problem string
+		switch {
+		case s.value == "":
+			problem = fmt.Sprintf("%s is not set, set a random value", s.name)
+		case s.value == s.fallback || strings.HasPrefix(s.value, "change-me"):
+			problem = fmt.Sprintf("%s is left to its default, set a random value", s.name)
+		case len(s.value) < 32:
+			// Short but chosen: a weaker secret, not a public one
+			warnings = append(warnings, fmt.Sprintf("%s is short, use 32 characters or more", s.name))
+			continue
+		default:
+			continue
+		}
+		if c.DevMode {
+			warnings = append(warnings, problem)
+		} else {
+			errs = append(errs, errors.New(problem+" (or set DEV_MODE=true for local development)"))
+		}
+	}
+
+	if err := checkBaseURL(c.BaseURL); err != nil {
+		errs = append(errs, err)
+	} else if u, _ := url.Parse(c.BaseURL); u.Scheme == "http" && !c.DevMode && !isLocal(u.Hostname()) {
+		warnings = append(warnings, "BASE_URL is not https: sessions and links are sent in clear")
+	}
+
+	if n, err := strconv.Atoi(c.Port); err != nil || n < 1 || n > 65535 {
+		errs = append(errs, fmt.Errorf("PORT: invalid port %q", c.Port))
+	}
+	switch c.DatabaseDriver {
+	case "sqlite":
+	case "postgres":
+		if c.DatabaseURL == "" {
+			errs = append(errs, errors.New("DATABASE_URL is required with the postgres driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("DATABASE_DRIVER: unknown driver %q, use sqlite or postgres", c.DatabaseDriver))
+	}
+
+	warnings = append(warnings, c.checkSMTP()...)
+	return warnings, errors.Join(errs...)
+}
+
+// checkBaseURL checks that the base URL is an absolute http(s) URL, which
+// paths are appended to.
+func checkBaseURL(base string) error {
+	u, err := url.Parse(base)
+	switch {
+	case err != nil:
+		return fmt.Errorf("BASE_URL: %w", err)
+	case u.Scheme != "http" && u.Scheme != "https", u.Host == "":
+		return fmt.Errorf("BASE_URL: %q is not an absolute http or https URL", base)
+	case u.RawQuery != "" || u.Fragment != "" || u.User != nil:
+		return fmt.Errorf("BASE_URL: %q must not have credentials, a query or a fragment", base)
+	case strings.HasSuffix(u.Path, "/"):
+		return fmt.Errorf("BASE_URL: %q must not end with a slash", base)
+	}
+	return nil
+}
+
+// isLocal reports whether the host is this machine.
+func isLocal(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkSMTP returns warnings about an incomplete mail configuration, with
+// which the mails would not be sent or be rejected.
+func (c *Config) checkSMTP() []string {
+	if c.SMTPHost == "" {
+		if c.SMTPUser != "" || c.SMTPPassword != "" || c.SMTPFrom != "" {
+			return []string{"SMTP_HOST is not set: no mail is sent, the other SMTP settings are ignored"}
+		}
+		return nil
+	}
+
+	var warnings []string
+	if n, err := strconv.Atoi(c.SMTPPort); err != nil || n < 1 || n > 65535 {
+		warnings = append(warnings, fmt.Sprintf("SMTP_PORT: invalid port %q, mails cannot be sent", c.SMTPPort))
+	}
+	if c.SMTPFrom == "" {
+		warnings = append(warnings, "SMTP_FROM is not set: mails have no sender and are likely rejected")
+	} else if _, err := mail.ParseAddress(c.SMTPFrom); err != nil {
+		warnings = append(warnings, fmt.Sprintf("SMTP_FROM: invalid address %q", c.SMTPFrom))
+	}
+	if (c.SMTPUser == "") != (c.SMTPPassword == "") {
+		warnings = append(warnings, "SMTP_USER and SMTP_PASSWORD go together: set both or neither")
+	}
+	return warnings
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSecrets(t *testing.T) {
+	random := strings.Repeat("x", 32)
+	tests := []struct {
+		name        string
+		secret      string
+		devMode     bool
+		wantErr     bool
+		wantWarning bool
+	}{
+		{"random", random, false, false, false},
+		{"empty", "", false, true, false},
+		{"default", defaultSessionSecret, false, true, false},
+		{"example", "change-me-please-with-32-characters", false, true, false},
+		{"default in dev mode", defaultSessionSecret, true, false, true},
+		{"short", "short but random", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				Port:           "8080",
+				DatabaseDriver: "sqlite",
+				BaseURL:        "https://events.example.org",
+				SessionSecret:  tt.secret,
+				CSRFKey:        random,
+				DevMode:        tt.devMode,
+			}
+			warnings, err := c.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want an error %v", err, tt.wantErr)
+			}
+			if (len(warnings) > 0) != tt.wantWarning {
+				t.Errorf("warnings = %q, want a warning %v", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
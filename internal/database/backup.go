@@ -0,0 +1,117 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotSQLite is returned by the backup functions on other databases, which
+// have their own tools such as pg_dump.
+var ErrNotSQLite = errors.New("not an SQLite database")
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// BackupSQLite writes a consistent copy of the database to a new file, while
+// it may be in use.
+func BackupSQLite(db *DB, path string) error {
+	if db.Driver != "sqlite" {
+		return ErrNotSQLite
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("back up database: %s already exists", path)
+	}
+	// VACUUM INTO takes no placeholder
+	if _, err := db.Exec("VACUUM INTO '" + strings.ReplaceAll(path, "'", "''") + "'"); err != nil {
+		return fmt.Errorf("back up database: %w", err)
+	}
+	return nil
+}
+
+// CheckSQLite checks that the file is a sound SQLite database of this
+// application, without changing it, and returns its schema version.
+func CheckSQLite(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(f, header)
+	f.Close()
+	if err != nil || !bytes.Equal(header, sqliteHeader) {
+		return 0, fmt.Errorf("%s: %w", path, ErrNotSQLite)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("check %s: %w", path, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("check %s: %s", path, result)
+	}
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, fmt.Errorf("check %s: %w", path, err)
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("check %s: no migration applied", path)
+	}
+	return version, nil
+}
+
+// RestoreSQLite replaces the database file at path with a copy of the
+// backup. Nothing may use the database meanwhile.
+func RestoreSQLite(backup, path string) error {
+	if _, err := CheckSQLite(backup); err != nil {
+		return err
+	}
+
+	src, err := os.Open(backup)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".restore-*")
+	if err != nil {
+		return fmt.Errorf("restore database: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if fi, err := os.Stat(path); err == nil {
+		tmp.Chmod(fi.Mode().Perm())
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return fmt.Errorf("restore database: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("restore database: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("restore database: %w", err)
+	}
+
+	// The write-ahead log of the replaced database must not be applied to
+	// the restored one
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("restore database: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("restore database: %w", err)
+	}
+	return nil
+}
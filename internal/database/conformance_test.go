@@ -0,0 +1,73 @@
+package database_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/toulibre/libreregistration/internal/database"
+	"github.com/toulibre/libreregistration/internal/database/storetest"
+	"github.com/toulibre/libreregistration/internal/services"
+)
+
+var (
+	_ services.UserStore         = (*database.UserStore)(nil)
+	_ services.EventStore        = (*database.EventStore)(nil)
+	_ services.RegistrationStore = (*database.RegistrationStore)(nil)
+	_ services.SessionStore      = (*database.SessionStore)(nil)
+	_ services.TagStore          = (*database.TagStore)(nil)
+	_ services.SeriesStore       = (*database.SeriesStore)(nil)
+	_ services.VenueStore        = (*database.VenueStore)(nil)
+	_ services.SettingStore      = (*database.SettingStore)(nil)
+)
+
+// stores returns the stores on the database.
+func stores(db *database.DB) storetest.Stores {
+	return storetest.Stores{
+		Users:         database.NewUserStore(db),
+		Events:        database.NewEventStore(db),
+		Registrations: database.NewRegistrationStore(db),
+		Sessions:      database.NewSessionStore(db),
+		Tags:          database.NewTagStore(db),
+		Series:        database.NewSeriesStore(db),
+		Venues:        database.NewVenueStore(db),
+		Settings:      database.NewSettingStore(db),
+	}
+}
+
+func TestSQLiteStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		db, err := database.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := database.Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+		return stores(db)
+	})
+}
+
+// TestPostgresStores runs on the database of TEST_DATABASE_URL, whose public
+// schema it empties before each test.
+func TestPostgresStores(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		db, err := database.Open("pgx", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+		return stores(db)
+	})
+}
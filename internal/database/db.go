@@ -2,12 +2,15 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 // DB wraps *sql.DB and automatically converts ? placeholders to $1, $2, ...
@@ -23,6 +26,11 @@ type Tx struct {
 	driver string
 }
 
+// execer is implemented by DB and Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 // rebind converts ? placeholders to $1, $2, ... for PostgreSQL.
 func rebind(driver, query string) string {
 	if driver == "sqlite" {
@@ -66,7 +74,14 @@ func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
 	return tx.Tx.Exec(rebind(tx.driver, query), args...)
 }
 
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRow(rebind(tx.driver, query), args...)
+}
+
 func Open(driver, dsn string) (*DB, error) {
+	if driver == "sqlite" {
+		dsn = sqlitePragmas(dsn)
+	}
 	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
@@ -74,17 +89,37 @@ func Open(driver, dsn string) (*DB, error) {
 
 	if driver == "sqlite" {
 		// Enable WAL mode for better concurrent read performance
-		if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		if err := enableWAL(db); err != nil {
 			db.Close()
 			return nil, fmt.Errorf("enable WAL mode: %w", err)
 		}
-
-		// Enable foreign keys
-		if _, err := db.Exec("PRAGMA foreign_keys=ON"); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("enable foreign keys: %w", err)
-		}
 	}
 
 	return &DB{DB: db, Driver: driver}, nil
 }
+
+// sqlitePragmas adds to a SQLite DSN the pragmas set on each connection of
+// the pool: wait for other instances opening the same file rather than fail,
+// and enforce the foreign keys.
+func sqlitePragmas(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+}
+
+// enableWAL switches the database file to WAL mode, which persists. The
+// switch fails rather than wait while another instance creates the file, so
+// it is retried for a while.
+func enableWAL(db *sql.DB) error {
+	for attempt := 0; ; attempt++ {
+		var mode string
+		err := db.QueryRow("PRAGMA journal_mode=WAL").Scan(&mode)
+		var serr *sqlite.Error
+		if err == nil || attempt == 50 || !errors.As(err, &serr) || serr.Code()&0xff != sqlite3.SQLITE_BUSY {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
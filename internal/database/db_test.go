@@ -0,0 +1,40 @@
+package database_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/toulibre/libreregistration/internal/database"
+)
+
+// TestSQLitePragmas checks that every connection of the pool has the pragmas,
+// not only the first one.
+func TestSQLitePragmas(t *testing.T) {
+	db, err := database.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	for i := range 3 {
+		// Keep the connections open, so that each is a new one
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var timeout, foreignKeys int
+		if err := conn.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&timeout); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+			t.Fatal(err)
+		}
+		if timeout != 5000 || foreignKeys != 1 {
+			t.Errorf("connection %d: busy_timeout = %d, foreign_keys = %d, want 5000 and 1", i, timeout, foreignKeys)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DumpFormat is the version of the dump layout, raised when it changes.
+const DumpFormat = 1
+
+var (
+	ErrInvalidDump   = errors.New("invalid dump")
+	ErrSchemaVersion = errors.New("dump of another schema version")
+	ErrNotEmpty      = errors.New("database not empty")
+)
+
+// columnKind is the type of the values of a column, which the drivers store
+// differently.
+type columnKind int
+
+const (
+	kindText columnKind = iota
+	kindInt
+	kindReal
+	kindBool
+	kindTime
+)
+
+type dumpColumn struct {
+	name string
+	kind columnKind
+}
+
+type dumpTable struct {
+	name    string
+	columns []dumpColumn
+}
+
+// textColumns declares text columns.
+func textColumns(names ...string) []dumpColumn {
+	columns := make([]dumpColumn, len(names))
+	for i, name := range names {
+		columns[i] = dumpColumn{name, kindText}
+	}
+	return columns
+}
+
+// column declares a column of another kind.
+func column(name string, kind columnKind) []dumpColumn {
+	return []dumpColumn{{name, kind}}
+}
+
+// dumpTables are the tables of a dump, each after those it references. The
+// search index and the tracking of the migrations are left out, as every
+// database builds its own.
+var dumpTables = []dumpTable{
+	{"users", slices.Concat(textColumns("id", "username", "name", "password_hash", "role"),
+		column("created_at", kindTime), column("updated_at", kindTime))},
+	{"settings", textColumns("key", "value")},
+	{"venues", slices.Concat(textColumns("id", "name", "slug", "address"), column("latitude", kindReal), column("longitude", kindReal),
+		textColumns("accessibility"), column("max_capacity", kindInt), column("created_at", kindTime), column("updated_at", kindTime))},
+	{"event_series", slices.Concat(textColumns("id", "title", "slug", "rule"), column("starts_at", kindTime), textColumns("exceptions"),
+		column("horizon_days", kindInt), textColumns("created_by"), column("created_at", kindTime), column("updated_at", kindTime))},
+	{"events", slices.Concat(textColumns("id", "title", "slug", "description", "location"),
+		column("event_date", kindTime), column("end_date", kindTime), column("registration_deadline", kindTime),
+		column("max_capacity", kindInt), column("attendee_list_public", kindBool), column("registration_open", kindBool),
+		textColumns("image_path", "banner_path"), column("latitude", kindReal), column("longitude", kindReal),
+		textColumns("duplicate_policy"), column("approval_required", kindBool), column("max_companions", kindInt), textColumns("status"),
+		column("publish_at", kindTime), column("registration_opens_at", kindTime), column("registrations_opened_at", kindTime),
+		textColumns("preview_token", "series_id", "occurrence_date", "venue_id", "created_by"),
+		column("created_at", kindTime), column("updated_at", kindTime))},
+	{"tags", textColumns("id", "name", "slug")},
+	{"event_tags", textColumns("event_id", "tag_id")},
+	{"registrations", slices.Concat(textColumns("id", "event_id", "name", "email", "comment", "cancel_token", "status"),
+		column("seats", kindInt), column("registered_at", kindTime), column("resent_at", kindTime))},
+	{"companions", slices.Concat(textColumns("id", "registration_id", "name"), column("position", kindInt))},
+	{"sessions", slices.Concat(textColumns("id", "event_id", "title", "speaker", "room", "description"),
+		column("starts_at", kindTime), column("ends_at", kindTime), column("max_capacity", kindInt), column("created_at", kindTime))},
+	{"session_registrations", textColumns("session_id", "registration_id")},
+	{"cancellations", slices.Concat(textColumns("registration_id", "event_id", "email"), column("seats", kindInt),
+		column("registered_at", kindTime), column("cancelled_at", kindTime))},
+}
+
+// generatedColumns are computed by the database, and left out of dumps.
+var generatedColumns = map[string]bool{"search": true}
+
+// DumpHeader is the first line of a dump.
+type DumpHeader struct {
+	Format        int               `json:"format"`
+	SchemaVersion int               `json:"schema_version"`
+	Driver        string            `json:"driver"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Tables        []DumpTableHeader `json:"tables"`
+}
+
+// DumpTableHeader describes the rows of a table in a dump.
+type DumpTableHeader struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows"`
+}
+
+// dumpRow is a line of a dump after the header.
+type dumpRow struct {
+	Table string            `json:"table"`
+	Row   []json.RawMessage `json:"row"`
+}
+
+// Dump writes the content of the database as JSON lines: a header with the
+// schema version and the number of rows of each table, and then a line per
+// row. The rows are read from a single snapshot, and the dump can be loaded
+// into a database of either driver.
+func Dump(ctx context.Context, db *DB, w io.Writer) (*DumpHeader, error) {
+	opts := &sql.TxOptions{ReadOnly: true}
+	if db.Driver != "sqlite" {
+		opts.Isolation = sql.LevelRepeatableRead
+	}
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("begin dump: %w", err)
+	}
+	defer tx.Rollback()
+
+	h := &DumpHeader{Format: DumpFormat, Driver: db.Driver, CreatedAt: time.Now().UTC()}
+	if h.SchemaVersion, err = schemaVersion(tx); err != nil {
+		return nil, err
+	}
+	for _, t := range dumpTables {
+		if err := checkColumns(tx, t); err != nil {
+			return nil, err
+		}
+		th := DumpTableHeader{Name: t.name}
+		for _, c := range t.columns {
+			th.Columns = append(th.Columns, c.name)
+		}
+		if err := tx.QueryRow("SELECT COUNT(*) FROM " + t.name).Scan(&th.Rows); err != nil {
+			return nil, fmt.Errorf("count %s: %w", t.name, err)
+		}
+		h.Tables = append(h.Tables, th)
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(h); err != nil {
+		return nil, fmt.Errorf("write dump: %w", err)
+	}
+	for _, t := range dumpTables {
+		if err := dumpRows(tx, t, enc); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// checkColumns checks that the dump covers every column of the table, so
+// that a column added by a migration is not silently left out.
+func checkColumns(tx *sql.Tx, t dumpTable) error {
+	rows, err := tx.Query("SELECT * FROM " + t.name + " WHERE 1 = 0")
+	if err != nil {
+		return fmt.Errorf("read columns of %s: %w", t.name, err)
+	}
+	names, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("read columns of %s: %w", t.name, err)
+	}
+	for _, name := range names {
+		known := slices.ContainsFunc(t.columns, func(c dumpColumn) bool { return c.name == name })
+		if !known && !generatedColumns[name] {
+			return fmt.Errorf("dump %s: column %s unknown to the dump", t.name, name)
+		}
+	}
+	return nil
+}
+
+func dumpRows(tx *sql.Tx, t dumpTable, enc *json.Encoder) error {
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = c.name
+	}
+	// Order by the first column, the primary key or its start
+	rows, err := tx.Query("SELECT " + strings.Join(names, ", ") + " FROM " + t.name + " ORDER BY " + strings.Join(names[:primaryKeyColumns(t)], ", "))
+	if err != nil {
+		return fmt.Errorf("dump %s: %w", t.name, err)
+	}
+	defer rows.Close()
+
+	values := make([]any, len(t.columns))
+	for i, c := range t.columns {
+		values[i] = scanTarget(c.kind)
+	}
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return fmt.Errorf("dump %s: %w", t.name, err)
+		}
+		row := dumpRow{Table: t.name, Row: make([]json.RawMessage, len(values))}
+		for i, v := range values {
+			b, err := json.Marshal(jsonValue(v))
+			if err != nil {
+				return fmt.Errorf("dump %s: %w", t.name, err)
+			}
+			row.Row[i] = b
+		}
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("write dump: %w", err)
+		}
+	}
+	return rows.Err()
+}
+
+// primaryKeyColumns returns the number of leading columns making up the
+// primary key of the table.
+func primaryKeyColumns(t dumpTable) int {
+	switch t.name {
+	case "event_tags", "session_registrations":
+		return 2
+	}
+	return 1
+}
+
+func scanTarget(kind columnKind) any {
+	switch kind {
+	case kindInt:
+		return new(sql.NullInt64)
+	case kindReal:
+		return new(sql.NullFloat64)
+	case kindBool:
+		return new(sql.NullBool)
+	case kindTime:
+		return new(sql.NullTime)
+	}
+	return new(sql.NullString)
+}
+
+// jsonValue returns the value scanned into a target of scanTarget, nil for
+// NULL.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case *sql.NullInt64:
+		if v.Valid {
+			return v.Int64
+		}
+	case *sql.NullFloat64:
+		if v.Valid {
+			return v.Float64
+		}
+	case *sql.NullBool:
+		if v.Valid {
+			return v.Bool
+		}
+	case *sql.NullTime:
+		if v.Valid {
+			return v.Time.Format(time.RFC3339Nano)
+		}
+	case *sql.NullString:
+		if v.Valid {
+			return v.String
+		}
+	}
+	return nil
+}
+
+// sqlValue converts a JSON value of a dump to the value of the column.
+func sqlValue(kind columnKind, raw json.RawMessage) (any, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	switch kind {
+	case kindInt:
+		var n int64
+		err := json.Unmarshal(raw, &n)
+		return n, err
+	case kindReal:
+		var f float64
+		err := json.Unmarshal(raw, &f)
+		return f, err
+	case kindBool:
+		var b bool
+		err := json.Unmarshal(raw, &b)
+		return b, err
+	case kindTime:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	var s string
+	err := json.Unmarshal(raw, &s)
+	return s, err
+}
+
+// Load copies the rows of a dump into the database, in a single
+// transaction. The database must be migrated to the schema version of the
+// dump and hold no data but the default settings, which are replaced. The
+// number of rows of each table is checked before committing.
+func Load(ctx context.Context, db *DB, r io.Reader) (*DumpHeader, error) {
+	dec := json.NewDecoder(r)
+	var h DumpHeader
+	if err := dec.Decode(&h); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	if h.Format != DumpFormat {
+		return nil, fmt.Errorf("%w: format %d", ErrInvalidDump, h.Format)
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if h.SchemaVersion != version {
+		return nil, fmt.Errorf("%w: dump at version %d, database at %d", ErrSchemaVersion, h.SchemaVersion, version)
+	}
+	tables, err := loadTables(&h)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin load: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range dumpTables {
+		if t.name == "settings" {
+			if _, err := tx.Exec("DELETE FROM settings"); err != nil {
+				return nil, fmt.Errorf("clear settings: %w", err)
+			}
+			continue
+		}
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM " + t.name).Scan(&n); err != nil {
+			return nil, fmt.Errorf("count %s: %w", t.name, err)
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("%w: %d row(s) in %s", ErrNotEmpty, n, t.name)
+		}
+	}
+
+	inserts := make(map[string]string)
+	for _, t := range dumpTables {
+		names := make([]string, len(t.columns))
+		for i, c := range t.columns {
+			names[i] = c.name
+		}
+		inserts[t.name] = "INSERT INTO " + t.name + " (" + strings.Join(names, ", ") + ") VALUES (?" + strings.Repeat(", ?", len(names)-1) + ")"
+	}
+
+	read := make(map[string]int)
+	for {
+		var row dumpRow
+		err := dec.Decode(&row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		t, ok := tables[row.Table]
+		if !ok || len(row.Row) != len(t.columns) {
+			return nil, fmt.Errorf("%w: invalid row of %q", ErrInvalidDump, row.Table)
+		}
+		args := make([]any, len(row.Row))
+		for i, raw := range row.Row {
+			if args[i], err = sqlValue(t.columns[i].kind, raw); err != nil {
+				return nil, fmt.Errorf("%w: %s.%s: %v", ErrInvalidDump, t.name, t.columns[i].name, err)
+			}
+		}
+		if _, err := tx.Exec(inserts[t.name], args...); err != nil {
+			return nil, fmt.Errorf("load %s: %w", t.name, err)
+		}
+		read[t.name]++
+	}
+
+	for _, th := range h.Tables {
+		if read[th.Name] != th.Rows {
+			return nil, fmt.Errorf("%w: %d row(s) of %s, %d expected", ErrInvalidDump, read[th.Name], th.Name, th.Rows)
+		}
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM " + th.Name).Scan(&n); err != nil {
+			return nil, fmt.Errorf("count %s: %w", th.Name, err)
+		}
+		if n != th.Rows {
+			return nil, fmt.Errorf("load %s: %d row(s) in the database, %d in the dump", th.Name, n, th.Rows)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit load: %w", err)
+	}
+	return &h, nil
+}
+
+// loadTables checks that the tables of the header are those of this build,
+// with the same columns, and maps them by name.
+func loadTables(h *DumpHeader) (map[string]dumpTable, error) {
+	if len(h.Tables) != len(dumpTables) {
+		return nil, fmt.Errorf("%w: %d tables, %d expected", ErrInvalidDump, len(h.Tables), len(dumpTables))
+	}
+	tables := make(map[string]dumpTable)
+	for i, th := range h.Tables {
+		t := dumpTables[i]
+		if th.Name != t.name || len(th.Columns) != len(t.columns) {
+			return nil, fmt.Errorf("%w: unexpected table %s", ErrInvalidDump, th.Name)
+		}
+		for j, c := range t.columns {
+			if th.Columns[j] != c.name {
+				return nil, fmt.Errorf("%w: unexpected column %s.%s", ErrInvalidDump, th.Name, th.Columns[j])
+			}
+		}
+		tables[t.name] = t
+	}
+	return tables, nil
+}
@@ -2,7 +2,9 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/toulibre/libreregistration/internal/models"
@@ -16,17 +18,41 @@ func NewEventStore(db *DB) *EventStore {
 	return &EventStore{db: db}
 }
 
+// eventSeats is the number of seats taken at an event.
+const eventSeats = "(SELECT COALESCE(SUM(seats), 0) FROM registrations WHERE event_id = e.id AND status = 'confirmed')"
+
+const eventColumns = `e.id, e.title, e.slug, e.description, e.location, e.event_date, e.end_date,
+		e.registration_deadline, e.max_capacity, e.attendee_list_public, e.registration_open,
+		e.image_path, e.banner_path, e.latitude, e.longitude, e.duplicate_policy, e.approval_required,
+		e.max_companions, e.status, e.publish_at, e.registration_opens_at, e.registrations_opened_at, e.preview_token, e.series_id, e.occurrence_date,
+		e.venue_id, e.created_by, e.created_at, e.updated_at,
+		` + eventSeats + `,
+		(SELECT COUNT(*) FROM registrations WHERE event_id = e.id AND status = 'pending'),
+		COALESCE((SELECT slug FROM event_series WHERE id = e.series_id), ''),
+		COALESCE((SELECT name FROM venues WHERE id = e.venue_id), ''),
+		COALESCE((SELECT slug FROM venues WHERE id = e.venue_id), '')`
+
+// eventSorts maps the sort keys of EventFilter to their expressions.
+var eventSorts = map[string]string{
+	"title":         "LOWER(e.title)",
+	"date":          "e.event_date",
+	"registrations": eventSeats,
+	"status":        "e.status",
+}
+
 func (s *EventStore) Create(e *models.Event) error {
 	_, err := s.db.Exec(`INSERT INTO events
-		(id, title, slug, description, location, event_date, registration_deadline, max_capacity,
+		(id, title, slug, description, location, event_date, end_date, registration_deadline, max_capacity,
 		 attendee_list_public, registration_open, image_path, banner_path, latitude, longitude,
-		 created_by, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		e.ID, e.Title, e.Slug, e.Description, e.Location, e.EventDate,
+		 duplicate_policy, approval_required, max_companions, status, publish_at, registration_opens_at,
+		 registrations_opened_at, preview_token, series_id, occurrence_date, venue_id, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.Title, e.Slug, e.Description, e.Location, e.EventDate, e.EndDate,
 		e.RegistrationDeadline, e.MaxCapacity,
 		e.AttendeeListPublic, e.RegistrationOpen,
 		e.ImagePath, e.BannerPath, e.Latitude, e.Longitude,
-		e.CreatedBy, e.CreatedAt, e.UpdatedAt,
+		e.DuplicatePolicy, e.ApprovalRequired, e.MaxCompanions, e.Status, e.PublishAt, e.RegistrationOpensAt,
+		e.RegistrationsOpenedAt, e.PreviewToken, e.SeriesID, e.OccurrenceDate, e.VenueID, e.CreatedBy, e.CreatedAt, e.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("create event: %w", err)
@@ -36,17 +62,19 @@ func (s *EventStore) Create(e *models.Event) error {
 
 func (s *EventStore) Update(e *models.Event) error {
 	_, err := s.db.Exec(`UPDATE events SET
-		title = ?, slug = ?, description = ?, location = ?, event_date = ?,
+		title = ?, slug = ?, description = ?, location = ?, event_date = ?, end_date = ?,
 		registration_deadline = ?, max_capacity = ?,
 		attendee_list_public = ?, registration_open = ?,
 		image_path = ?, banner_path = ?, latitude = ?, longitude = ?,
-		updated_at = ?
+		duplicate_policy = ?, approval_required = ?, max_companions = ?, status = ?, publish_at = ?,
+		registration_opens_at = ?, registrations_opened_at = ?, preview_token = ?, series_id = ?, occurrence_date = ?, venue_id = ?, updated_at = ?
 		WHERE id = ?`,
-		e.Title, e.Slug, e.Description, e.Location, e.EventDate,
+		e.Title, e.Slug, e.Description, e.Location, e.EventDate, e.EndDate,
 		e.RegistrationDeadline, e.MaxCapacity,
 		e.AttendeeListPublic, e.RegistrationOpen,
 		e.ImagePath, e.BannerPath, e.Latitude, e.Longitude,
-		e.UpdatedAt, e.ID,
+		e.DuplicatePolicy, e.ApprovalRequired, e.MaxCompanions, e.Status, e.PublishAt,
+		e.RegistrationOpensAt, e.RegistrationsOpenedAt, e.PreviewToken, e.SeriesID, e.OccurrenceDate, e.VenueID, e.UpdatedAt, e.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("update event: %w", err)
@@ -55,21 +83,11 @@ func (s *EventStore) Update(e *models.Event) error {
 }
 
 func (s *EventStore) GetByID(id string) (*models.Event, error) {
-	return s.scanEvent(s.db.QueryRow(`SELECT e.id, e.title, e.slug, e.description, e.location, e.event_date,
-		e.registration_deadline, e.max_capacity, e.attendee_list_public, e.registration_open,
-		e.image_path, e.banner_path, e.latitude, e.longitude,
-		e.created_by, e.created_at, e.updated_at,
-		(SELECT COUNT(*) FROM registrations WHERE event_id = e.id)
-		FROM events e WHERE e.id = ?`, id))
+	return s.scanEvent(s.db.QueryRow("SELECT "+eventColumns+" FROM events e WHERE e.id = ?", id))
 }
 
 func (s *EventStore) GetBySlug(slug string) (*models.Event, error) {
-	return s.scanEvent(s.db.QueryRow(`SELECT e.id, e.title, e.slug, e.description, e.location, e.event_date,
-		e.registration_deadline, e.max_capacity, e.attendee_list_public, e.registration_open,
-		e.image_path, e.banner_path, e.latitude, e.longitude,
-		e.created_by, e.created_at, e.updated_at,
-		(SELECT COUNT(*) FROM registrations WHERE event_id = e.id)
-		FROM events e WHERE e.slug = ?`, slug))
+	return s.scanEvent(s.db.QueryRow("SELECT "+eventColumns+" FROM events e WHERE e.slug = ?", slug))
 }
 
 func (s *EventStore) SlugExists(slug string) (bool, error) {
@@ -78,20 +96,190 @@ func (s *EventStore) SlugExists(slug string) (bool, error) {
 	return count > 0, err
 }
 
+// eventEnd is when an event ends, as models.Event.End: multi-day events still
+// running are to come.
+const eventEnd = "COALESCE(e.end_date, e.event_date)"
+
+// ListUpcoming returns the published events to come, soonest first.
 func (s *EventStore) ListUpcoming() ([]models.Event, error) {
-	return s.listEvents("WHERE e.event_date >= ? AND e.registration_open = true ORDER BY e.event_date ASC", time.Now())
+	return s.listEvents("WHERE "+eventEnd+" >= ? AND e.status = ? ORDER BY e.event_date ASC", time.Now(), models.EventPublished)
+}
+
+// ListUpcomingByTag returns the published events to come with the tag,
+// soonest first.
+func (s *EventStore) ListUpcomingByTag(tagID string) ([]models.Event, error) {
+	return s.listEvents(`WHERE `+eventEnd+` >= ? AND e.status = ?
+		AND EXISTS (SELECT 1 FROM event_tags et WHERE et.event_id = e.id AND et.tag_id = ?)
+		ORDER BY e.event_date ASC`, time.Now(), models.EventPublished, tagID)
+}
+
+// ListUpcomingByVenue returns the published events to come at the venue,
+// soonest first.
+func (s *EventStore) ListUpcomingByVenue(venueID string) ([]models.Event, error) {
+	return s.listEvents("WHERE e.venue_id = ? AND "+eventEnd+" >= ? AND e.status = ? ORDER BY e.event_date ASC",
+		venueID, time.Now(), models.EventPublished)
+}
+
+// ListBySeries returns the occurrences of a series, oldest first.
+func (s *EventStore) ListBySeries(seriesID string) ([]models.Event, error) {
+	return s.listEvents("WHERE e.series_id = ? ORDER BY e.event_date ASC", seriesID)
+}
+
+// ListUpcomingBySeries returns the published occurrences to come of a
+// series, soonest first.
+func (s *EventStore) ListUpcomingBySeries(seriesID string) ([]models.Event, error) {
+	return s.listEvents("WHERE e.series_id = ? AND "+eventEnd+" >= ? AND e.status = ? ORDER BY e.event_date ASC",
+		seriesID, time.Now(), models.EventPublished)
+}
+
+// ListBetween returns the events taking place in [from, to), oldest first.
+func (s *EventStore) ListBetween(from, to time.Time) ([]models.Event, error) {
+	return s.listEvents("WHERE e.event_date >= ? AND e.event_date < ? ORDER BY e.event_date ASC", from, to)
+}
+
+// ListEndedBefore returns the events ended before the time, ongoing events
+// left out, oldest first.
+func (s *EventStore) ListEndedBefore(t time.Time) ([]models.Event, error) {
+	return s.listEvents("WHERE COALESCE(e.end_date, e.event_date) < ? ORDER BY e.event_date ASC", t)
 }
 
 func (s *EventStore) ListAll() ([]models.Event, error) {
 	return s.listEvents("ORDER BY e.event_date DESC")
 }
 
+// ListPage returns a page of the events selected by the filter, and the
+// number of selected events.
+func (s *EventStore) ListPage(f models.EventFilter, page models.Page) ([]models.Event, int, error) {
+	var join, rank string
+	var conds []string
+	var args []any
+	if f.Query != "" {
+		terms := searchTerms(f.Query)
+		if len(terms) == 0 {
+			return nil, 0, nil
+		}
+		var match string
+		join, match, rank = s.db.fullText("events", "e", "event_id")
+		conds = append(conds, match)
+		args = append(args, s.db.matchQuery(terms))
+	}
+	if len(f.Statuses) > 0 {
+		conds = append(conds, "e.status IN (?"+strings.Repeat(", ?", len(f.Statuses)-1)+")")
+		for _, st := range f.Statuses {
+			args = append(args, st)
+		}
+	}
+	if f.Upcoming != nil {
+		if *f.Upcoming {
+			conds = append(conds, eventEnd+" >= ?")
+		} else {
+			conds = append(conds, eventEnd+" < ?")
+		}
+		args = append(args, time.Now())
+	}
+	if f.Open != nil {
+		conds = append(conds, "e.registration_open = ?")
+		args = append(args, *f.Open)
+	}
+	if f.CreatedBy != "" {
+		conds = append(conds, "e.created_by = ?")
+		args = append(args, f.CreatedBy)
+	}
+	if f.From != nil {
+		conds = append(conds, "e.event_date >= ?")
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		conds = append(conds, "e.event_date < ?")
+		args = append(args, *f.To)
+	}
+	where := join
+	if len(conds) > 0 {
+		where += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM events e "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count events: %w", err)
+	}
+
+	order := "e.event_date DESC"
+	if col, ok := eventSorts[f.Sort]; ok {
+		order = col + " ASC"
+		if f.Desc {
+			order = col + " DESC"
+		}
+		order += ", e.event_date DESC"
+	} else if rank != "" {
+		order = rank + ", e.event_date DESC"
+	}
+	events, err := s.listEvents(where+" ORDER BY "+order+", e.id LIMIT ? OFFSET ?",
+		append(args, page.Size, page.Offset())...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// PublishDue publishes the drafts whose publication time has come, and
+// returns how many were published.
+func (s *EventStore) PublishDue(now time.Time) (int64, error) {
+	res, err := s.db.Exec(`UPDATE events SET status = ?, publish_at = NULL, updated_at = ?
+		WHERE status = ? AND publish_at IS NOT NULL AND publish_at <= ?`,
+		models.EventPublished, now, models.EventDraft, now)
+	if err != nil {
+		return 0, fmt.Errorf("publish events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// OpenRegistrationsDue opens the registrations whose opening time has come,
+// and returns how many were opened.
+func (s *EventStore) OpenRegistrationsDue(now time.Time) (int64, error) {
+	res, err := s.db.Exec(`UPDATE events SET registration_open = true, registration_opens_at = NULL,
+		registrations_opened_at = COALESCE(registrations_opened_at, ?), updated_at = ?
+		WHERE registration_opens_at IS NOT NULL AND registration_opens_at <= ?`,
+		now, now, now)
+	if err != nil {
+		return 0, fmt.Errorf("open registrations: %w", err)
+	}
+	return res.RowsAffected()
+}
+
 func (s *EventStore) Delete(id string) error {
-	_, err := s.db.Exec("DELETE FROM events WHERE id = ?", id)
+	tx, err := s.db.Begin()
 	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM event_tags WHERE event_id = ?", id); err != nil {
+		return fmt.Errorf("untag event: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM cancellations WHERE event_id = ?", id); err != nil {
+		return fmt.Errorf("delete cancellations: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM session_registrations WHERE session_id IN (SELECT id FROM sessions WHERE event_id = ?)", id); err != nil {
+		return fmt.Errorf("delete session registrations: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE event_id = ?", id); err != nil {
+		return fmt.Errorf("delete sessions: %w", err)
+	}
+	if err := deleteRegistrations(tx, "event_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM events WHERE id = ?", id); err != nil {
 		return fmt.Errorf("delete event: %w", err)
 	}
-	return nil
+	return tx.Commit()
+}
+
+// UploadInUse reports whether an event uses the uploaded file as its image or
+// banner. Clones and occurrences of a series share their files.
+func (s *EventStore) UploadInUse(filename string) (bool, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM events WHERE image_path = ? OR banner_path = ?", filename, filename).Scan(&count)
+	return count > 0, err
 }
 
 func (s *EventStore) Count() (int, error) {
@@ -102,17 +290,12 @@ func (s *EventStore) Count() (int, error) {
 
 func (s *EventStore) CountUpcoming() (int, error) {
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM events WHERE event_date >= ?", time.Now()).Scan(&count)
+	err := s.db.QueryRow("SELECT COUNT(*) FROM events e WHERE "+eventEnd+" >= ?", time.Now()).Scan(&count)
 	return count, err
 }
 
 func (s *EventStore) listEvents(where string, args ...interface{}) ([]models.Event, error) {
-	query := fmt.Sprintf(`SELECT e.id, e.title, e.slug, e.description, e.location, e.event_date,
-		e.registration_deadline, e.max_capacity, e.attendee_list_public, e.registration_open,
-		e.image_path, e.banner_path, e.latitude, e.longitude,
-		e.created_by, e.created_at, e.updated_at,
-		(SELECT COUNT(*) FROM registrations WHERE event_id = e.id)
-		FROM events e %s`, where)
+	query := "SELECT " + eventColumns + " FROM events e " + where
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
@@ -137,7 +320,7 @@ type scanner interface {
 
 func (s *EventStore) scanEvent(row *sql.Row) (*models.Event, error) {
 	e, err := s.scanEventRow(row)
-	if err == sql.ErrNoRows {
+	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	return e, err
@@ -146,10 +329,12 @@ func (s *EventStore) scanEvent(row *sql.Row) (*models.Event, error) {
 func (s *EventStore) scanEventRow(row scanner) (*models.Event, error) {
 	var e models.Event
 	err := row.Scan(
-		&e.ID, &e.Title, &e.Slug, &e.Description, &e.Location, &e.EventDate,
+		&e.ID, &e.Title, &e.Slug, &e.Description, &e.Location, &e.EventDate, &e.EndDate,
 		&e.RegistrationDeadline, &e.MaxCapacity, &e.AttendeeListPublic, &e.RegistrationOpen,
-		&e.ImagePath, &e.BannerPath, &e.Latitude, &e.Longitude,
-		&e.CreatedBy, &e.CreatedAt, &e.UpdatedAt, &e.RegistrationCount,
+		&e.ImagePath, &e.BannerPath, &e.Latitude, &e.Longitude, &e.DuplicatePolicy, &e.ApprovalRequired,
+		&e.MaxCompanions, &e.Status, &e.PublishAt, &e.RegistrationOpensAt, &e.RegistrationsOpenedAt, &e.PreviewToken, &e.SeriesID, &e.OccurrenceDate,
+		&e.VenueID, &e.CreatedBy, &e.CreatedAt, &e.UpdatedAt, &e.RegistrationCount, &e.PendingCount, &e.SeriesSlug,
+		&e.VenueName, &e.VenueSlug,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("scan event: %w", err)
@@ -0,0 +1,388 @@
+package memory
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type EventStore struct {
+	db *DB
+}
+
+func NewEventStore(db *DB) *EventStore {
+	return &EventStore{db: db}
+}
+
+// storedEvent returns the event without its fields the database does not
+// store.
+func storedEvent(e models.Event) models.Event {
+	e.DescriptionHTML = ""
+	e.Venue = nil
+	e.Tags = nil
+	e.Sessions = nil
+	e.RegistrationCount = 0
+	e.PendingCount = 0
+	e.SeriesSlug = ""
+	e.VenueName = ""
+	e.VenueSlug = ""
+	return e
+}
+
+// eventSeats returns the number of seats taken at an event.
+func (db *DB) eventSeats(eventID string) int {
+	seats := 0
+	for _, r := range db.registrations {
+		if r.EventID == eventID && r.Status == models.StatusConfirmed {
+			seats += r.Seats
+		}
+	}
+	return seats
+}
+
+// loadEvent fills in the computed fields of an event, as listed by the
+// database.
+func (db *DB) loadEvent(e models.Event) models.Event {
+	e.RegistrationCount = db.eventSeats(e.ID)
+	for _, r := range db.registrations {
+		if r.EventID == e.ID && r.Status == models.StatusPending {
+			e.PendingCount++
+		}
+	}
+	if e.SeriesID != nil {
+		e.SeriesSlug = db.series[*e.SeriesID].Slug
+	}
+	if e.VenueID != nil {
+		e.VenueName = db.venues[*e.VenueID].Name
+		e.VenueSlug = db.venues[*e.VenueID].Slug
+	}
+	return e
+}
+
+// listEvents returns the events selected by keep, soonest first, or latest
+// first when desc.
+func (db *DB) listEvents(keep func(e *models.Event) bool, desc bool) []models.Event {
+	var events []models.Event
+	for _, e := range db.events {
+		if keep(&e) {
+			events = append(events, db.loadEvent(e))
+		}
+	}
+	slices.SortFunc(events, func(a, b models.Event) int {
+		if c := a.EventDate.Compare(b.EventDate); c != 0 {
+			if desc {
+				return -c
+			}
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return events
+}
+
+// upcoming reports whether the event is published and to come, or still
+// running.
+func upcoming(e *models.Event, now time.Time) bool {
+	return notBefore(e.End(), now) && e.Status == models.EventPublished
+}
+
+// checkEventUnique checks the unique constraints of the events table.
+func (db *DB) checkEventUnique(e *models.Event) error {
+	for _, other := range db.events {
+		if other.ID == e.ID {
+			continue
+		}
+		if other.Slug == e.Slug {
+			return errUnique
+		}
+		if e.SeriesID != nil && other.SeriesID != nil && *e.SeriesID == *other.SeriesID && e.OccurrenceDate == other.OccurrenceDate {
+			return errUnique
+		}
+	}
+	return nil
+}
+
+func (s *EventStore) Create(e *models.Event) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.events[e.ID]; ok {
+		return fmt.Errorf("create event: %w", errUnique)
+	}
+	if err := s.db.checkEventUnique(e); err != nil {
+		return fmt.Errorf("create event: %w", err)
+	}
+	s.db.events[e.ID] = storedEvent(*e)
+	return nil
+}
+
+func (s *EventStore) Update(e *models.Event) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	old, ok := s.db.events[e.ID]
+	if !ok {
+		return nil
+	}
+	if err := s.db.checkEventUnique(e); err != nil {
+		return fmt.Errorf("update event: %w", err)
+	}
+	updated := storedEvent(*e)
+	updated.CreatedBy = old.CreatedBy
+	updated.CreatedAt = old.CreatedAt
+	s.db.events[e.ID] = updated
+	return nil
+}
+
+func (s *EventStore) GetByID(id string) (*models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if e, ok := s.db.events[id]; ok {
+		e = s.db.loadEvent(e)
+		return &e, nil
+	}
+	return nil, nil
+}
+
+func (s *EventStore) GetBySlug(slug string) (*models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, e := range s.db.events {
+		if e.Slug == slug {
+			e = s.db.loadEvent(e)
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *EventStore) SlugExists(slug string) (bool, error) {
+	e, err := s.GetBySlug(slug)
+	return e != nil, err
+}
+
+// ListUpcoming returns the published events to come, soonest first.
+func (s *EventStore) ListUpcoming() ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	return s.db.listEvents(func(e *models.Event) bool { return upcoming(e, now) }, false), nil
+}
+
+// ListUpcomingByTag returns the published events to come with the tag,
+// soonest first.
+func (s *EventStore) ListUpcomingByTag(tagID string) ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	return s.db.listEvents(func(e *models.Event) bool {
+		return upcoming(e, now) && slices.Contains(s.db.eventTags[e.ID], tagID)
+	}, false), nil
+}
+
+// ListUpcomingByVenue returns the published events to come at the venue,
+// soonest first.
+func (s *EventStore) ListUpcomingByVenue(venueID string) ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	return s.db.listEvents(func(e *models.Event) bool {
+		return upcoming(e, now) && e.VenueID != nil && *e.VenueID == venueID
+	}, false), nil
+}
+
+// ListBySeries returns the occurrences of a series, oldest first.
+func (s *EventStore) ListBySeries(seriesID string) ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.listEvents(func(e *models.Event) bool {
+		return e.SeriesID != nil && *e.SeriesID == seriesID
+	}, false), nil
+}
+
+// ListUpcomingBySeries returns the published occurrences to come of a
+// series, soonest first.
+func (s *EventStore) ListUpcomingBySeries(seriesID string) ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	return s.db.listEvents(func(e *models.Event) bool {
+		return upcoming(e, now) && e.SeriesID != nil && *e.SeriesID == seriesID
+	}, false), nil
+}
+
+// ListBetween returns the events taking place in [from, to), oldest first.
+func (s *EventStore) ListBetween(from, to time.Time) ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.listEvents(func(e *models.Event) bool {
+		return notBefore(e.EventDate, from) && e.EventDate.Before(to)
+	}, false), nil
+}
+
+// ListEndedBefore returns the events ended before the time, ongoing events
+// left out, oldest first.
+func (s *EventStore) ListEndedBefore(t time.Time) ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.listEvents(func(e *models.Event) bool {
+		end := e.EventDate
+		if e.EndDate != nil {
+			end = *e.EndDate
+		}
+		return end.Before(t)
+	}, false), nil
+}
+
+func (s *EventStore) ListAll() ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.listEvents(func(*models.Event) bool { return true }, true), nil
+}
+
+// eventSorts maps the sort keys of EventFilter to their comparisons.
+var eventSorts = map[string]func(a, b *models.Event) int{
+	"title": func(a, b *models.Event) int {
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	},
+	"date": func(a, b *models.Event) int { return a.EventDate.Compare(b.EventDate) },
+	"registrations": func(a, b *models.Event) int {
+		return cmp.Compare(a.RegistrationCount, b.RegistrationCount)
+	},
+	"status": func(a, b *models.Event) int { return strings.Compare(string(a.Status), string(b.Status)) },
+}
+
+// ListPage returns a page of the events selected by the filter, and the
+// number of selected events. Matches of a search come latest first.
+func (s *EventStore) ListPage(f models.EventFilter, p models.Page) ([]models.Event, int, error) {
+	var terms []string
+	if f.Query != "" {
+		if terms = searchTerms(f.Query); len(terms) == 0 {
+			return nil, 0, nil
+		}
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	events := s.db.listEvents(func(e *models.Event) bool {
+		switch {
+		case terms != nil && !matches(terms, e.Title, e.Description, e.Location),
+			len(f.Statuses) > 0 && !slices.Contains(f.Statuses, e.Status),
+			f.Upcoming != nil && notBefore(e.End(), now) != *f.Upcoming,
+			f.Open != nil && e.RegistrationOpen != *f.Open,
+			f.CreatedBy != "" && e.CreatedBy != f.CreatedBy,
+			f.From != nil && e.EventDate.Before(*f.From),
+			f.To != nil && notBefore(e.EventDate, *f.To):
+			return false
+		}
+		return true
+	}, true)
+
+	if compare, ok := eventSorts[f.Sort]; ok {
+		slices.SortStableFunc(events, func(a, b models.Event) int {
+			if f.Desc {
+				return compare(&b, &a)
+			}
+			return compare(&a, &b)
+		})
+	}
+	return page(events, p), len(events), nil
+}
+
+// PublishDue publishes the drafts whose publication time has come, and
+// returns how many were published.
+func (s *EventStore) PublishDue(now time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var n int64
+	for id, e := range s.db.events {
+		if e.Status == models.EventDraft && e.PublishAt != nil && !e.PublishAt.After(now) {
+			e.Status = models.EventPublished
+			e.PublishAt = nil
+			e.UpdatedAt = now
+			s.db.events[id] = e
+			n++
+		}
+	}
+	return n, nil
+}
+
+// OpenRegistrationsDue opens the registrations whose opening time has come,
+// and returns how many were opened.
+func (s *EventStore) OpenRegistrationsDue(now time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var n int64
+	for id, e := range s.db.events {
+		if e.RegistrationOpensAt != nil && !e.RegistrationOpensAt.After(now) {
+			e.RegistrationOpen = true
+			e.RegistrationOpensAt = nil
+			if e.RegistrationsOpenedAt == nil {
+				e.RegistrationsOpenedAt = &now
+			}
+			e.UpdatedAt = now
+			s.db.events[id] = e
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Delete deletes an event, its registrations, sessions and cancellations.
+func (s *EventStore) Delete(id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.eventTags, id)
+	for regID, c := range s.db.cancellations {
+		if c.EventID == id {
+			delete(s.db.cancellations, regID)
+		}
+	}
+	for sessionID, se := range s.db.sessions {
+		if se.EventID == id {
+			s.db.deleteSession(sessionID)
+		}
+	}
+	for regID, r := range s.db.registrations {
+		if r.EventID == id {
+			delete(s.db.registrations, regID)
+		}
+	}
+	delete(s.db.events, id)
+	return nil
+}
+
+// UploadInUse reports whether an event uses the uploaded file as its image or
+// banner.
+func (s *EventStore) UploadInUse(filename string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, e := range s.db.events {
+		if e.ImagePath == filename || e.BannerPath == filename {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *EventStore) Count() (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return len(s.db.events), nil
+}
+
+func (s *EventStore) CountUpcoming() (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	count := 0
+	for _, e := range s.db.events {
+		if notBefore(e.End(), now) {
+			count++
+		}
+	}
+	return count, nil
+}
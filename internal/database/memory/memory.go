@@ -0,0 +1,89 @@
+// Package memory implements the stores of the services in memory, to test
+// them without a database. The stores behave as those of package database,
+// which package database/storetest checks, except that searches do not rank
+// their results.
+package memory
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+// errUnique is returned when a row would break a unique constraint of the
+// database schema.
+var errUnique = errors.New("unique constraint failed")
+
+// DB holds the data of the stores created on it, which they share as the
+// tables of a database.
+type DB struct {
+	mu            sync.Mutex
+	users         map[string]models.User
+	events        map[string]models.Event
+	registrations map[string]models.Registration // with their companions and sessions
+	cancellations map[string]models.Cancellation // by registration ID
+	resentAt      map[string]time.Time           // last confirmation resent, by registration ID
+	sessions      map[string]models.Session
+	tags          map[string]models.Tag
+	eventTags     map[string][]string // tag IDs by event ID
+	series        map[string]models.Series
+	venues        map[string]models.Venue
+	settings      map[string]string
+}
+
+// New returns an empty database, but for the settings the migrations
+// insert.
+func New() *DB {
+	return &DB{
+		users:         make(map[string]models.User),
+		events:        make(map[string]models.Event),
+		registrations: make(map[string]models.Registration),
+		cancellations: make(map[string]models.Cancellation),
+		resentAt:      make(map[string]time.Time),
+		sessions:      make(map[string]models.Session),
+		tags:          make(map[string]models.Tag),
+		eventTags:     make(map[string][]string),
+		series:        make(map[string]models.Series),
+		venues:        make(map[string]models.Venue),
+		settings: map[string]string{
+			"site_name":        "LibreRegistration",
+			"accent_color":     "#6d28d9",
+			"captcha_provider": "math",
+		},
+	}
+}
+
+// searchTerms splits a search into lowercase words, as the database does.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	})
+}
+
+// matches reports whether each of the terms starts a word of the fields.
+func matches(terms []string, fields ...string) bool {
+	words := searchTerms(strings.Join(fields, " "))
+	for _, term := range terms {
+		if !slices.ContainsFunc(words, func(w string) bool { return strings.HasPrefix(w, term) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// page returns the items of the page.
+func page[T any](items []T, p models.Page) []T {
+	start := min(max(p.Offset(), 0), len(items))
+	end := min(start+max(p.Size, 0), len(items))
+	return items[start:end]
+}
+
+// notBefore reports whether t is at or after ref, as t >= ref in SQL.
+func notBefore(t, ref time.Time) bool {
+	return !t.Before(ref)
+}
@@ -0,0 +1,36 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/toulibre/libreregistration/internal/database/memory"
+	"github.com/toulibre/libreregistration/internal/database/storetest"
+	"github.com/toulibre/libreregistration/internal/services"
+)
+
+var (
+	_ services.UserStore         = (*memory.UserStore)(nil)
+	_ services.EventStore        = (*memory.EventStore)(nil)
+	_ services.RegistrationStore = (*memory.RegistrationStore)(nil)
+	_ services.SessionStore      = (*memory.SessionStore)(nil)
+	_ services.TagStore          = (*memory.TagStore)(nil)
+	_ services.SeriesStore       = (*memory.SeriesStore)(nil)
+	_ services.VenueStore        = (*memory.VenueStore)(nil)
+	_ services.SettingStore      = (*memory.SettingStore)(nil)
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		db := memory.New()
+		return storetest.Stores{
+			Users:         memory.NewUserStore(db),
+			Events:        memory.NewEventStore(db),
+			Registrations: memory.NewRegistrationStore(db),
+			Sessions:      memory.NewSessionStore(db),
+			Tags:          memory.NewTagStore(db),
+			Series:        memory.NewSeriesStore(db),
+			Venues:        memory.NewVenueStore(db),
+			Settings:      memory.NewSettingStore(db),
+		}
+	})
+}
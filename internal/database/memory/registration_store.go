@@ -0,0 +1,322 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type RegistrationStore struct {
+	db *DB
+}
+
+func NewRegistrationStore(db *DB) *RegistrationStore {
+	return &RegistrationStore{db: db}
+}
+
+// storedRegistration returns a copy of the registration, as the database
+// stores it.
+func storedRegistration(r models.Registration) models.Registration {
+	r.Duplicate = false
+	r.Companions = slices.Clone(r.Companions)
+	for i := range r.Companions {
+		r.Companions[i].RegistrationID = r.ID
+	}
+	slices.SortStableFunc(r.Companions, func(a, b models.Companion) int { return a.Position - b.Position })
+	r.SessionIDs = slices.Clone(r.SessionIDs)
+	return r
+}
+
+// withCompanions returns a copy of the registration with its companions,
+// and with its sessions if asked.
+func withCompanions(r models.Registration, sessions bool) models.Registration {
+	if len(r.Companions) == 0 {
+		r.Companions = nil
+	} else {
+		r.Companions = slices.Clone(r.Companions)
+	}
+	if sessions && len(r.SessionIDs) > 0 {
+		r.SessionIDs = slices.Clone(r.SessionIDs)
+	} else {
+		r.SessionIDs = nil
+	}
+	return r
+}
+
+// listRegistrations returns the registrations selected by keep, by
+// registration date.
+func (db *DB) listRegistrations(keep func(r *models.Registration) bool) []models.Registration {
+	var regs []models.Registration
+	for _, r := range db.registrations {
+		if keep(&r) {
+			regs = append(regs, withCompanions(r, false))
+		}
+	}
+	slices.SortFunc(regs, func(a, b models.Registration) int {
+		if c := a.RegisteredAt.Compare(b.RegisteredAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return regs
+}
+
+// Create inserts the registration and its companions.
+func (s *RegistrationStore) Create(r *models.Registration) error {
+	return s.CreateMany([]models.Registration{*r})
+}
+
+// CreateMany inserts registrations, their companions and their sessions:
+// either all of them are saved or none is.
+func (s *RegistrationStore) CreateMany(regs []models.Registration) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	ids := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, r := range s.db.registrations {
+		ids[r.ID] = true
+		tokens[r.CancelToken] = true
+	}
+	for _, r := range regs {
+		if ids[r.ID] || tokens[r.CancelToken] {
+			return fmt.Errorf("create registration: %w", errUnique)
+		}
+		ids[r.ID] = true
+		tokens[r.CancelToken] = true
+	}
+	for _, r := range regs {
+		s.db.registrations[r.ID] = storedRegistration(r)
+	}
+	return nil
+}
+
+func (s *RegistrationStore) GetByID(id string) (*models.Registration, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if r, ok := s.db.registrations[id]; ok {
+		r = withCompanions(r, true)
+		return &r, nil
+	}
+	return nil, nil
+}
+
+func (s *RegistrationStore) GetByCancelToken(token string) (*models.Registration, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, r := range s.db.registrations {
+		if r.CancelToken == token {
+			r = withCompanions(r, false)
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *RegistrationStore) ListByEvent(eventID string) ([]models.Registration, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.listRegistrations(func(r *models.Registration) bool { return r.EventID == eventID }), nil
+}
+
+// registrationSorts maps the sort keys of RegistrationFilter to their
+// comparisons.
+var registrationSorts = map[string]func(a, b *models.Registration) int{
+	"name": func(a, b *models.Registration) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	},
+	"email": func(a, b *models.Registration) int {
+		return strings.Compare(strings.ToLower(a.Email), strings.ToLower(b.Email))
+	},
+	"date":   func(a, b *models.Registration) int { return a.RegisteredAt.Compare(b.RegisteredAt) },
+	"status": func(a, b *models.Registration) int { return strings.Compare(string(a.Status), string(b.Status)) },
+}
+
+// ListPage returns a page of the registrations to the event selected by the
+// filter, and the number of selected registrations. Matches of a search
+// come in registration order.
+func (s *RegistrationStore) ListPage(eventID string, f models.RegistrationFilter, p models.Page) ([]models.Registration, int, error) {
+	var terms []string
+	if f.Query != "" {
+		if terms = searchTerms(f.Query); len(terms) == 0 {
+			return nil, 0, nil
+		}
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	regs := s.db.listRegistrations(func(r *models.Registration) bool {
+		return r.EventID == eventID &&
+			(terms == nil || matches(terms, r.Name, r.Email, r.Comment)) &&
+			(f.Status == "" || r.Status == f.Status)
+	})
+	if compare, ok := registrationSorts[f.Sort]; ok {
+		slices.SortStableFunc(regs, func(a, b models.Registration) int {
+			if f.Desc {
+				return compare(&b, &a)
+			}
+			return compare(&a, &b)
+		})
+	}
+	return page(regs, p), len(regs), nil
+}
+
+// Update saves the registration, including its event, and replaces its
+// companions. Moved registrations leave the sessions of their former event.
+func (s *RegistrationStore) Update(r *models.Registration) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	old, ok := s.db.registrations[r.ID]
+	if !ok {
+		return nil
+	}
+	updated := storedRegistration(*r)
+	updated.CancelToken = old.CancelToken
+	updated.RegisteredAt = old.RegisteredAt
+	updated.SessionIDs = slices.DeleteFunc(old.SessionIDs, func(id string) bool {
+		return s.db.sessions[id].EventID != r.EventID
+	})
+	s.db.registrations[r.ID] = updated
+	return nil
+}
+
+func (s *RegistrationStore) UpdateStatus(id string, status models.RegistrationStatus) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if r, ok := s.db.registrations[id]; ok {
+		r.Status = status
+		s.db.registrations[id] = r
+	}
+	return nil
+}
+
+// MarkResent records that the confirmation of a registration was sent again
+// at the given time, unless it already was since then. It reports whether it
+// was recorded.
+func (s *RegistrationStore) MarkResent(id string, at, since time.Time) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.registrations[id]; !ok {
+		return false, nil
+	}
+	if last, ok := s.db.resentAt[id]; ok && !last.Before(since) {
+		return false, nil
+	}
+	s.db.resentAt[id] = at
+	return true, nil
+}
+
+// Delete removes a registration along with its companions and sessions.
+func (s *RegistrationStore) Delete(id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.registrations, id)
+	return nil
+}
+
+// CancelByToken removes the registration with the given cancel token along
+// with its companions, and records its cancellation.
+func (s *RegistrationStore) CancelByToken(token string, at time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for id, r := range s.db.registrations {
+		if r.CancelToken != token {
+			continue
+		}
+		if _, ok := s.db.cancellations[id]; ok {
+			return fmt.Errorf("record cancellation: %w", errUnique)
+		}
+		s.db.cancellations[id] = models.Cancellation{
+			RegistrationID: id,
+			EventID:        r.EventID,
+			Email:          r.Email,
+			Seats:          r.Seats,
+			RegisteredAt:   r.RegisteredAt,
+			CancelledAt:    at,
+		}
+		delete(s.db.registrations, id)
+	}
+	return nil
+}
+
+// ListAll returns the registrations to all events, without their companions,
+// by registration date.
+func (s *RegistrationStore) ListAll() ([]models.Registration, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	regs := s.db.listRegistrations(func(*models.Registration) bool { return true })
+	for i := range regs {
+		regs[i].Companions = nil
+	}
+	return regs, nil
+}
+
+// ListCancellations returns the recorded cancellations by date.
+func (s *RegistrationStore) ListCancellations() ([]models.Cancellation, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var cancellations []models.Cancellation
+	for _, c := range s.db.cancellations {
+		cancellations = append(cancellations, c)
+	}
+	slices.SortFunc(cancellations, func(a, b models.Cancellation) int {
+		return a.CancelledAt.Compare(b.CancelledAt)
+	})
+	return cancellations, nil
+}
+
+// CountByEvent returns the number of seats taken by confirmed registrations
+// of an event, companions included.
+func (s *RegistrationStore) CountByEvent(eventID string) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.eventSeats(eventID), nil
+}
+
+// CountByStatus returns the number of registrations to an event and of their
+// seats, by status.
+func (s *RegistrationStore) CountByStatus(eventID string) (models.RegistrationCounts, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	counts := make(models.RegistrationCounts)
+	for _, r := range s.db.registrations {
+		if r.EventID == eventID {
+			n := counts[r.Status]
+			n.Registrations++
+			n.Seats += r.Seats
+			counts[r.Status] = n
+		}
+	}
+	return counts, nil
+}
+
+// ListIdentities returns the registrations to an event that are not
+// rejected, by registration date, with only their ID, name and email: what
+// finding duplicates needs.
+func (s *RegistrationStore) ListIdentities(eventID string) ([]models.Registration, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	regs := s.db.listRegistrations(func(r *models.Registration) bool {
+		return r.EventID == eventID && r.Status != models.StatusRejected
+	})
+	for i, r := range regs {
+		regs[i] = models.Registration{ID: r.ID, EventID: r.EventID, Name: r.Name, Email: r.Email}
+	}
+	return regs, nil
+}
+
+// TotalCount returns the number of seats taken by confirmed registrations
+// across all events.
+func (s *RegistrationStore) TotalCount() (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	count := 0
+	for _, r := range s.db.registrations {
+		if r.Status == models.StatusConfirmed {
+			count += r.Seats
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type SeriesStore struct {
+	db *DB
+}
+
+func NewSeriesStore(db *DB) *SeriesStore {
+	return &SeriesStore{db: db}
+}
+
+// storedSeries returns a copy of the series, as the database stores it.
+func storedSeries(sr models.Series) models.Series {
+	if len(sr.Exceptions) == 0 {
+		sr.Exceptions = nil
+	} else {
+		sr.Exceptions = slices.Clone(sr.Exceptions)
+	}
+	return sr
+}
+
+func (s *SeriesStore) Create(sr *models.Series) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, other := range s.db.series {
+		if other.ID == sr.ID || other.Slug == sr.Slug {
+			return fmt.Errorf("create series: %w", errUnique)
+		}
+	}
+	s.db.series[sr.ID] = storedSeries(*sr)
+	return nil
+}
+
+func (s *SeriesStore) Update(sr *models.Series) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	old, ok := s.db.series[sr.ID]
+	if !ok {
+		return nil
+	}
+	old.Title = sr.Title
+	old.Rule = sr.Rule
+	old.Exceptions = sr.Exceptions
+	old.HorizonDays = sr.HorizonDays
+	old.UpdatedAt = sr.UpdatedAt
+	s.db.series[sr.ID] = storedSeries(old)
+	return nil
+}
+
+func (s *SeriesStore) GetByID(id string) (*models.Series, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if sr, ok := s.db.series[id]; ok {
+		sr = storedSeries(sr)
+		return &sr, nil
+	}
+	return nil, nil
+}
+
+func (s *SeriesStore) GetBySlug(slug string) (*models.Series, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, sr := range s.db.series {
+		if sr.Slug == slug {
+			sr = storedSeries(sr)
+			return &sr, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *SeriesStore) SlugExists(slug string) (bool, error) {
+	sr, err := s.GetBySlug(slug)
+	return sr != nil, err
+}
+
+// ListAll returns all the series by title.
+func (s *SeriesStore) ListAll() ([]models.Series, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var series []models.Series
+	for _, sr := range s.db.series {
+		series = append(series, storedSeries(sr))
+	}
+	slices.SortFunc(series, func(a, b models.Series) int { return strings.Compare(a.Title, b.Title) })
+	return series, nil
+}
+
+// Delete deletes a series. Its occurrences are kept as standalone events.
+func (s *SeriesStore) Delete(id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for eventID, e := range s.db.events {
+		if e.SeriesID != nil && *e.SeriesID == id {
+			e.SeriesID = nil
+			e.OccurrenceDate = ""
+			s.db.events[eventID] = e
+		}
+	}
+	delete(s.db.series, id)
+	return nil
+}
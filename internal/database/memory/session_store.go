@@ -0,0 +1,168 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type SessionStore struct {
+	db *DB
+}
+
+func NewSessionStore(db *DB) *SessionStore {
+	return &SessionStore{db: db}
+}
+
+// loadSession fills in the seats taken at a session.
+func (db *DB) loadSession(se models.Session) models.Session {
+	se.RegistrationCount = 0
+	for _, r := range db.registrations {
+		if r.Status == models.StatusConfirmed && slices.Contains(r.SessionIDs, se.ID) {
+			se.RegistrationCount += r.Seats
+		}
+	}
+	return se
+}
+
+// deleteSession deletes a session and the registrations to it.
+func (db *DB) deleteSession(id string) {
+	for regID, r := range db.registrations {
+		if slices.Contains(r.SessionIDs, id) {
+			r.SessionIDs = slices.DeleteFunc(slices.Clone(r.SessionIDs), func(s string) bool { return s == id })
+			db.registrations[regID] = r
+		}
+	}
+	delete(db.sessions, id)
+}
+
+func (db *DB) createSession(se *models.Session) error {
+	if _, ok := db.sessions[se.ID]; ok {
+		return fmt.Errorf("create session: %w", errUnique)
+	}
+	stored := *se
+	stored.RegistrationCount = 0
+	db.sessions[se.ID] = stored
+	return nil
+}
+
+// updateSession updates a session of the event, and reports whether it
+// exists.
+func (db *DB) updateSession(se *models.Session, eventID string) bool {
+	old, ok := db.sessions[se.ID]
+	if !ok || old.EventID != eventID {
+		return false
+	}
+	old.Title = se.Title
+	old.Speaker = se.Speaker
+	old.Room = se.Room
+	old.Description = se.Description
+	old.StartsAt = se.StartsAt
+	old.EndsAt = se.EndsAt
+	old.MaxCapacity = se.MaxCapacity
+	db.sessions[se.ID] = old
+	return true
+}
+
+func (s *SessionStore) Create(se *models.Session) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.createSession(se)
+}
+
+func (s *SessionStore) Update(se *models.Session) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if old, ok := s.db.sessions[se.ID]; ok {
+		s.db.updateSession(se, old.EventID)
+	}
+	return nil
+}
+
+func (s *SessionStore) GetByID(id string) (*models.Session, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if se, ok := s.db.sessions[id]; ok {
+		se = s.db.loadSession(se)
+		return &se, nil
+	}
+	return nil, nil
+}
+
+// ListByEvent returns the agenda of an event, in chronological order.
+func (s *SessionStore) ListByEvent(eventID string) ([]models.Session, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var sessions []models.Session
+	for _, se := range s.db.sessions {
+		if se.EventID == eventID {
+			sessions = append(sessions, s.db.loadSession(se))
+		}
+	}
+	slices.SortFunc(sessions, func(a, b models.Session) int {
+		if c := a.StartsAt.Compare(b.StartsAt); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Room, b.Room); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Title, b.Title)
+	})
+	return sessions, nil
+}
+
+// AttendeeNames returns the names of the confirmed attendees of the sessions
+// of an event, by session.
+func (s *SessionStore) AttendeeNames(eventID string) (map[string][]string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	names := make(map[string][]string)
+	regs := s.db.listRegistrations(func(r *models.Registration) bool { return r.Status == models.StatusConfirmed })
+	for _, r := range regs {
+		for _, id := range s.db.registrations[r.ID].SessionIDs {
+			if s.db.sessions[id].EventID == eventID {
+				names[id] = append(names[id], r.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// Delete deletes a session and the registrations to it.
+func (s *SessionStore) Delete(id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.deleteSession(id)
+	return nil
+}
+
+// Replace replaces the agenda of an event at once. Sessions are matched by
+// ID: known ones are updated, others created, and the sessions missing from
+// the list are deleted.
+func (s *SessionStore) Replace(eventID string, sessions []models.Session) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Check the new sessions first, so as to change nothing on failure
+	kept := make(map[string]bool)
+	for _, se := range sessions {
+		if old, ok := s.db.sessions[se.ID]; ok && old.EventID != eventID {
+			return fmt.Errorf("create session: %w", errUnique)
+		}
+		kept[se.ID] = true
+	}
+
+	for id, se := range s.db.sessions {
+		if se.EventID == eventID && !kept[id] {
+			s.db.deleteSession(id)
+		}
+	}
+	for i := range sessions {
+		if !s.db.updateSession(&sessions[i], eventID) {
+			s.db.createSession(&sessions[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"sort"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type SettingStore struct {
+	db *DB
+}
+
+func NewSettingStore(db *DB) *SettingStore {
+	return &SettingStore{db: db}
+}
+
+func (s *SettingStore) Get(key string) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.settings[key], nil
+}
+
+func (s *SettingStore) Set(key, value string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.settings[key] = value
+	return nil
+}
+
+func (s *SettingStore) GetAll() ([]models.Setting, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var settings []models.Setting
+	for key, value := range s.db.settings {
+		settings = append(settings, models.Setting{Key: key, Value: value})
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings, nil
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type TagStore struct {
+	db *DB
+}
+
+func NewTagStore(db *DB) *TagStore {
+	return &TagStore{db: db}
+}
+
+// listTags returns the tags by name, with the number of events counted,
+// leaving out those with none unless all.
+func (db *DB) listTags(count func(e *models.Event) bool, all bool) []models.Tag {
+	counts := make(map[string]int)
+	for eventID, tagIDs := range db.eventTags {
+		e, ok := db.events[eventID]
+		if !ok || !count(&e) {
+			continue
+		}
+		for _, id := range tagIDs {
+			counts[id]++
+		}
+	}
+	var tags []models.Tag
+	for _, t := range db.tags {
+		t.EventCount = counts[t.ID]
+		if all || t.EventCount > 0 {
+			tags = append(tags, t)
+		}
+	}
+	slices.SortFunc(tags, func(a, b models.Tag) int { return strings.Compare(a.Name, b.Name) })
+	return tags
+}
+
+// ListAll returns all the tags by name, with the number of events using them.
+func (s *TagStore) ListAll() ([]models.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.listTags(func(*models.Event) bool { return true }, true), nil
+}
+
+// ListUpcoming returns the tags of the published events to come, by name,
+// with the number of those events.
+func (s *TagStore) ListUpcoming() ([]models.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	return s.db.listTags(func(e *models.Event) bool { return upcoming(e, now) }, false), nil
+}
+
+func (s *TagStore) GetByID(id string) (*models.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if t, ok := s.db.tags[id]; ok {
+		return &t, nil
+	}
+	return nil, nil
+}
+
+func (s *TagStore) GetBySlug(slug string) (*models.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if t := s.db.tagBySlug(slug); t != nil {
+		return t, nil
+	}
+	return nil, nil
+}
+
+func (db *DB) tagBySlug(slug string) *models.Tag {
+	for _, t := range db.tags {
+		if t.Slug == slug {
+			return &t
+		}
+	}
+	return nil
+}
+
+// ListByEvents returns the tags of each of the events, by name.
+func (s *TagStore) ListByEvents(eventIDs []string) (map[string][]models.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	tags := make(map[string][]models.Tag)
+	for _, eventID := range eventIDs {
+		for _, id := range s.db.eventTags[eventID] {
+			tags[eventID] = append(tags[eventID], s.db.tags[id])
+		}
+		slices.SortFunc(tags[eventID], func(a, b models.Tag) int { return strings.Compare(a.Name, b.Name) })
+	}
+	return tags, nil
+}
+
+// SetEventTags replaces the tags of an event. Tags are matched by slug, and
+// created with the given ID when they don't exist yet.
+func (s *TagStore) SetEventTags(eventID string, tags []models.Tag) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var ids []string
+	created := make(map[string]models.Tag)
+	for _, t := range tags {
+		id := t.ID
+		if existing := s.db.tagBySlug(t.Slug); existing != nil {
+			id = existing.ID
+		} else if c, ok := created[t.Slug]; ok {
+			id = c.ID
+		} else if _, ok := s.db.tags[t.ID]; ok {
+			return fmt.Errorf("create tag: %w", errUnique)
+		} else {
+			created[t.Slug] = models.Tag{ID: t.ID, Name: t.Name, Slug: t.Slug}
+		}
+		if slices.Contains(ids, id) {
+			return fmt.Errorf("tag event: %w", errUnique)
+		}
+		ids = append(ids, id)
+	}
+	for _, t := range created {
+		s.db.tags[t.ID] = t
+	}
+	if len(ids) > 0 {
+		s.db.eventTags[eventID] = ids
+	} else {
+		delete(s.db.eventTags, eventID)
+	}
+	return nil
+}
+
+func (s *TagStore) Update(t *models.Tag) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	old, ok := s.db.tags[t.ID]
+	if !ok {
+		return nil
+	}
+	if other := s.db.tagBySlug(t.Slug); other != nil && other.ID != t.ID {
+		return fmt.Errorf("update tag: %w", errUnique)
+	}
+	old.Name = t.Name
+	old.Slug = t.Slug
+	s.db.tags[t.ID] = old
+	return nil
+}
+
+// Delete removes a tag from all events and deletes it.
+func (s *TagStore) Delete(id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for eventID, ids := range s.db.eventTags {
+		if ids = slices.DeleteFunc(slices.Clone(ids), func(tagID string) bool { return tagID == id }); len(ids) > 0 {
+			s.db.eventTags[eventID] = ids
+		} else {
+			delete(s.db.eventTags, eventID)
+		}
+	}
+	delete(s.db.tags, id)
+	return nil
+}
@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type UserStore struct {
+	db *DB
+}
+
+func NewUserStore(db *DB) *UserStore {
+	return &UserStore{db: db}
+}
+
+func (s *UserStore) GetByUsername(username string) (*models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, u := range s.db.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *UserStore) GetByID(id string) (*models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if u, ok := s.db.users[id]; ok {
+		return &u, nil
+	}
+	return nil, nil
+}
+
+func (s *UserStore) Create(u *models.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.users[u.ID]; ok {
+		return fmt.Errorf("create user: %w", errUnique)
+	}
+	for _, other := range s.db.users {
+		if other.Username == u.Username {
+			return fmt.Errorf("create user: %w", errUnique)
+		}
+	}
+	s.db.users[u.ID] = *u
+	return nil
+}
+
+func (s *UserStore) List() ([]models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var users []models.User
+	for _, u := range s.db.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users, nil
+}
+
+func (s *UserStore) Delete(id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.users, id)
+	return nil
+}
+
+func (s *UserStore) Count() (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return len(s.db.users), nil
+}
+
+func (s *UserStore) UpdatePassword(id string, passwordHash string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if u, ok := s.db.users[id]; ok {
+		u.PasswordHash = passwordHash
+		u.UpdatedAt = time.Now()
+		s.db.users[id] = u
+	}
+	return nil
+}
+
+func (s *UserStore) UpdateRole(id string, role models.Role) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if u, ok := s.db.users[id]; ok {
+		u.Role = role
+		u.UpdatedAt = time.Now()
+		s.db.users[id] = u
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type VenueStore struct {
+	db *DB
+}
+
+func NewVenueStore(db *DB) *VenueStore {
+	return &VenueStore{db: db}
+}
+
+// loadVenue fills in the number of upcoming published events at a venue.
+func (db *DB) loadVenue(v models.Venue) models.Venue {
+	now := time.Now()
+	v.EventCount = 0
+	for _, e := range db.events {
+		if e.VenueID != nil && *e.VenueID == v.ID && upcoming(&e, now) {
+			v.EventCount++
+		}
+	}
+	return v
+}
+
+// checkVenueUnique checks the unique constraints of the venues table.
+func (db *DB) checkVenueUnique(v *models.Venue) error {
+	for _, other := range db.venues {
+		if other.ID != v.ID && other.Slug == v.Slug {
+			return errUnique
+		}
+	}
+	return nil
+}
+
+func (s *VenueStore) Create(v *models.Venue) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.venues[v.ID]; ok {
+		return fmt.Errorf("create venue: %w", errUnique)
+	}
+	if err := s.db.checkVenueUnique(v); err != nil {
+		return fmt.Errorf("create venue: %w", err)
+	}
+	stored := *v
+	stored.EventCount = 0
+	s.db.venues[v.ID] = stored
+	return nil
+}
+
+func (s *VenueStore) Update(v *models.Venue) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	old, ok := s.db.venues[v.ID]
+	if !ok {
+		return nil
+	}
+	if err := s.db.checkVenueUnique(v); err != nil {
+		return fmt.Errorf("update venue: %w", err)
+	}
+	updated := *v
+	updated.EventCount = 0
+	updated.CreatedAt = old.CreatedAt
+	s.db.venues[v.ID] = updated
+	return nil
+}
+
+func (s *VenueStore) GetByID(id string) (*models.Venue, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if v, ok := s.db.venues[id]; ok {
+		v = s.db.loadVenue(v)
+		return &v, nil
+	}
+	return nil, nil
+}
+
+func (s *VenueStore) GetBySlug(slug string) (*models.Venue, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, v := range s.db.venues {
+		if v.Slug == slug {
+			v = s.db.loadVenue(v)
+			return &v, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *VenueStore) SlugExists(slug string) (bool, error) {
+	v, err := s.GetBySlug(slug)
+	return v != nil, err
+}
+
+// ListAll returns all the venues by name, with their number of upcoming
+// events.
+func (s *VenueStore) ListAll() ([]models.Venue, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var venues []models.Venue
+	for _, v := range s.db.venues {
+		venues = append(venues, s.db.loadVenue(v))
+	}
+	slices.SortFunc(venues, func(a, b models.Venue) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return venues, nil
+}
+
+// Delete deletes a venue. Its events are detached from it, and keep its name
+// and coordinates unless they had their own.
+func (s *VenueStore) Delete(id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	v, ok := s.db.venues[id]
+	if !ok {
+		return nil
+	}
+	for eventID, e := range s.db.events {
+		if e.VenueID == nil || *e.VenueID != id {
+			continue
+		}
+		if e.Location == "" {
+			e.Location = v.Name
+		}
+		if e.Latitude == nil || e.Longitude == nil {
+			e.Latitude, e.Longitude = v.Latitude, v.Longitude
+		}
+		e.VenueID = nil
+		s.db.events[eventID] = e
+	}
+	delete(s.db.venues, id)
+	return nil
+}
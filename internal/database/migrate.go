@@ -1,73 +1,533 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-func Migrate(db *DB) error {
-	// Create migrations tracking table
-	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+// migrationDrivers lists the drivers a migration can be specific to. Such a
+// migration is named after the driver, as in 014_search.sqlite.sql, and is
+// skipped on the other drivers.
+var migrationDrivers = []string{"sqlite", "pgx"}
+
+// downSuffix marks the file reverting a migration, as in
+// 013_create_tags.down.sql or 014_search.down.sqlite.sql.
+const downSuffix = ".down"
+
+// migrationLockKey identifies the PostgreSQL advisory lock held while
+// migrating, so that instances starting together migrate one at a time.
+const migrationLockKey int64 = 0x6c72_6d69_6772
+
+var (
+	ErrMigrationModified = errors.New("migration modified after being applied")
+	ErrMigrationUnknown  = errors.New("migration applied but not part of this build")
+	ErrIrreversible      = errors.New("migration cannot be reverted")
+)
+
+// parseMigrationName splits the name of a migration file into its stem, as
+// in 014_search, whether it reverts the migration, and the driver it is
+// specific to, if any.
+func parseMigrationName(name string) (stem string, down bool, driver string) {
+	stem = strings.TrimSuffix(name, ".sql")
+	for _, d := range migrationDrivers {
+		if s, ok := strings.CutSuffix(stem, "."+d); ok {
+			stem, driver = s, d
+			break
+		}
+	}
+	stem, down = strings.CutSuffix(stem, downSuffix)
+	return stem, down, driver
+}
+
+// appliesTo reports whether the migration file is meant for the driver.
+func appliesTo(name, driver string) bool {
+	_, _, d := parseMigrationName(name)
+	return d == "" || d == driver
+}
+
+// migrationNames returns the names of the migrations for the driver, in the
+// order they apply. Down files are left out.
+func migrationNames(driver string) ([]string, error) {
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if _, down, _ := parseMigrationName(entry.Name()); !down && appliesTo(entry.Name(), driver) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// downName returns the name of the file reverting a migration on the
+// driver, preferring one specific to it, or "" when there is none.
+func downName(name, driver string) string {
+	stem, _, _ := parseMigrationName(name)
+	for _, candidate := range []string{stem + downSuffix + "." + driver + ".sql", stem + downSuffix + ".sql"} {
+		if _, err := fs.Stat(migrationsFS, "migrations/"+candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// checksum returns the hex-encoded SHA-256 of the content of a migration.
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Migration is a migration of the schema, applied or pending.
+type Migration struct {
+	Name       string
+	Version    int
+	Down       string // name of the file reverting it, "" when irreversible
+	AppliedAt  *time.Time
+	Modified   bool // applied with a content other than that of this build
+	Unknown    bool // applied, but not part of this build
+	Unrecorded bool // applied before checksums were recorded, recorded by Migrate
+}
+
+// Applied reports whether the migration is applied.
+func (m Migration) Applied() bool {
+	return m.AppliedAt != nil
+}
+
+// migrator runs the migrations on a single connection, within the lock
+// keeping other instances from migrating at the same time.
+type migrator struct {
+	conn   *sql.Conn
+	driver string
+}
+
+// lockMigrations opens a connection to migrate with. On PostgreSQL, it
+// waits for the advisory lock. SQLite has none, so every migration is run in
+// a transaction taking the write lock first, which checks again whether
+// another instance applied it meanwhile.
+func lockMigrations(ctx context.Context, db *DB) (*migrator, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lock migrations: %w", err)
+	}
+	m := &migrator{conn: conn, driver: db.Driver}
+	if db.Driver == "sqlite" {
+		_, err = conn.ExecContext(ctx, "PRAGMA busy_timeout = 30000")
+	} else {
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("lock migrations: %w", err)
+	}
+	if err := m.createTable(ctx); err != nil {
+		m.unlock()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *migrator) unlock() {
+	if m.driver != "sqlite" {
+		if _, err := m.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			slog.Warn("could not release the migration lock", "error", err)
+		}
+	}
+	m.conn.Close()
+}
+
+// columns returns the columns of the table tracking the applied migrations,
+// none before it is created.
+func (m *migrator) columns(ctx context.Context) ([]string, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	if m.driver != "sqlite" {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'"
+	}
+	var count int
+	if err := m.conn.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return nil, fmt.Errorf("read migrations table: %w", err)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	rows, err := m.conn.QueryContext(ctx, "SELECT * FROM schema_migrations WHERE 1 = 0")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations table: %w", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("read migrations table: %w", err)
+	}
+	return columns, nil
+}
+
+// createTable creates the table tracking the applied migrations, and adds
+// the checksums to that of older versions.
+func (m *migrator) createTable(ctx context.Context) error {
+	if _, err := m.conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
 		version TEXT PRIMARY KEY,
-		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		checksum TEXT
 	)`); err != nil {
 		return fmt.Errorf("create migrations table: %w", err)
 	}
 
-	entries, err := migrationsFS.ReadDir("migrations")
+	return m.inTx(ctx, func() error {
+		columns, err := m.columns(ctx)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(columns, "checksum") {
+			if err := m.exec(ctx, "ALTER TABLE schema_migrations ADD COLUMN checksum TEXT"); err != nil {
+				return fmt.Errorf("add migration checksums: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *migrator) exec(ctx context.Context, query string, args ...any) error {
+	_, err := m.conn.ExecContext(ctx, rebind(m.driver, query), args...)
+	return err
+}
+
+// inTx runs fn in a transaction, which on SQLite holds the write lock from
+// the start.
+func (m *migrator) inTx(ctx context.Context, fn func() error) error {
+	begin := "BEGIN"
+	if m.driver == "sqlite" {
+		begin = "BEGIN IMMEDIATE"
+	}
+	if err := m.exec(ctx, begin); err != nil {
+		return fmt.Errorf("begin migration: %w", err)
+	}
+	if err := fn(); err != nil {
+		m.exec(ctx, "ROLLBACK")
+		return err
+	}
+	if err := m.exec(ctx, "COMMIT"); err != nil {
+		return fmt.Errorf("commit migration: %w", err)
+	}
+	return nil
+}
+
+// applied returns the checksums of the applied migrations by name, empty for
+// those applied before checksums were recorded, and when they were applied.
+// The table may be missing, or lack the checksums, until the first Migrate.
+func (m *migrator) applied(ctx context.Context) (map[string]string, map[string]time.Time, error) {
+	sums := make(map[string]string)
+	times := make(map[string]time.Time)
+	columns, err := m.columns(ctx)
+	if err != nil || columns == nil {
+		return sums, times, err
+	}
+	query := "SELECT version, applied_at, NULL FROM schema_migrations"
+	if slices.Contains(columns, "checksum") {
+		query = "SELECT version, applied_at, checksum FROM schema_migrations"
+	}
+	rows, err := m.conn.QueryContext(ctx, query)
 	if err != nil {
-		return fmt.Errorf("read migrations dir: %w", err)
+		return nil, nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var at time.Time
+		var sum sql.NullString
+		if err := rows.Scan(&name, &at, &sum); err != nil {
+			return nil, nil, fmt.Errorf("scan migration: %w", err)
+		}
+		sums[name] = sum.String
+		times[name] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("list applied migrations: %w", err)
 	}
+	return sums, times, nil
+}
 
-	// Sort by filename to ensure order
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Name() < entries[j].Name()
-	})
+// isApplied checks again whether a migration is applied, within the
+// transaction about to apply or revert it.
+func (m *migrator) isApplied(ctx context.Context, name string) (bool, error) {
+	var count int
+	if err := m.conn.QueryRowContext(ctx, rebind(m.driver, "SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), name).Scan(&count); err != nil {
+		return false, fmt.Errorf("check migration %s: %w", name, err)
+	}
+	return count > 0, nil
+}
 
-	for _, entry := range entries {
-		name := entry.Name()
+// status lists the migrations for the driver in the order they apply,
+// followed by those applied but unknown to this build. It writes nothing:
+// the checksums missing from older versions are left to Migrate.
+func (m *migrator) status(ctx context.Context) ([]Migration, error) {
+	names, err := migrationNames(m.driver)
+	if err != nil {
+		return nil, err
+	}
+	sums, times, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		// Check if already applied
-		var count int
-		if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", name).Scan(&count); err != nil {
-			return fmt.Errorf("check migration %s: %w", name, err)
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		version, err := migrationVersion(name)
+		if err != nil {
+			return nil, err
+		}
+		mig := Migration{Name: name, Version: version, Down: downName(name, m.driver)}
+		if sum, ok := sums[name]; ok {
+			at := times[name]
+			mig.AppliedAt = &at
+			content, err := migrationsFS.ReadFile("migrations/" + name)
+			if err != nil {
+				return nil, fmt.Errorf("read migration %s: %w", name, err)
+			}
+			switch sum {
+			case checksum(content):
+			case "":
+				mig.Unrecorded = true
+			default:
+				mig.Modified = true
+			}
+			delete(sums, name)
+		}
+		migrations = append(migrations, mig)
+	}
+
+	var unknown []string
+	for name := range sums {
+		unknown = append(unknown, name)
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		version, _ := migrationVersion(name)
+		at := times[name]
+		migrations = append(migrations, Migration{Name: name, Version: version, AppliedAt: &at, Unknown: true})
+	}
+	return migrations, nil
+}
+
+// verify checks that the applied migrations are those of this build.
+func verify(migrations []Migration) error {
+	for _, mig := range migrations {
+		if mig.Modified {
+			return fmt.Errorf("%w: %s", ErrMigrationModified, mig.Name)
+		}
+		if mig.Unknown {
+			return fmt.Errorf("%w: %s", ErrMigrationUnknown, mig.Name)
 		}
-		if count > 0 {
+	}
+	return nil
+}
+
+// Migrate applies the pending migrations, once those applied are verified.
+// It records the checksums of the migrations applied by older versions.
+func Migrate(db *DB) error {
+	ctx := context.Background()
+	m, err := lockMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer m.unlock()
+
+	migrations, err := m.status(ctx)
+	if err != nil {
+		return err
+	}
+	if err := verify(migrations); err != nil {
+		return err
+	}
+	if err := m.recordChecksums(ctx, migrations); err != nil {
+		return err
+	}
+
+	for _, mig := range migrations {
+		if mig.Applied() {
 			continue
 		}
+		content, err := migrationsFS.ReadFile("migrations/" + mig.Name)
+		if err != nil {
+			return fmt.Errorf("read migration %s: %w", mig.Name, err)
+		}
 
-		// Read and execute migration
-		content, err := migrationsFS.ReadFile("migrations/" + name)
+		applied := false
+		err = m.inTx(ctx, func() error {
+			if applied, err = m.isApplied(ctx, mig.Name); err != nil || applied {
+				return err
+			}
+			if _, err := m.conn.ExecContext(ctx, string(content)); err != nil {
+				return fmt.Errorf("execute migration %s: %w", mig.Name, err)
+			}
+			if err := m.exec(ctx, "INSERT INTO schema_migrations (version, checksum) VALUES (?, ?)", mig.Name, checksum(content)); err != nil {
+				return fmt.Errorf("record migration %s: %w", mig.Name, err)
+			}
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("read migration %s: %w", name, err)
+			return err
 		}
+		if !applied {
+			slog.Info("migration applied", "name", mig.Name)
+		}
+	}
 
-		tx, err := db.Begin()
+	return nil
+}
+
+// recordChecksums records the checksums of the migrations applied before
+// checksums were.
+func (m *migrator) recordChecksums(ctx context.Context, migrations []Migration) error {
+	for _, mig := range migrations {
+		if !mig.Unrecorded {
+			continue
+		}
+		content, err := migrationsFS.ReadFile("migrations/" + mig.Name)
 		if err != nil {
-			return fmt.Errorf("begin transaction for %s: %w", name, err)
+			return fmt.Errorf("read migration %s: %w", mig.Name, err)
 		}
+		if err := m.exec(ctx, "UPDATE schema_migrations SET checksum = ? WHERE version = ? AND checksum IS NULL", checksum(content), mig.Name); err != nil {
+			return fmt.Errorf("record checksum of %s: %w", mig.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the applied migrations above the version, latest
+// first, and returns them. Nothing is reverted unless all of them can be.
+func MigrateDown(db *DB, version int) ([]Migration, error) {
+	ctx := context.Background()
+	m, err := lockMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock()
 
-		if _, err := tx.Exec(string(content)); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("execute migration %s: %w", name, err)
+	migrations, err := m.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(migrations); err != nil {
+		return nil, err
+	}
+	revert := MigrationsAbove(migrations, version)
+	for _, mig := range revert {
+		if mig.Down == "" {
+			return nil, fmt.Errorf("%w: %s", ErrIrreversible, mig.Name)
 		}
+	}
 
-		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", name); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("record migration %s: %w", name, err)
+	for _, mig := range revert {
+		content, err := migrationsFS.ReadFile("migrations/" + mig.Down)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", mig.Down, err)
 		}
+		err = m.inTx(ctx, func() error {
+			if applied, err := m.isApplied(ctx, mig.Name); err != nil || !applied {
+				return err
+			}
+			if _, err := m.conn.ExecContext(ctx, string(content)); err != nil {
+				return fmt.Errorf("execute migration %s: %w", mig.Down, err)
+			}
+			if err := m.exec(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Name); err != nil {
+				return fmt.Errorf("record migration %s: %w", mig.Down, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("migration reverted", "name", mig.Name)
+	}
+	return revert, nil
+}
 
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("commit migration %s: %w", name, err)
+// MigrationsAbove returns the applied migrations above the version, latest
+// first, those MigrateDown reverts.
+func MigrationsAbove(migrations []Migration, version int) []Migration {
+	var above []Migration
+	for _, mig := range migrations {
+		if mig.Applied() && mig.Version > version {
+			above = append(above, mig)
 		}
+	}
+	slices.Reverse(above)
+	return above
+}
 
-		log.Printf("Applied migration: %s", name)
+// SchemaVersion returns the number of the latest migration applied, 0 before
+// the first one.
+func SchemaVersion(db *DB) (int, error) {
+	return schemaVersion(db.DB)
+}
+
+// querier is implemented by sql.DB and sql.Tx.
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func schemaVersion(db querier) (int, error) {
+	var name sql.NullString
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&name); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	if !name.Valid {
+		return 0, nil
 	}
+	return migrationVersion(name.String)
+}
 
-	return nil
+// LatestVersion returns the number of the latest migration for the driver,
+// that of the schemas this build works with.
+func LatestVersion(driver string) (int, error) {
+	names, err := migrationNames(driver)
+	if err != nil || len(names) == 0 {
+		return 0, err
+	}
+	return migrationVersion(names[len(names)-1])
+}
+
+// migrationVersion returns the number prefixing the name of a migration.
+func migrationVersion(name string) (int, error) {
+	prefix, _, _ := strings.Cut(name, "_")
+	version, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("parse migration %s: %w", name, err)
+	}
+	return version, nil
+}
+
+// MigrationStatus lists the migrations for the driver of the database, in
+// the order they apply, followed by those applied but unknown to this build.
+// It writes nothing to the database, not even the migrations table, and
+// reports modified migrations rather than failing.
+func MigrationStatus(db *DB) ([]Migration, error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+	defer conn.Close()
+	m := &migrator{conn: conn, driver: db.Driver}
+	return m.status(ctx)
 }
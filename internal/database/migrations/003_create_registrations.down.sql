@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_registrations_cancel_token;
+DROP INDEX IF EXISTS idx_registrations_event_id;
+
+DROP TABLE IF EXISTS registrations;
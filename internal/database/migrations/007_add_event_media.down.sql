@@ -0,0 +1,4 @@
+ALTER TABLE events DROP COLUMN longitude;
+ALTER TABLE events DROP COLUMN latitude;
+ALTER TABLE events DROP COLUMN banner_path;
+ALTER TABLE events DROP COLUMN image_path;
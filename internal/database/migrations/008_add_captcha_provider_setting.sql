@@ -0,0 +1 @@
+INSERT INTO settings (key, value) VALUES ('captcha_provider', 'math') ON CONFLICT (key) DO NOTHING;
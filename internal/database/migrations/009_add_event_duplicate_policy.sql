@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN duplicate_policy TEXT NOT NULL DEFAULT 'allow';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_registrations_event_status;
+
+ALTER TABLE registrations DROP COLUMN status;
+ALTER TABLE events DROP COLUMN approval_required;
@@ -0,0 +1,4 @@
+ALTER TABLE events ADD COLUMN approval_required BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE registrations ADD COLUMN status TEXT NOT NULL DEFAULT 'confirmed';
+
+CREATE INDEX IF NOT EXISTS idx_registrations_event_status ON registrations(event_id, status);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_companions_registration_id;
+DROP TABLE IF EXISTS companions;
+
+ALTER TABLE registrations DROP COLUMN seats;
+ALTER TABLE events DROP COLUMN max_companions;
@@ -0,0 +1,11 @@
+ALTER TABLE events ADD COLUMN max_companions INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE registrations ADD COLUMN seats INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS companions (
+    id TEXT PRIMARY KEY,
+    registration_id TEXT NOT NULL REFERENCES registrations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_companions_registration_id ON companions(registration_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_events_status;
+
+ALTER TABLE events DROP COLUMN preview_token;
+ALTER TABLE events DROP COLUMN registration_opens_at;
+ALTER TABLE events DROP COLUMN publish_at;
+ALTER TABLE events DROP COLUMN status;
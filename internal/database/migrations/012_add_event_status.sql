@@ -0,0 +1,6 @@
+ALTER TABLE events ADD COLUMN status TEXT NOT NULL DEFAULT 'published';
+ALTER TABLE events ADD COLUMN publish_at TIMESTAMP;
+ALTER TABLE events ADD COLUMN registration_opens_at TIMESTAMP;
+ALTER TABLE events ADD COLUMN preview_token TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_events_status ON events(status);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_event_tags_tag_id;
+DROP TABLE IF EXISTS event_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_registrations_search;
+ALTER TABLE registrations DROP COLUMN search;
+
+DROP INDEX IF EXISTS idx_events_search;
+ALTER TABLE events DROP COLUMN search;
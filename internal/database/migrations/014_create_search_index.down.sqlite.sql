@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS registrations_fts_delete;
+DROP TRIGGER IF EXISTS registrations_fts_update;
+DROP TRIGGER IF EXISTS registrations_fts_insert;
+DROP TABLE IF EXISTS registrations_fts;
+
+DROP TRIGGER IF EXISTS events_fts_delete;
+DROP TRIGGER IF EXISTS events_fts_update;
+DROP TRIGGER IF EXISTS events_fts_insert;
+DROP TABLE IF EXISTS events_fts;
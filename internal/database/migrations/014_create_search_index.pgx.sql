@@ -0,0 +1,14 @@
+-- Full-text search columns. The 'simple' configuration does no stemming, as
+-- events and attendees can be in any language. Emails are split on "@" and
+-- "." so that their parts can be searched, as with SQLite.
+ALTER TABLE events ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', title || ' ' || description || ' ' || location)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_events_search ON events USING GIN (search);
+
+ALTER TABLE registrations ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', name || ' ' || translate(email, '@.', '  ') || ' ' || comment)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_registrations_search ON registrations USING GIN (search);
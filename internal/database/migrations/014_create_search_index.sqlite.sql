@@ -0,0 +1,47 @@
+-- Full-text indexes, kept up to date by triggers. Diacritics are ignored, so
+-- that "cafe" finds "Café".
+CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5(
+    event_id UNINDEXED, title, description, location,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO events_fts (event_id, title, description, location)
+    SELECT id, title, description, location FROM events;
+
+CREATE TRIGGER IF NOT EXISTS events_fts_insert AFTER INSERT ON events BEGIN
+    INSERT INTO events_fts (event_id, title, description, location)
+        VALUES (new.id, new.title, new.description, new.location);
+END;
+
+CREATE TRIGGER IF NOT EXISTS events_fts_update AFTER UPDATE OF title, description, location ON events BEGIN
+    DELETE FROM events_fts WHERE event_id = old.id;
+    INSERT INTO events_fts (event_id, title, description, location)
+        VALUES (new.id, new.title, new.description, new.location);
+END;
+
+CREATE TRIGGER IF NOT EXISTS events_fts_delete AFTER DELETE ON events BEGIN
+    DELETE FROM events_fts WHERE event_id = old.id;
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS registrations_fts USING fts5(
+    registration_id UNINDEXED, name, email, comment,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO registrations_fts (registration_id, name, email, comment)
+    SELECT id, name, email, comment FROM registrations;
+
+CREATE TRIGGER IF NOT EXISTS registrations_fts_insert AFTER INSERT ON registrations BEGIN
+    INSERT INTO registrations_fts (registration_id, name, email, comment)
+        VALUES (new.id, new.name, new.email, new.comment);
+END;
+
+CREATE TRIGGER IF NOT EXISTS registrations_fts_update AFTER UPDATE OF name, email, comment ON registrations BEGIN
+    DELETE FROM registrations_fts WHERE registration_id = old.id;
+    INSERT INTO registrations_fts (registration_id, name, email, comment)
+        VALUES (new.id, new.name, new.email, new.comment);
+END;
+
+CREATE TRIGGER IF NOT EXISTS registrations_fts_delete AFTER DELETE ON registrations BEGIN
+    DELETE FROM registrations_fts WHERE registration_id = old.id;
+END;
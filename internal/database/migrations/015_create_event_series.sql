@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS event_series (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    rule TEXT NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    exceptions TEXT NOT NULL DEFAULT '',
+    horizon_days INTEGER NOT NULL DEFAULT 90,
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE events ADD COLUMN series_id TEXT REFERENCES event_series(id);
+ALTER TABLE events ADD COLUMN occurrence_date TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_events_series_occurrence ON events(series_id, occurrence_date);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_session_registrations_registration_id;
+DROP TABLE IF EXISTS session_registrations;
+
+DROP INDEX IF EXISTS idx_sessions_event_id;
+DROP TABLE IF EXISTS sessions;
+
+ALTER TABLE events DROP COLUMN end_date;
@@ -0,0 +1,24 @@
+ALTER TABLE events ADD COLUMN end_date TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    speaker TEXT NOT NULL DEFAULT '',
+    room TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    max_capacity INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_event_id ON sessions(event_id, starts_at);
+
+CREATE TABLE IF NOT EXISTS session_registrations (
+    session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    registration_id TEXT NOT NULL REFERENCES registrations(id) ON DELETE CASCADE,
+    PRIMARY KEY (session_id, registration_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_registrations_registration_id ON session_registrations(registration_id);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS venues (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    address TEXT NOT NULL DEFAULT '',
+    latitude REAL,
+    longitude REAL,
+    accessibility TEXT NOT NULL DEFAULT '',
+    max_capacity INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE events ADD COLUMN venue_id TEXT REFERENCES venues(id);
+
+CREATE INDEX IF NOT EXISTS idx_events_venue_id ON events(venue_id);
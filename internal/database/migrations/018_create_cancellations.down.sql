@@ -0,0 +1,4 @@
+ALTER TABLE events DROP COLUMN registrations_opened_at;
+
+DROP INDEX IF EXISTS idx_cancellations_event_id;
+DROP TABLE IF EXISTS cancellations;
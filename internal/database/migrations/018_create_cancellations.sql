@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS cancellations (
+    registration_id TEXT PRIMARY KEY,
+    event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    email TEXT NOT NULL DEFAULT '',
+    seats INTEGER NOT NULL DEFAULT 1,
+    registered_at TIMESTAMP NOT NULL,
+    cancelled_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_cancellations_event_id ON cancellations(event_id);
+
+ALTER TABLE events ADD COLUMN registrations_opened_at TIMESTAMP;
+
+UPDATE events SET registrations_opened_at = created_at WHERE registration_open = TRUE;
@@ -0,0 +1 @@
+ALTER TABLE registrations DROP COLUMN resent_at;
@@ -0,0 +1 @@
+ALTER TABLE registrations ADD COLUMN resent_at TIMESTAMP;
@@ -3,6 +3,8 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/toulibre/libreregistration/internal/models"
 )
@@ -15,23 +17,91 @@ func NewRegistrationStore(db *DB) *RegistrationStore {
 	return &RegistrationStore{db: db}
 }
 
-const regColumns = "id, event_id, name, email, comment, cancel_token, registered_at"
+const regColumns = "id, event_id, name, email, comment, cancel_token, status, seats, registered_at"
 
 func scanReg(row interface{ Scan(...interface{}) error }) (*models.Registration, error) {
 	var r models.Registration
-	err := row.Scan(&r.ID, &r.EventID, &r.Name, &r.Email, &r.Comment, &r.CancelToken, &r.RegisteredAt)
+	err := row.Scan(&r.ID, &r.EventID, &r.Name, &r.Email, &r.Comment, &r.CancelToken, &r.Status, &r.Seats, &r.RegisteredAt)
 	return &r, err
 }
 
+// Create inserts the registration and its companions in one transaction.
 func (s *RegistrationStore) Create(r *models.Registration) error {
-	_, err := s.db.Exec(
-		"INSERT INTO registrations (id, event_id, name, email, comment, cancel_token, registered_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		r.ID, r.EventID, r.Name, r.Email, r.Comment, r.CancelToken, r.RegisteredAt,
-	)
+	return s.CreateMany([]models.Registration{*r})
+}
+
+// CreateMany inserts registrations, their companions and their sessions in
+// one transaction: either all of them are saved or none is.
+func (s *RegistrationStore) CreateMany(regs []models.Registration) error {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("create registration: %w", err)
+		return fmt.Errorf("begin transaction: %w", err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	for _, r := range regs {
+		_, err := tx.Exec(
+			"INSERT INTO registrations (id, event_id, name, email, comment, cancel_token, status, seats, registered_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			r.ID, r.EventID, r.Name, r.Email, r.Comment, r.CancelToken, r.Status, r.Seats, r.RegisteredAt,
+		)
+		if err != nil {
+			return fmt.Errorf("create registration: %w", err)
+		}
+		for _, c := range r.Companions {
+			_, err := tx.Exec(
+				"INSERT INTO companions (id, registration_id, name, position) VALUES (?, ?, ?, ?)",
+				c.ID, r.ID, c.Name, c.Position,
+			)
+			if err != nil {
+				return fmt.Errorf("create companion: %w", err)
+			}
+		}
+		for _, id := range r.SessionIDs {
+			_, err := tx.Exec("INSERT INTO session_registrations (session_id, registration_id) VALUES (?, ?)", id, r.ID)
+			if err != nil {
+				return fmt.Errorf("register to session: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *RegistrationStore) GetByID(id string) (*models.Registration, error) {
+	r, err := scanReg(s.db.QueryRow(
+		"SELECT "+regColumns+" FROM registrations WHERE id = ?", id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get registration by id: %w", err)
+	}
+	if r.Companions, err = s.listCompanions("c.registration_id = ?", r.ID); err != nil {
+		return nil, err
+	}
+	if r.SessionIDs, err = s.listSessionIDs(r.ID); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// listSessionIDs returns the sessions a registration is registered to.
+func (s *RegistrationStore) listSessionIDs(regID string) ([]string, error) {
+	rows, err := s.db.Query("SELECT session_id FROM session_registrations WHERE registration_id = ?", regID)
+	if err != nil {
+		return nil, fmt.Errorf("list registration sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan registration session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
 
 func (s *RegistrationStore) GetByCancelToken(token string) (*models.Registration, error) {
@@ -44,6 +114,9 @@ func (s *RegistrationStore) GetByCancelToken(token string) (*models.Registration
 	if err != nil {
 		return nil, fmt.Errorf("get registration by token: %w", err)
 	}
+	if r.Companions, err = s.listCompanions("c.registration_id = ?", r.ID); err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
@@ -65,33 +138,338 @@ func (s *RegistrationStore) ListByEvent(eventID string) ([]models.Registration,
 		}
 		regs = append(regs, *r)
 	}
-	return regs, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	companions, err := s.listCompanions("r.event_id = ?", eventID)
+	if err != nil {
+		return nil, err
+	}
+	byReg := make(map[string][]models.Companion)
+	for _, c := range companions {
+		byReg[c.RegistrationID] = append(byReg[c.RegistrationID], c)
+	}
+	for i := range regs {
+		regs[i].Companions = byReg[regs[i].ID]
+	}
+	return regs, nil
+}
+
+// registrationSorts maps the sort keys of RegistrationFilter to their
+// expressions.
+var registrationSorts = map[string]string{
+	"name":   "LOWER(r.name)",
+	"email":  "LOWER(r.email)",
+	"date":   "r.registered_at",
+	"status": "r.status",
+}
+
+// ListPage returns a page of the registrations to the event selected by the
+// filter, and the number of selected registrations.
+func (s *RegistrationStore) ListPage(eventID string, f models.RegistrationFilter, page models.Page) ([]models.Registration, int, error) {
+	var join, rank string
+	var conds []string
+	var args []any
+	if f.Query != "" {
+		terms := searchTerms(f.Query)
+		if len(terms) == 0 {
+			return nil, 0, nil
+		}
+		var match string
+		join, match, rank = s.db.fullText("registrations", "r", "registration_id")
+		conds = append(conds, match)
+		args = append(args, s.db.matchQuery(terms))
+	}
+	conds = append(conds, "r.event_id = ?")
+	args = append(args, eventID)
+	if f.Status != "" {
+		conds = append(conds, "r.status = ?")
+		args = append(args, f.Status)
+	}
+	where := join + " WHERE " + strings.Join(conds, " AND ")
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM registrations r "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count registrations: %w", err)
+	}
+
+	order := "r.registered_at"
+	if col, ok := registrationSorts[f.Sort]; ok {
+		order = col + " ASC"
+		if f.Desc {
+			order = col + " DESC"
+		}
+		order += ", r.registered_at"
+	} else if rank != "" {
+		order = rank + ", r.registered_at"
+	}
+	rows, err := s.db.Query(
+		"SELECT r."+strings.ReplaceAll(regColumns, ", ", ", r.")+" FROM registrations r "+where+
+			" ORDER BY "+order+", r.id LIMIT ? OFFSET ?",
+		append(args, page.Size, page.Offset())...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list registrations: %w", err)
+	}
+	defer rows.Close()
+
+	var regs []models.Registration
+	for rows.Next() {
+		r, err := scanReg(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan registration: %w", err)
+		}
+		regs = append(regs, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(regs) == 0 {
+		return regs, total, nil
+	}
+
+	ids := make([]any, len(regs))
+	for i, r := range regs {
+		ids[i] = r.ID
+	}
+	companions, err := s.listCompanions("r.id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", ids...)
+	if err != nil {
+		return nil, 0, err
+	}
+	byReg := make(map[string][]models.Companion)
+	for _, c := range companions {
+		byReg[c.RegistrationID] = append(byReg[c.RegistrationID], c)
+	}
+	for i := range regs {
+		regs[i].Companions = byReg[regs[i].ID]
+	}
+	return regs, total, nil
+}
+
+func (s *RegistrationStore) listCompanions(where string, args ...interface{}) ([]models.Companion, error) {
+	rows, err := s.db.Query(
+		"SELECT c.id, c.registration_id, c.name, c.position FROM companions c JOIN registrations r ON r.id = c.registration_id WHERE "+where+" ORDER BY c.registration_id, c.position",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list companions: %w", err)
+	}
+	defer rows.Close()
+
+	var companions []models.Companion
+	for rows.Next() {
+		var c models.Companion
+		if err := rows.Scan(&c.ID, &c.RegistrationID, &c.Name, &c.Position); err != nil {
+			return nil, fmt.Errorf("scan companion: %w", err)
+		}
+		companions = append(companions, c)
+	}
+	return companions, rows.Err()
 }
 
+// Update saves the registration, including its event, and replaces its
+// companions. Moved registrations leave the sessions of their former event.
+func (s *RegistrationStore) Update(r *models.Registration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE registrations SET event_id = ?, name = ?, email = ?, comment = ?, status = ?, seats = ? WHERE id = ?",
+		r.EventID, r.Name, r.Email, r.Comment, r.Status, r.Seats, r.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update registration: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM companions WHERE registration_id = ?", r.ID); err != nil {
+		return fmt.Errorf("delete companions: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM session_registrations WHERE registration_id = ? AND session_id NOT IN (SELECT id FROM sessions WHERE event_id = ?)", r.ID, r.EventID); err != nil {
+		return fmt.Errorf("leave sessions: %w", err)
+	}
+	for _, c := range r.Companions {
+		_, err := tx.Exec(
+			"INSERT INTO companions (id, registration_id, name, position) VALUES (?, ?, ?, ?)",
+			c.ID, r.ID, c.Name, c.Position,
+		)
+		if err != nil {
+			return fmt.Errorf("create companion: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *RegistrationStore) UpdateStatus(id string, status models.RegistrationStatus) error {
+	_, err := s.db.Exec("UPDATE registrations SET status = ? WHERE id = ?", status, id)
+	if err != nil {
+		return fmt.Errorf("update registration status: %w", err)
+	}
+	return nil
+}
+
+// MarkResent records that the confirmation of a registration was sent again
+// at the given time, unless it already was since then. It reports whether it
+// was recorded: concurrent calls cannot both succeed.
+func (s *RegistrationStore) MarkResent(id string, at, since time.Time) (bool, error) {
+	res, err := s.db.Exec(
+		"UPDATE registrations SET resent_at = ? WHERE id = ? AND (resent_at IS NULL OR resent_at < ?)",
+		at, id, since,
+	)
+	if err != nil {
+		return false, fmt.Errorf("mark registration resent: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("mark registration resent: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Delete removes a registration along with its companions and sessions.
 func (s *RegistrationStore) Delete(id string) error {
-	_, err := s.db.Exec("DELETE FROM registrations WHERE id = ?", id)
+	return s.inTx(func(tx *Tx) error {
+		return deleteRegistrations(tx, "id = ?", id)
+	})
+}
+
+// CancelByToken removes the registration with the given cancel token along
+// with its companions, and records its cancellation.
+func (s *RegistrationStore) CancelByToken(token string, at time.Time) error {
+	return s.inTx(func(tx *Tx) error {
+		if _, err := tx.Exec(`INSERT INTO cancellations (registration_id, event_id, email, seats, registered_at, cancelled_at)
+			SELECT id, event_id, email, seats, registered_at, ? FROM registrations WHERE cancel_token = ?`, at, token); err != nil {
+			return fmt.Errorf("record cancellation: %w", err)
+		}
+		return deleteRegistrations(tx, "cancel_token = ?", token)
+	})
+}
+
+func (s *RegistrationStore) inTx(fn func(tx *Tx) error) error {
+	tx, err := s.db.Begin()
 	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteRegistrations does not rely on ON DELETE CASCADE, which SQLite only
+// honors on connections where foreign keys were enabled.
+func deleteRegistrations(tx *Tx, where string, arg string) error {
+	if _, err := tx.Exec("DELETE FROM companions WHERE registration_id IN (SELECT id FROM registrations WHERE "+where+")", arg); err != nil {
+		return fmt.Errorf("delete companions: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM session_registrations WHERE registration_id IN (SELECT id FROM registrations WHERE "+where+")", arg); err != nil {
+		return fmt.Errorf("leave sessions: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM registrations WHERE "+where, arg); err != nil {
 		return fmt.Errorf("delete registration: %w", err)
 	}
 	return nil
 }
 
-func (s *RegistrationStore) DeleteByToken(token string) error {
-	_, err := s.db.Exec("DELETE FROM registrations WHERE cancel_token = ?", token)
+// ListAll returns the registrations to all events, without their companions,
+// by registration date.
+func (s *RegistrationStore) ListAll() ([]models.Registration, error) {
+	rows, err := s.db.Query("SELECT " + regColumns + " FROM registrations ORDER BY registered_at")
 	if err != nil {
-		return fmt.Errorf("delete registration by token: %w", err)
+		return nil, fmt.Errorf("list registrations: %w", err)
 	}
-	return nil
+	defer rows.Close()
+
+	var regs []models.Registration
+	for rows.Next() {
+		r, err := scanReg(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan registration: %w", err)
+		}
+		regs = append(regs, *r)
+	}
+	return regs, rows.Err()
 }
 
+// ListCancellations returns the recorded cancellations by date.
+func (s *RegistrationStore) ListCancellations() ([]models.Cancellation, error) {
+	rows, err := s.db.Query("SELECT registration_id, event_id, email, seats, registered_at, cancelled_at FROM cancellations ORDER BY cancelled_at")
+	if err != nil {
+		return nil, fmt.Errorf("list cancellations: %w", err)
+	}
+	defer rows.Close()
+
+	var cancellations []models.Cancellation
+	for rows.Next() {
+		var c models.Cancellation
+		if err := rows.Scan(&c.RegistrationID, &c.EventID, &c.Email, &c.Seats, &c.RegisteredAt, &c.CancelledAt); err != nil {
+			return nil, fmt.Errorf("scan cancellation: %w", err)
+		}
+		cancellations = append(cancellations, c)
+	}
+	return cancellations, rows.Err()
+}
+
+// CountByEvent returns the number of seats taken by confirmed registrations
+// of an event, companions included.
 func (s *RegistrationStore) CountByEvent(eventID string) (int, error) {
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM registrations WHERE event_id = ?", eventID).Scan(&count)
+	err := s.db.QueryRow("SELECT COALESCE(SUM(seats), 0) FROM registrations WHERE event_id = ? AND status = 'confirmed'", eventID).Scan(&count)
 	return count, err
 }
 
+// CountByStatus returns the number of registrations to an event and of their
+// seats, by status.
+func (s *RegistrationStore) CountByStatus(eventID string) (models.RegistrationCounts, error) {
+	rows, err := s.db.Query(`SELECT status, COUNT(*), COALESCE(SUM(seats), 0)
+		FROM registrations WHERE event_id = ? GROUP BY status`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("count registrations: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(models.RegistrationCounts)
+	for rows.Next() {
+		var status models.RegistrationStatus
+		var n models.RegistrationCount
+		if err := rows.Scan(&status, &n.Registrations, &n.Seats); err != nil {
+			return nil, fmt.Errorf("scan registration count: %w", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// ListIdentities returns the registrations to an event that are not
+// rejected, by registration date, with only their ID, name and email: what
+// finding duplicates needs.
+func (s *RegistrationStore) ListIdentities(eventID string) ([]models.Registration, error) {
+	rows, err := s.db.Query(`SELECT id, name, email FROM registrations
+		WHERE event_id = ? AND status <> 'rejected' ORDER BY registered_at, id`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("list registrations: %w", err)
+	}
+	defer rows.Close()
+
+	var regs []models.Registration
+	for rows.Next() {
+		r := models.Registration{EventID: eventID}
+		if err := rows.Scan(&r.ID, &r.Name, &r.Email); err != nil {
+			return nil, fmt.Errorf("scan registration: %w", err)
+		}
+		regs = append(regs, r)
+	}
+	return regs, rows.Err()
+}
+
+// TotalCount returns the number of seats taken by confirmed registrations
+// across all events.
 func (s *RegistrationStore) TotalCount() (int, error) {
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM registrations").Scan(&count)
+	err := s.db.QueryRow("SELECT COALESCE(SUM(seats), 0) FROM registrations WHERE status = 'confirmed'").Scan(&count)
 	return count, err
 }
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// searchTerms splits a search into words, dropping punctuation, so that the
+// input never reaches the full-text query syntax.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	})
+}
+
+// matchQuery returns a full-text query matching the rows with all the terms,
+// as word prefixes.
+func (db *DB) matchQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		if db.Driver == "sqlite" {
+			parts[i] = `"` + t + `"*`
+		} else {
+			parts[i] = t + ":*"
+		}
+	}
+	if db.Driver == "sqlite" {
+		return strings.Join(parts, " AND ")
+	}
+	return strings.Join(parts, " & ")
+}
+
+// fullText returns the join and the condition selecting the rows of table,
+// aliased as alias, that match a query, and the order putting the best
+// matches first. Both the join and the condition may hold a placeholder:
+// the condition must come first in the WHERE clause, and the query be
+// passed once.
+//
+// SQLite searches the <table>_fts FTS5 table, keyed by key; PostgreSQL the
+// search column of the table.
+func (db *DB) fullText(table, alias, key string) (join, where, order string) {
+	if db.Driver == "sqlite" {
+		fts := table + "_fts"
+		return fmt.Sprintf("JOIN %s ON %s.%s = %s.id", fts, fts, key, alias), fts + " MATCH ?", fts + ".rank"
+	}
+	return "CROSS JOIN to_tsquery('simple', ?) AS tsq", alias + ".search @@ tsq", "ts_rank(" + alias + ".search, tsq) DESC"
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type SeriesStore struct {
+	db *DB
+}
+
+func NewSeriesStore(db *DB) *SeriesStore {
+	return &SeriesStore{db: db}
+}
+
+const seriesColumns = "id, title, slug, rule, starts_at, exceptions, horizon_days, created_by, created_at, updated_at"
+
+func (s *SeriesStore) Create(sr *models.Series) error {
+	_, err := s.db.Exec(`INSERT INTO event_series
+		(id, title, slug, rule, starts_at, exceptions, horizon_days, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sr.ID, sr.Title, sr.Slug, sr.Rule, sr.StartsAt, strings.Join(sr.Exceptions, ","), sr.HorizonDays,
+		sr.CreatedBy, sr.CreatedAt, sr.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create series: %w", err)
+	}
+	return nil
+}
+
+func (s *SeriesStore) Update(sr *models.Series) error {
+	_, err := s.db.Exec(`UPDATE event_series SET
+		title = ?, rule = ?, exceptions = ?, horizon_days = ?, updated_at = ?
+		WHERE id = ?`,
+		sr.Title, sr.Rule, strings.Join(sr.Exceptions, ","), sr.HorizonDays, sr.UpdatedAt, sr.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update series: %w", err)
+	}
+	return nil
+}
+
+func (s *SeriesStore) GetByID(id string) (*models.Series, error) {
+	return s.getSeries("SELECT "+seriesColumns+" FROM event_series WHERE id = ?", id)
+}
+
+func (s *SeriesStore) GetBySlug(slug string) (*models.Series, error) {
+	return s.getSeries("SELECT "+seriesColumns+" FROM event_series WHERE slug = ?", slug)
+}
+
+func (s *SeriesStore) SlugExists(slug string) (bool, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM event_series WHERE slug = ?", slug).Scan(&count)
+	return count > 0, err
+}
+
+// ListAll returns all the series by title.
+func (s *SeriesStore) ListAll() ([]models.Series, error) {
+	rows, err := s.db.Query("SELECT " + seriesColumns + " FROM event_series ORDER BY title")
+	if err != nil {
+		return nil, fmt.Errorf("list series: %w", err)
+	}
+	defer rows.Close()
+
+	var series []models.Series
+	for rows.Next() {
+		sr, err := scanSeries(rows)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, *sr)
+	}
+	return series, rows.Err()
+}
+
+// Delete deletes a series. Its occurrences are kept as standalone events.
+func (s *SeriesStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE events SET series_id = NULL, occurrence_date = '' WHERE series_id = ?", id); err != nil {
+		return fmt.Errorf("detach occurrences: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM event_series WHERE id = ?", id); err != nil {
+		return fmt.Errorf("delete series: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *SeriesStore) getSeries(query string, args ...any) (*models.Series, error) {
+	sr, err := scanSeries(s.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sr, err
+}
+
+func scanSeries(row scanner) (*models.Series, error) {
+	var sr models.Series
+	var exceptions string
+	err := row.Scan(&sr.ID, &sr.Title, &sr.Slug, &sr.Rule, &sr.StartsAt, &exceptions, &sr.HorizonDays,
+		&sr.CreatedBy, &sr.CreatedAt, &sr.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan series: %w", err)
+	}
+	if exceptions != "" {
+		sr.Exceptions = strings.Split(exceptions, ",")
+	}
+	return &sr, nil
+}
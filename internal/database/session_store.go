@@ -0,0 +1,177 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type SessionStore struct {
+	db *DB
+}
+
+func NewSessionStore(db *DB) *SessionStore {
+	return &SessionStore{db: db}
+}
+
+const sessionColumns = `se.id, se.event_id, se.title, se.speaker, se.room, se.description,
+		se.starts_at, se.ends_at, se.max_capacity, se.created_at,
+		(SELECT COALESCE(SUM(r.seats), 0) FROM session_registrations sr
+			JOIN registrations r ON r.id = sr.registration_id
+			WHERE sr.session_id = se.id AND r.status = 'confirmed')`
+
+func (s *SessionStore) Create(se *models.Session) error {
+	return createSession(s.db, se)
+}
+
+func (s *SessionStore) Update(se *models.Session) error {
+	_, err := s.db.Exec(`UPDATE sessions SET
+		title = ?, speaker = ?, room = ?, description = ?, starts_at = ?, ends_at = ?, max_capacity = ?
+		WHERE id = ?`,
+		se.Title, se.Speaker, se.Room, se.Description, se.StartsAt, se.EndsAt, se.MaxCapacity, se.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionStore) GetByID(id string) (*models.Session, error) {
+	se, err := scanSession(s.db.QueryRow("SELECT "+sessionColumns+" FROM sessions se WHERE se.id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return se, err
+}
+
+// ListByEvent returns the agenda of an event, in chronological order.
+func (s *SessionStore) ListByEvent(eventID string) ([]models.Session, error) {
+	rows, err := s.db.Query("SELECT "+sessionColumns+" FROM sessions se WHERE se.event_id = ? ORDER BY se.starts_at, se.room, se.title", eventID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		se, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *se)
+	}
+	return sessions, rows.Err()
+}
+
+// AttendeeNames returns the names of the confirmed attendees of the sessions
+// of an event, by session.
+func (s *SessionStore) AttendeeNames(eventID string) (map[string][]string, error) {
+	rows, err := s.db.Query(`SELECT sr.session_id, r.name FROM session_registrations sr
+		JOIN registrations r ON r.id = sr.registration_id
+		JOIN sessions se ON se.id = sr.session_id
+		WHERE se.event_id = ? AND r.status = 'confirmed'
+		ORDER BY r.registered_at`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("list session attendees: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string][]string)
+	for rows.Next() {
+		var sessionID, name string
+		if err := rows.Scan(&sessionID, &name); err != nil {
+			return nil, fmt.Errorf("scan session attendee: %w", err)
+		}
+		names[sessionID] = append(names[sessionID], name)
+	}
+	return names, rows.Err()
+}
+
+// Delete deletes a session and the registrations to it.
+func (s *SessionStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM session_registrations WHERE session_id = ?", id); err != nil {
+		return fmt.Errorf("delete session registrations: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE id = ?", id); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Replace replaces the agenda of an event in one transaction. Sessions are
+// matched by ID: known ones are updated, others created, and the sessions
+// missing from the list are deleted.
+func (s *SessionStore) Replace(eventID string, sessions []models.Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	dropped := "SELECT id FROM sessions WHERE event_id = ?"
+	args := []any{eventID}
+	if len(sessions) > 0 {
+		dropped += " AND id NOT IN (?" + strings.Repeat(", ?", len(sessions)-1) + ")"
+		for _, se := range sessions {
+			args = append(args, se.ID)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM session_registrations WHERE session_id IN ("+dropped+")", args...); err != nil {
+		return fmt.Errorf("delete session registrations: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE id IN ("+dropped+")", args...); err != nil {
+		return fmt.Errorf("delete sessions: %w", err)
+	}
+
+	for i := range sessions {
+		se := &sessions[i]
+		res, err := tx.Exec(`UPDATE sessions SET
+			title = ?, speaker = ?, room = ?, description = ?, starts_at = ?, ends_at = ?, max_capacity = ?
+			WHERE id = ? AND event_id = ?`,
+			se.Title, se.Speaker, se.Room, se.Description, se.StartsAt, se.EndsAt, se.MaxCapacity, se.ID, eventID,
+		)
+		if err != nil {
+			return fmt.Errorf("update session: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			continue
+		}
+		if err := createSession(tx, se); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func createSession(db execer, se *models.Session) error {
+	_, err := db.Exec(`INSERT INTO sessions
+		(id, event_id, title, speaker, room, description, starts_at, ends_at, max_capacity, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		se.ID, se.EventID, se.Title, se.Speaker, se.Room, se.Description, se.StartsAt, se.EndsAt, se.MaxCapacity, se.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+func scanSession(row scanner) (*models.Session, error) {
+	var se models.Session
+	err := row.Scan(&se.ID, &se.EventID, &se.Title, &se.Speaker, &se.Room, &se.Description,
+		&se.StartsAt, &se.EndsAt, &se.MaxCapacity, &se.CreatedAt, &se.RegistrationCount)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan session: %w", err)
+	}
+	return &se, nil
+}
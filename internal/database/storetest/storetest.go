@@ -0,0 +1,1010 @@
+// Package storetest checks that implementations of the stores of the services
+// behave the same. Each backend runs the suite from a test of its own:
+//
+//	func TestStores(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) storetest.Stores {
+//			db := memory.New()
+//			return storetest.Stores{Users: memory.NewUserStore(db), …}
+//		})
+//	}
+//
+// The suite only relies on behavior the services rely on: it does not check
+// the ranking of search results, nor the order of ties.
+package storetest
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/services"
+)
+
+// Stores are the stores under test, all sharing the same empty database but
+// for the default settings.
+type Stores struct {
+	Users         services.UserStore
+	Events        services.EventStore
+	Registrations services.RegistrationStore
+	Sessions      services.SessionStore
+	Tags          services.TagStore
+	Series        services.SeriesStore
+	Venues        services.VenueStore
+	Settings      services.SettingStore
+}
+
+// Run runs the suite, on new stores from open for each test.
+func Run(t *testing.T, open func(t *testing.T) Stores) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Stores)
+	}{
+		{"Users", testUsers},
+		{"Settings", testSettings},
+		{"Events", testEvents},
+		{"EventLists", testEventLists},
+		{"EventPage", testEventPage},
+		{"EventSchedule", testEventSchedule},
+		{"EventDelete", testEventDelete},
+		{"Registrations", testRegistrations},
+		{"RegistrationPage", testRegistrationPage},
+		{"RegistrationCancel", testRegistrationCancel},
+		{"RegistrationCreateMany", testRegistrationCreateMany},
+		{"RegistrationResend", testRegistrationResend},
+		{"RegistrationCounts", testRegistrationCounts},
+		{"Sessions", testSessions},
+		{"SessionReplace", testSessionReplace},
+		{"Tags", testTags},
+		{"Series", testSeries},
+		{"Venues", testVenues},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+// now is a time in the future of the tests' events, as the databases store
+// times to the second at best.
+var now = time.Now().UTC().Truncate(time.Second)
+
+func days(n int) time.Time {
+	return now.AddDate(0, 0, n)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createUser creates a manager.
+func createUser(t *testing.T, s Stores, username string, createdAt time.Time) *models.User {
+	t.Helper()
+	u := &models.User{
+		ID:           "user-" + username,
+		Username:     username,
+		Name:         "User " + username,
+		PasswordHash: "hash",
+		Role:         models.RoleManager,
+		CreatedAt:    createdAt,
+		UpdatedAt:    createdAt,
+	}
+	check(t, s.Users.Create(u))
+	return u
+}
+
+// createEvent creates a published event open to registrations, updated by
+// edit first if not nil.
+func createEvent(t *testing.T, s Stores, slug string, date time.Time, edit func(e *models.Event)) *models.Event {
+	t.Helper()
+	if u, _ := s.Users.GetByID("user-owner"); u == nil {
+		createUser(t, s, "owner", now)
+	}
+	e := &models.Event{
+		ID:                 "event-" + slug,
+		Title:              "Event " + slug,
+		Slug:               slug,
+		EventDate:          date,
+		AttendeeListPublic: true,
+		RegistrationOpen:   true,
+		DuplicatePolicy:    models.DuplicateAllow,
+		Status:             models.EventPublished,
+		CreatedBy:          "user-owner",
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	if edit != nil {
+		edit(e)
+	}
+	check(t, s.Events.Create(e))
+	return e
+}
+
+// createRegistration creates a confirmed registration with the companions.
+func createRegistration(t *testing.T, s Stores, eventID, name string, registeredAt time.Time, companions ...string) *models.Registration {
+	t.Helper()
+	r := &models.Registration{
+		ID:           "reg-" + name,
+		EventID:      eventID,
+		Name:         name,
+		Email:        name + "@example.org",
+		CancelToken:  "token-" + name,
+		Status:       models.StatusConfirmed,
+		Seats:        1 + len(companions),
+		RegisteredAt: registeredAt,
+	}
+	for i, c := range companions {
+		r.Companions = append(r.Companions, models.Companion{ID: fmt.Sprintf("comp-%s-%d", name, i), Name: c, Position: i})
+	}
+	check(t, s.Registrations.Create(r))
+	return r
+}
+
+// slugs returns the slugs of the events.
+func slugs(events []models.Event) []string {
+	var slugs []string
+	for _, e := range events {
+		slugs = append(slugs, e.Slug)
+	}
+	return slugs
+}
+
+// names returns the names of the registrations.
+func names(regs []models.Registration) []string {
+	var names []string
+	for _, r := range regs {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func equal[T comparable](t *testing.T, what string, got, want []T) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+// sameSet reports whether a and b hold the same elements, in any order.
+func sameSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+func testUsers(t *testing.T, s Stores) {
+	if u, err := s.Users.GetByUsername("alice"); err != nil || u != nil {
+		t.Fatalf("GetByUsername of a missing user = %v, %v, want nil", u, err)
+	}
+	createUser(t, s, "bob", days(-2))
+	alice := createUser(t, s, "alice", days(-1))
+	if err := s.Users.Create(&models.User{ID: "user-other", Username: "alice", PasswordHash: "hash", Role: models.RoleManager}); err == nil {
+		t.Error("created a user with a taken username")
+	}
+
+	u, err := s.Users.GetByUsername("alice")
+	check(t, err)
+	if u == nil || u.ID != alice.ID || u.Name != alice.Name || u.Role != models.RoleManager || !u.CreatedAt.Equal(alice.CreatedAt) {
+		t.Fatalf("GetByUsername = %+v, want %+v", u, alice)
+	}
+	users, err := s.Users.List()
+	check(t, err)
+	if len(users) != 2 || users[0].Username != "bob" || users[1].Username != "alice" {
+		t.Errorf("List = %+v, want bob then alice", users)
+	}
+
+	check(t, s.Users.UpdatePassword(alice.ID, "new hash"))
+	check(t, s.Users.UpdateRole(alice.ID, models.RoleAdmin))
+	u, err = s.Users.GetByID(alice.ID)
+	check(t, err)
+	if u.PasswordHash != "new hash" || u.Role != models.RoleAdmin {
+		t.Errorf("updated user = %+v", u)
+	}
+
+	check(t, s.Users.Delete(alice.ID))
+	if u, err := s.Users.GetByID(alice.ID); err != nil || u != nil {
+		t.Errorf("GetByID of a deleted user = %v, %v, want nil", u, err)
+	}
+	if n, err := s.Users.Count(); err != nil || n != 1 {
+		t.Errorf("Count = %d, %v, want 1", n, err)
+	}
+}
+
+func testSettings(t *testing.T, s Stores) {
+	if v, err := s.Settings.Get("site_name"); err != nil || v != "LibreRegistration" {
+		t.Errorf("default site_name = %q, %v", v, err)
+	}
+	if v, err := s.Settings.Get("missing"); err != nil || v != "" {
+		t.Errorf("Get of a missing setting = %q, %v, want empty", v, err)
+	}
+	check(t, s.Settings.Set("site_name", "Toulibre"))
+	check(t, s.Settings.Set("contact_email", "contact@example.org"))
+	if v, err := s.Settings.Get("site_name"); err != nil || v != "Toulibre" {
+		t.Errorf("site_name = %q, %v, want Toulibre", v, err)
+	}
+	settings, err := s.Settings.GetAll()
+	check(t, err)
+	var keys []string
+	for _, st := range settings {
+		keys = append(keys, st.Key)
+	}
+	equal(t, "setting keys", keys, []string{"accent_color", "captcha_provider", "contact_email", "site_name"})
+}
+
+func testEvents(t *testing.T, s Stores) {
+	venue := &models.Venue{ID: "venue-hall", Name: "Hall", Slug: "hall", CreatedAt: now, UpdatedAt: now}
+	check(t, s.Venues.Create(venue))
+	e := createEvent(t, s, "meetup", days(7), func(e *models.Event) {
+		e.Description = "Monthly meetup"
+		e.EndDate = ptr(days(8))
+		e.MaxCapacity = ptr(30)
+		e.Latitude, e.Longitude = ptr(43.6), ptr(1.44)
+		e.VenueID = &venue.ID
+		e.ApprovalRequired = true
+		e.MaxCompanions = 2
+		e.PreviewToken = "preview"
+		e.ImagePath = "image.png"
+	})
+	if err := s.Events.Create(&models.Event{ID: "event-other", Title: "Other", Slug: "meetup", EventDate: days(1),
+		DuplicatePolicy: models.DuplicateAllow, Status: models.EventPublished, CreatedBy: "user-owner"}); err == nil {
+		t.Error("created an event with a taken slug")
+	}
+
+	got, err := s.Events.GetBySlug("meetup")
+	check(t, err)
+	if got == nil {
+		t.Fatal("GetBySlug = nil")
+	}
+	if got.ID != e.ID || got.Description != e.Description || !got.EventDate.Equal(e.EventDate) ||
+		got.EndDate == nil || !got.EndDate.Equal(*e.EndDate) || got.MaxCapacity == nil || *got.MaxCapacity != 30 ||
+		got.Latitude == nil || *got.Latitude != 43.6 || !got.ApprovalRequired || got.MaxCompanions != 2 ||
+		got.PreviewToken != "preview" || got.Status != models.EventPublished || got.RegistrationDeadline != nil {
+		t.Errorf("GetBySlug = %+v, want %+v", got, e)
+	}
+	if got.VenueName != "Hall" || got.VenueSlug != "hall" {
+		t.Errorf("venue of the event = %q, %q, want Hall, hall", got.VenueName, got.VenueSlug)
+	}
+	if ok, err := s.Events.SlugExists("meetup"); err != nil || !ok {
+		t.Errorf("SlugExists = %v, %v, want true", ok, err)
+	}
+	if e, err := s.Events.GetByID("missing"); err != nil || e != nil {
+		t.Errorf("GetByID of a missing event = %v, %v, want nil", e, err)
+	}
+	if ok, err := s.Events.UploadInUse("image.png"); err != nil || !ok {
+		t.Errorf("UploadInUse = %v, %v, want true", ok, err)
+	}
+
+	e.Title = "Meetup"
+	e.Slug = "monthly-meetup"
+	e.EndDate = nil
+	e.VenueID = nil
+	e.Status = models.EventArchived
+	check(t, s.Events.Update(e))
+	got, err = s.Events.GetByID(e.ID)
+	check(t, err)
+	if got.Title != "Meetup" || got.Slug != "monthly-meetup" || got.EndDate != nil || got.VenueID != nil ||
+		got.VenueName != "" || got.Status != models.EventArchived || got.CreatedBy != "user-owner" {
+		t.Errorf("updated event = %+v", got)
+	}
+	if ok, err := s.Events.SlugExists("meetup"); err != nil || ok {
+		t.Errorf("SlugExists of the former slug = %v, %v, want false", ok, err)
+	}
+}
+
+func testEventLists(t *testing.T, s Stores) {
+	createEvent(t, s, "past", days(-3), nil)
+	createEvent(t, s, "later", days(20), nil)
+	createEvent(t, s, "soon", days(2), nil)
+	createEvent(t, s, "draft", days(5), func(e *models.Event) { e.Status = models.EventDraft })
+	createEvent(t, s, "ongoing", days(-1), func(e *models.Event) { e.EndDate = ptr(days(1)) })
+
+	events, err := s.Events.ListUpcoming()
+	check(t, err)
+	equal(t, "ListUpcoming", slugs(events), []string{"ongoing", "soon", "later"})
+	events, err = s.Events.ListAll()
+	check(t, err)
+	equal(t, "ListAll", slugs(events), []string{"later", "draft", "soon", "ongoing", "past"})
+	events, err = s.Events.ListBetween(days(-1), days(5))
+	check(t, err)
+	equal(t, "ListBetween", slugs(events), []string{"ongoing", "soon"})
+	events, err = s.Events.ListEndedBefore(now)
+	check(t, err)
+	equal(t, "ListEndedBefore", slugs(events), []string{"past"})
+
+	if n, err := s.Events.Count(); err != nil || n != 5 {
+		t.Errorf("Count = %d, %v, want 5", n, err)
+	}
+	if n, err := s.Events.CountUpcoming(); err != nil || n != 4 {
+		t.Errorf("CountUpcoming = %d, %v, want 4", n, err)
+	}
+
+	// Events are to come until they end
+	all := models.Page{Number: 1, Size: 10}
+	events, _, err = s.Events.ListPage(models.EventFilter{Upcoming: ptr(true), Sort: "date"}, all)
+	check(t, err)
+	equal(t, "upcoming events", slugs(events), []string{"ongoing", "soon", "draft", "later"})
+	events, _, err = s.Events.ListPage(models.EventFilter{Upcoming: ptr(false)}, all)
+	check(t, err)
+	equal(t, "past events", slugs(events), []string{"past"})
+}
+
+func testEventPage(t *testing.T, s Stores) {
+	createUser(t, s, "other", now)
+	createEvent(t, s, "a", days(1), func(e *models.Event) { e.Title = "Install party" })
+	createEvent(t, s, "b", days(2), func(e *models.Event) { e.Title = "Linux workshop"; e.Description = "Bring your laptop" })
+	createEvent(t, s, "c", days(-2), func(e *models.Event) { e.Title = "Conference"; e.RegistrationOpen = false })
+	createEvent(t, s, "d", days(3), func(e *models.Event) {
+		e.Title = "Barbecue"
+		e.Status = models.EventDraft
+		e.CreatedBy = "user-other"
+	})
+	createRegistration(t, s, "event-a", "alice", now, "carol")
+
+	list := func(f models.EventFilter, p models.Page) ([]string, int) {
+		t.Helper()
+		events, total, err := s.Events.ListPage(f, p)
+		check(t, err)
+		return slugs(events), total
+	}
+	all := models.Page{Number: 1, Size: 10}
+
+	got, total := list(models.EventFilter{}, all)
+	equal(t, "all events", got, []string{"d", "b", "a", "c"})
+	if total != 4 {
+		t.Errorf("total = %d, want 4", total)
+	}
+	got, total = list(models.EventFilter{}, models.Page{Number: 2, Size: 3})
+	equal(t, "second page", got, []string{"c"})
+	if total != 4 {
+		t.Errorf("total of the second page = %d, want 4", total)
+	}
+
+	got, _ = list(models.EventFilter{Query: "lapt"}, all)
+	equal(t, "search of a word start", got, []string{"b"})
+	got, _ = list(models.EventFilter{Query: "linux laptop"}, all)
+	equal(t, "search of several words", got, []string{"b"})
+	got, total = list(models.EventFilter{Query: "linux party"}, all)
+	if len(got) != 0 || total != 0 {
+		t.Errorf("search of words from different events = %v, %d, want none", got, total)
+	}
+	got, _ = list(models.EventFilter{Query: "!?"}, all)
+	if len(got) != 0 {
+		t.Errorf("search without words = %v, want none", got)
+	}
+
+	got, _ = list(models.EventFilter{Statuses: []models.EventStatus{models.EventDraft}}, all)
+	equal(t, "drafts", got, []string{"d"})
+	got, _ = list(models.EventFilter{Upcoming: ptr(false)}, all)
+	equal(t, "past events", got, []string{"c"})
+	got, _ = list(models.EventFilter{Open: ptr(false)}, all)
+	equal(t, "closed events", got, []string{"c"})
+	got, _ = list(models.EventFilter{CreatedBy: "user-other"}, all)
+	equal(t, "events of a user", got, []string{"d"})
+	got, _ = list(models.EventFilter{From: ptr(days(1)), To: ptr(days(3))}, all)
+	equal(t, "events in a range", got, []string{"b", "a"})
+
+	got, _ = list(models.EventFilter{Sort: "title"}, all)
+	equal(t, "by title", got, []string{"d", "c", "a", "b"})
+	got, _ = list(models.EventFilter{Sort: "date", Desc: true}, all)
+	equal(t, "by date, latest first", got, []string{"d", "b", "a", "c"})
+	got, _ = list(models.EventFilter{Sort: "registrations", Desc: true}, models.Page{Number: 1, Size: 1})
+	equal(t, "most registrations", got, []string{"a"})
+}
+
+func testEventSchedule(t *testing.T, s Stores) {
+	createEvent(t, s, "due", days(5), func(e *models.Event) {
+		e.Status = models.EventDraft
+		e.PublishAt = ptr(days(-1))
+		e.RegistrationOpen = false
+		e.RegistrationOpensAt = ptr(days(-1))
+	})
+	createEvent(t, s, "later", days(5), func(e *models.Event) {
+		e.Status = models.EventDraft
+		e.PublishAt = ptr(days(1))
+		e.RegistrationOpen = false
+		e.RegistrationOpensAt = ptr(days(1))
+	})
+
+	if n, err := s.Events.PublishDue(now); err != nil || n != 1 {
+		t.Errorf("PublishDue = %d, %v, want 1", n, err)
+	}
+	if n, err := s.Events.OpenRegistrationsDue(now); err != nil || n != 1 {
+		t.Errorf("OpenRegistrationsDue = %d, %v, want 1", n, err)
+	}
+	e, err := s.Events.GetBySlug("due")
+	check(t, err)
+	if e.Status != models.EventPublished || e.PublishAt != nil || !e.RegistrationOpen || e.RegistrationOpensAt != nil ||
+		e.RegistrationsOpenedAt == nil || !e.RegistrationsOpenedAt.Equal(now) {
+		t.Errorf("due event = %+v", e)
+	}
+	e, err = s.Events.GetBySlug("later")
+	check(t, err)
+	if e.Status != models.EventDraft || e.RegistrationOpen {
+		t.Errorf("event not due = %+v", e)
+	}
+	if n, err := s.Events.PublishDue(now); err != nil || n != 0 {
+		t.Errorf("second PublishDue = %d, %v, want 0", n, err)
+	}
+}
+
+func testEventDelete(t *testing.T, s Stores) {
+	e := createEvent(t, s, "deleted", days(1), nil)
+	other := createEvent(t, s, "kept", days(1), nil)
+	check(t, s.Sessions.Create(&models.Session{ID: "session-a", EventID: e.ID, Title: "Talk", StartsAt: days(1), EndsAt: days(1), CreatedAt: now}))
+	r := createRegistration(t, s, e.ID, "alice", now, "carol")
+	createRegistration(t, s, other.ID, "bob", now)
+	check(t, s.Tags.SetEventTags(e.ID, []models.Tag{{ID: "tag-linux", Name: "Linux", Slug: "linux"}}))
+
+	check(t, s.Events.Delete(e.ID))
+	if got, err := s.Events.GetByID(e.ID); err != nil || got != nil {
+		t.Errorf("GetByID of a deleted event = %v, %v, want nil", got, err)
+	}
+	if got, err := s.Registrations.GetByID(r.ID); err != nil || got != nil {
+		t.Errorf("registration to a deleted event = %v, %v, want nil", got, err)
+	}
+	if got, err := s.Sessions.GetByID("session-a"); err != nil || got != nil {
+		t.Errorf("session of a deleted event = %v, %v, want nil", got, err)
+	}
+	regs, err := s.Registrations.ListAll()
+	check(t, err)
+	equal(t, "remaining registrations", names(regs), []string{"bob"})
+	tags, err := s.Tags.ListAll()
+	check(t, err)
+	if len(tags) != 1 || tags[0].EventCount != 0 {
+		t.Errorf("tags = %+v, want linux without events", tags)
+	}
+}
+
+func testRegistrations(t *testing.T, s Stores) {
+	e := createEvent(t, s, "meetup", days(7), nil)
+	check(t, s.Sessions.Create(&models.Session{ID: "session-a", EventID: e.ID, Title: "A", StartsAt: days(7), EndsAt: days(7), CreatedAt: now}))
+	check(t, s.Sessions.Create(&models.Session{ID: "session-b", EventID: e.ID, Title: "B", StartsAt: days(7), EndsAt: days(7), CreatedAt: now}))
+
+	alice := &models.Registration{
+		ID:           "reg-alice",
+		EventID:      e.ID,
+		Name:         "alice",
+		Email:        "alice@example.org",
+		Comment:      "vegetarian",
+		CancelToken:  "token-alice",
+		Status:       models.StatusConfirmed,
+		Seats:        3,
+		RegisteredAt: days(-2),
+		Companions: []models.Companion{
+			{ID: "comp-2", Name: "dave", Position: 1},
+			{ID: "comp-1", Name: "carol", Position: 0},
+		},
+		SessionIDs: []string{"session-a", "session-b"},
+	}
+	check(t, s.Registrations.Create(alice))
+	bob := createRegistration(t, s, e.ID, "bob", days(-1))
+	check(t, s.Registrations.UpdateStatus(bob.ID, models.StatusPending))
+
+	r, err := s.Registrations.GetByID(alice.ID)
+	check(t, err)
+	if r == nil || r.Email != alice.Email || r.Comment != "vegetarian" || r.Seats != 3 || r.Status != models.StatusConfirmed ||
+		!r.RegisteredAt.Equal(alice.RegisteredAt) || r.CancelToken != "token-alice" {
+		t.Fatalf("GetByID = %+v, want %+v", r, alice)
+	}
+	if len(r.Companions) != 2 || r.Companions[0].Name != "carol" || r.Companions[1].Name != "dave" || r.Companions[0].RegistrationID != alice.ID {
+		t.Errorf("companions = %+v, want carol then dave", r.Companions)
+	}
+	if !sameSet(r.SessionIDs, alice.SessionIDs) {
+		t.Errorf("sessions = %v, want %v", r.SessionIDs, alice.SessionIDs)
+	}
+	r, err = s.Registrations.GetByCancelToken("token-alice")
+	check(t, err)
+	if r == nil || r.ID != alice.ID || len(r.Companions) != 2 {
+		t.Errorf("GetByCancelToken = %+v", r)
+	}
+	if r, err := s.Registrations.GetByCancelToken("missing"); err != nil || r != nil {
+		t.Errorf("GetByCancelToken of a missing token = %v, %v, want nil", r, err)
+	}
+
+	regs, err := s.Registrations.ListByEvent(e.ID)
+	check(t, err)
+	equal(t, "ListByEvent", names(regs), []string{"alice", "bob"})
+	if n, err := s.Registrations.CountByEvent(e.ID); err != nil || n != 3 {
+		t.Errorf("CountByEvent = %d, %v, want 3", n, err)
+	}
+	if n, err := s.Registrations.TotalCount(); err != nil || n != 3 {
+		t.Errorf("TotalCount = %d, %v, want 3", n, err)
+	}
+	got, err := s.Events.GetByID(e.ID)
+	check(t, err)
+	if got.RegistrationCount != 3 || got.PendingCount != 1 {
+		t.Errorf("event counts = %d, %d, want 3, 1", got.RegistrationCount, got.PendingCount)
+	}
+
+	other := createEvent(t, s, "other", days(8), nil)
+	alice.EventID = other.ID
+	alice.Name = "alice smith"
+	alice.Seats = 2
+	alice.Companions = alice.Companions[:1]
+	alice.CancelToken = "changed"
+	check(t, s.Registrations.Update(alice))
+	r, err = s.Registrations.GetByID(alice.ID)
+	check(t, err)
+	if r.EventID != other.ID || r.Name != "alice smith" || r.Seats != 2 || len(r.Companions) != 1 || r.CancelToken != "token-alice" {
+		t.Errorf("updated registration = %+v", r)
+	}
+	if len(r.SessionIDs) != 0 {
+		t.Errorf("sessions of a moved registration = %v, want none", r.SessionIDs)
+	}
+
+	check(t, s.Registrations.Delete(bob.ID))
+	if r, err := s.Registrations.GetByID(bob.ID); err != nil || r != nil {
+		t.Errorf("GetByID of a deleted registration = %v, %v, want nil", r, err)
+	}
+}
+
+func testRegistrationPage(t *testing.T, s Stores) {
+	e := createEvent(t, s, "meetup", days(7), nil)
+	createRegistration(t, s, e.ID, "carol", days(-3))
+	createRegistration(t, s, e.ID, "alice", days(-2))
+	bob := createRegistration(t, s, e.ID, "bob", days(-1))
+	check(t, s.Registrations.UpdateStatus(bob.ID, models.StatusPending))
+	createRegistration(t, s, createEvent(t, s, "other", days(7), nil).ID, "dave", days(-1))
+
+	list := func(f models.RegistrationFilter, p models.Page) ([]string, int) {
+		t.Helper()
+		regs, total, err := s.Registrations.ListPage(e.ID, f, p)
+		check(t, err)
+		return names(regs), total
+	}
+	all := models.Page{Number: 1, Size: 10}
+
+	got, total := list(models.RegistrationFilter{}, all)
+	equal(t, "all registrations", got, []string{"carol", "alice", "bob"})
+	if total != 3 {
+		t.Errorf("total = %d, want 3", total)
+	}
+	got, total = list(models.RegistrationFilter{}, models.Page{Number: 2, Size: 2})
+	equal(t, "second page", got, []string{"bob"})
+	if total != 3 {
+		t.Errorf("total of the second page = %d, want 3", total)
+	}
+	got, _ = list(models.RegistrationFilter{Status: models.StatusPending}, all)
+	equal(t, "pending registrations", got, []string{"bob"})
+	got, _ = list(models.RegistrationFilter{Query: "ali"}, all)
+	equal(t, "search", got, []string{"alice"})
+	got, _ = list(models.RegistrationFilter{Sort: "name"}, all)
+	equal(t, "by name", got, []string{"alice", "bob", "carol"})
+	got, _ = list(models.RegistrationFilter{Sort: "date", Desc: true}, all)
+	equal(t, "by date, latest first", got, []string{"bob", "alice", "carol"})
+}
+
+func testRegistrationCancel(t *testing.T, s Stores) {
+	e := createEvent(t, s, "meetup", days(7), nil)
+	r := createRegistration(t, s, e.ID, "alice", days(-1), "carol")
+
+	check(t, s.Registrations.CancelByToken("missing", now))
+	check(t, s.Registrations.CancelByToken(r.CancelToken, now))
+	if got, err := s.Registrations.GetByID(r.ID); err != nil || got != nil {
+		t.Errorf("GetByID of a cancelled registration = %v, %v, want nil", got, err)
+	}
+	cancellations, err := s.Registrations.ListCancellations()
+	check(t, err)
+	if len(cancellations) != 1 {
+		t.Fatalf("cancellations = %+v, want 1", cancellations)
+	}
+	c := cancellations[0]
+	if c.RegistrationID != r.ID || c.EventID != e.ID || c.Email != r.Email || c.Seats != 2 ||
+		!c.RegisteredAt.Equal(r.RegisteredAt) || !c.CancelledAt.Equal(now) {
+		t.Errorf("cancellation = %+v", c)
+	}
+	if n, err := s.Registrations.CountByEvent(e.ID); err != nil || n != 0 {
+		t.Errorf("CountByEvent = %d, %v, want 0", n, err)
+	}
+}
+
+func testRegistrationCreateMany(t *testing.T, s Stores) {
+	e := createEvent(t, s, "meetup", days(7), nil)
+	createRegistration(t, s, e.ID, "alice", days(-1))
+
+	regs := []models.Registration{
+		{ID: "reg-bob", EventID: e.ID, Name: "bob", CancelToken: "token-bob", Status: models.StatusConfirmed, Seats: 1, RegisteredAt: now},
+		{ID: "reg-carol", EventID: e.ID, Name: "carol", CancelToken: "token-alice", Status: models.StatusConfirmed, Seats: 1, RegisteredAt: now},
+	}
+	if err := s.Registrations.CreateMany(regs); err == nil {
+		t.Error("created a registration with a taken cancel token")
+	}
+	all, err := s.Registrations.ListAll()
+	check(t, err)
+	equal(t, "registrations after a failed import", names(all), []string{"alice"})
+
+	regs[1].CancelToken = "token-carol"
+	check(t, s.Registrations.CreateMany(regs))
+	all, err = s.Registrations.ListAll()
+	check(t, err)
+	if len(all) != 3 {
+		t.Errorf("registrations = %v, want 3", names(all))
+	}
+}
+
+func testRegistrationResend(t *testing.T, s Stores) {
+	e := createEvent(t, s, "meetup", days(7), nil)
+	r := createRegistration(t, s, e.ID, "alice", days(-1))
+
+	mark := func(at time.Time, want bool) {
+		t.Helper()
+		ok, err := s.Registrations.MarkResent(r.ID, at, at.Add(-5*time.Minute))
+		check(t, err)
+		if ok != want {
+			t.Errorf("MarkResent at %v = %v, want %v", at.Sub(now), ok, want)
+		}
+	}
+	mark(now, true)
+	mark(now.Add(time.Minute), false)
+	mark(now.Add(5*time.Minute), false)
+	mark(now.Add(6*time.Minute), true)
+
+	if ok, err := s.Registrations.MarkResent("missing", now, now); err != nil || ok {
+		t.Errorf("MarkResent of a missing registration = %v, %v, want false", ok, err)
+	}
+}
+
+func testRegistrationCounts(t *testing.T, s Stores) {
+	e := createEvent(t, s, "meetup", days(7), nil)
+	other := createEvent(t, s, "other", days(7), nil)
+	createRegistration(t, s, e.ID, "alice", days(-3), "carol")
+	createRegistration(t, s, e.ID, "bob", days(-2))
+	pending := createRegistration(t, s, e.ID, "dave", days(-1), "erin", "frank")
+	check(t, s.Registrations.UpdateStatus(pending.ID, models.StatusPending))
+	rejected := createRegistration(t, s, e.ID, "eve", now)
+	check(t, s.Registrations.UpdateStatus(rejected.ID, models.StatusRejected))
+	createRegistration(t, s, other.ID, "grace", now)
+
+	counts, err := s.Registrations.CountByStatus(e.ID)
+	check(t, err)
+	want := models.RegistrationCounts{
+		models.StatusConfirmed: {Registrations: 2, Seats: 3},
+		models.StatusPending:   {Registrations: 1, Seats: 3},
+		models.StatusRejected:  {Registrations: 1, Seats: 1},
+	}
+	if !maps.Equal(counts, want) {
+		t.Errorf("CountByStatus = %v, want %v", counts, want)
+	}
+	if counts, err := s.Registrations.CountByStatus("missing"); err != nil || len(counts) != 0 {
+		t.Errorf("CountByStatus of a missing event = %v, %v, want none", counts, err)
+	}
+
+	regs, err := s.Registrations.ListIdentities(e.ID)
+	check(t, err)
+	equal(t, "ListIdentities", names(regs), []string{"alice", "bob", "dave"})
+	if len(regs) > 0 && (regs[0].ID != "reg-alice" || regs[0].Email != "alice@example.org") {
+		t.Errorf("identity = %+v, want the ID and email of alice", regs[0])
+	}
+}
+
+func testSessions(t *testing.T, s Stores) {
+	e := createEvent(t, s, "meetup", days(7), nil)
+	at := days(7)
+	sessions := []models.Session{
+		{ID: "session-c", EventID: e.ID, Title: "Closing", StartsAt: at.Add(2 * time.Hour), EndsAt: at.Add(3 * time.Hour)},
+		{ID: "session-b", EventID: e.ID, Title: "Workshop", Room: "b", StartsAt: at, EndsAt: at.Add(time.Hour), MaxCapacity: ptr(1)},
+		{ID: "session-a", EventID: e.ID, Title: "Talk", Speaker: "dave", Room: "a", StartsAt: at, EndsAt: at.Add(time.Hour)},
+	}
+	for i := range sessions {
+		sessions[i].CreatedAt = now
+		check(t, s.Sessions.Create(&sessions[i]))
+	}
+	alice := &models.Registration{ID: "reg-alice", EventID: e.ID, Name: "alice", CancelToken: "token-alice", Status: models.StatusConfirmed,
+		Seats: 1, RegisteredAt: days(-2), SessionIDs: []string{"session-b"}}
+	bob := &models.Registration{ID: "reg-bob", EventID: e.ID, Name: "bob", CancelToken: "token-bob", Status: models.StatusPending,
+		Seats: 1, RegisteredAt: days(-1), SessionIDs: []string{"session-b"}}
+	check(t, s.Registrations.CreateMany([]models.Registration{*alice, *bob}))
+
+	list, err := s.Sessions.ListByEvent(e.ID)
+	check(t, err)
+	var ids []string
+	for _, se := range list {
+		ids = append(ids, se.ID)
+	}
+	equal(t, "ListByEvent", ids, []string{"session-a", "session-b", "session-c"})
+
+	se, err := s.Sessions.GetByID("session-b")
+	check(t, err)
+	if se == nil || se.RegistrationCount != 1 || !se.Full() || !se.StartsAt.Equal(at) {
+		t.Errorf("GetByID = %+v, want a full session", se)
+	}
+	check(t, s.Registrations.UpdateStatus(bob.ID, models.StatusConfirmed))
+	attendees, err := s.Sessions.AttendeeNames(e.ID)
+	check(t, err)
+	equal(t, "attendees", attendees["session-b"], []string{"alice", "bob"})
+	if len(attendees) != 1 {
+		t.Errorf("AttendeeNames = %v, want session-b only", attendees)
+	}
+
+	se.Title = "Hands-on workshop"
+	se.MaxCapacity = nil
+	check(t, s.Sessions.Update(se))
+	se, err = s.Sessions.GetByID("session-b")
+	check(t, err)
+	if se.Title != "Hands-on workshop" || se.MaxCapacity != nil || se.Full() {
+		t.Errorf("updated session = %+v", se)
+	}
+
+	check(t, s.Sessions.Delete("session-b"))
+	if se, err := s.Sessions.GetByID("session-b"); err != nil || se != nil {
+		t.Errorf("GetByID of a deleted session = %v, %v, want nil", se, err)
+	}
+	r, err := s.Registrations.GetByID(alice.ID)
+	check(t, err)
+	if r == nil || len(r.SessionIDs) != 0 {
+		t.Errorf("registration to a deleted session = %+v, want kept without sessions", r)
+	}
+}
+
+func testSessionReplace(t *testing.T, s Stores) {
+	e := createEvent(t, s, "meetup", days(7), nil)
+	other := createEvent(t, s, "other", days(7), nil)
+	at := days(7)
+	check(t, s.Sessions.Create(&models.Session{ID: "session-a", EventID: e.ID, Title: "A", StartsAt: at, EndsAt: at, CreatedAt: now}))
+	check(t, s.Sessions.Create(&models.Session{ID: "session-b", EventID: e.ID, Title: "B", StartsAt: at, EndsAt: at, CreatedAt: now}))
+	check(t, s.Sessions.Create(&models.Session{ID: "session-x", EventID: other.ID, Title: "X", StartsAt: at, EndsAt: at, CreatedAt: now}))
+
+	agenda := []models.Session{
+		{ID: "session-a", EventID: e.ID, Title: "A renamed", StartsAt: at, EndsAt: at, CreatedAt: now},
+		{ID: "session-c", EventID: e.ID, Title: "C", StartsAt: at.Add(time.Hour), EndsAt: at.Add(time.Hour), CreatedAt: now},
+	}
+	check(t, s.Sessions.Replace(e.ID, agenda))
+	list, err := s.Sessions.ListByEvent(e.ID)
+	check(t, err)
+	var titles []string
+	for _, se := range list {
+		titles = append(titles, se.Title)
+	}
+	equal(t, "agenda", titles, []string{"A renamed", "C"})
+
+	taken := append(agenda, models.Session{ID: "session-x", EventID: e.ID, Title: "X", StartsAt: at, EndsAt: at, CreatedAt: now})
+	if err := s.Sessions.Replace(e.ID, taken); err == nil {
+		t.Error("replaced an agenda with a session of another event")
+	}
+	se, err := s.Sessions.GetByID("session-x")
+	check(t, err)
+	if se == nil || se.EventID != other.ID || se.Title != "X" {
+		t.Errorf("session of another event = %+v, want unchanged", se)
+	}
+	list, err = s.Sessions.ListByEvent(e.ID)
+	check(t, err)
+	if len(list) != 2 {
+		t.Errorf("agenda after a failed replacement = %+v, want unchanged", list)
+	}
+}
+
+func testTags(t *testing.T, s Stores) {
+	a := createEvent(t, s, "a", days(1), nil)
+	b := createEvent(t, s, "b", days(2), nil)
+	past := createEvent(t, s, "past", days(-1), nil)
+	running := createEvent(t, s, "running", days(-1), func(e *models.Event) { e.EndDate = ptr(days(1)) })
+
+	check(t, s.Tags.SetEventTags(a.ID, []models.Tag{
+		{ID: "tag-linux", Name: "linux", Slug: "linux"},
+		{ID: "tag-install", Name: "install party", Slug: "install-party"},
+	}))
+	check(t, s.Tags.SetEventTags(b.ID, []models.Tag{{ID: "tag-new", Name: "linux", Slug: "linux"}}))
+	check(t, s.Tags.SetEventTags(past.ID, []models.Tag{{ID: "tag-old", Name: "archive", Slug: "archive"}}))
+	check(t, s.Tags.SetEventTags(running.ID, []models.Tag{{ID: "tag-festival", Name: "festival", Slug: "festival"}}))
+
+	tag, err := s.Tags.GetBySlug("linux")
+	check(t, err)
+	if tag == nil || tag.ID != "tag-linux" {
+		t.Fatalf("GetBySlug = %+v, want the first linux tag", tag)
+	}
+	if tag, err := s.Tags.GetByID("tag-new"); err != nil || tag != nil {
+		t.Errorf("tag matched by slug was created again: %+v, %v", tag, err)
+	}
+
+	tags, err := s.Tags.ListAll()
+	check(t, err)
+	var got []string
+	for _, tag := range tags {
+		got = append(got, fmt.Sprintf("%s:%d", tag.Slug, tag.EventCount))
+	}
+	equal(t, "ListAll", got, []string{"archive:1", "festival:1", "install-party:1", "linux:2"})
+	tags, err = s.Tags.ListUpcoming()
+	check(t, err)
+	got = nil
+	for _, tag := range tags {
+		got = append(got, tag.Slug)
+	}
+	equal(t, "ListUpcoming", got, []string{"festival", "install-party", "linux"})
+
+	byEvent, err := s.Tags.ListByEvents([]string{a.ID, b.ID, "missing"})
+	check(t, err)
+	if len(byEvent[a.ID]) != 2 || byEvent[a.ID][0].Slug != "install-party" || len(byEvent[b.ID]) != 1 || len(byEvent["missing"]) != 0 {
+		t.Errorf("ListByEvents = %+v", byEvent)
+	}
+	events, err := s.Events.ListUpcomingByTag("tag-linux")
+	check(t, err)
+	equal(t, "ListUpcomingByTag", slugs(events), []string{"a", "b"})
+
+	check(t, s.Tags.SetEventTags(a.ID, nil))
+	byEvent, err = s.Tags.ListByEvents([]string{a.ID})
+	check(t, err)
+	if len(byEvent[a.ID]) != 0 {
+		t.Errorf("tags of an untagged event = %+v, want none", byEvent[a.ID])
+	}
+
+	tag.Name = "gnu/linux"
+	tag.Slug = "archive"
+	if err := s.Tags.Update(tag); err == nil {
+		t.Error("updated a tag to a taken slug")
+	}
+	tag.Slug = "gnu-linux"
+	check(t, s.Tags.Update(tag))
+	if tag, err := s.Tags.GetBySlug("gnu-linux"); err != nil || tag == nil || tag.Name != "gnu/linux" {
+		t.Errorf("updated tag = %+v, %v", tag, err)
+	}
+
+	check(t, s.Tags.Delete(tag.ID))
+	byEvent, err = s.Tags.ListByEvents([]string{b.ID})
+	check(t, err)
+	if len(byEvent[b.ID]) != 0 {
+		t.Errorf("tags of an event after deleting its tag = %+v, want none", byEvent[b.ID])
+	}
+}
+
+func testSeries(t *testing.T, s Stores) {
+	createUser(t, s, "owner", now)
+	sr := &models.Series{
+		ID:          "series-weekly",
+		Title:       "weekly",
+		Slug:        "weekly",
+		Rule:        "FREQ=WEEKLY",
+		StartsAt:    days(1),
+		Exceptions:  []string{"2030-01-01", "2030-01-08"},
+		HorizonDays: 60,
+		CreatedBy:   "user-owner",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	check(t, s.Series.Create(sr))
+	check(t, s.Series.Create(&models.Series{ID: "series-monthly", Title: "monthly", Slug: "monthly", Rule: "FREQ=MONTHLY",
+		StartsAt: days(1), HorizonDays: 90, CreatedBy: "user-owner", CreatedAt: now, UpdatedAt: now}))
+	if err := s.Series.Create(&models.Series{ID: "series-other", Title: "other", Slug: "weekly", Rule: "FREQ=DAILY",
+		StartsAt: days(1), CreatedBy: "user-owner", CreatedAt: now, UpdatedAt: now}); err == nil {
+		t.Error("created a series with a taken slug")
+	}
+
+	got, err := s.Series.GetBySlug("weekly")
+	check(t, err)
+	if got == nil || got.ID != sr.ID || got.Rule != sr.Rule || !got.StartsAt.Equal(sr.StartsAt) || got.HorizonDays != 60 ||
+		!slices.Equal(got.Exceptions, sr.Exceptions) {
+		t.Fatalf("GetBySlug = %+v, want %+v", got, sr)
+	}
+	if got, err := s.Series.GetByID("missing"); err != nil || got != nil {
+		t.Errorf("GetByID of a missing series = %v, %v, want nil", got, err)
+	}
+	series, err := s.Series.ListAll()
+	check(t, err)
+	if len(series) != 2 || series[0].Slug != "monthly" || series[1].Slug != "weekly" {
+		t.Errorf("ListAll = %+v, want monthly then weekly", series)
+	}
+
+	sr.Title = "weekly meetup"
+	sr.Exceptions = nil
+	sr.HorizonDays = 30
+	check(t, s.Series.Update(sr))
+	got, err = s.Series.GetByID(sr.ID)
+	check(t, err)
+	if got.Title != "weekly meetup" || len(got.Exceptions) != 0 || got.HorizonDays != 30 || got.Slug != "weekly" {
+		t.Errorf("updated series = %+v", got)
+	}
+
+	createEvent(t, s, "first", days(1), func(e *models.Event) { e.SeriesID = &sr.ID; e.OccurrenceDate = "2030-01-15" })
+	createEvent(t, s, "past", days(-6), func(e *models.Event) { e.SeriesID = &sr.ID; e.OccurrenceDate = "2030-01-01" })
+	createEvent(t, s, "running", days(-1), func(e *models.Event) {
+		e.SeriesID = &sr.ID
+		e.OccurrenceDate = "2030-01-08"
+		e.EndDate = ptr(days(1))
+	})
+	if err := s.Events.Create(&models.Event{ID: "event-again", Title: "Again", Slug: "again", EventDate: days(1),
+		DuplicatePolicy: models.DuplicateAllow, Status: models.EventPublished, SeriesID: &sr.ID, OccurrenceDate: "2030-01-15",
+		CreatedBy: "user-owner", CreatedAt: now, UpdatedAt: now}); err == nil {
+		t.Error("created an occurrence twice")
+	}
+	events, err := s.Events.ListBySeries(sr.ID)
+	check(t, err)
+	equal(t, "ListBySeries", slugs(events), []string{"past", "running", "first"})
+	if len(events) > 0 && events[0].SeriesSlug != "weekly" {
+		t.Errorf("series slug of an occurrence = %q, want weekly", events[0].SeriesSlug)
+	}
+	events, err = s.Events.ListUpcomingBySeries(sr.ID)
+	check(t, err)
+	equal(t, "ListUpcomingBySeries", slugs(events), []string{"running", "first"})
+
+	check(t, s.Series.Delete(sr.ID))
+	if ok, err := s.Series.SlugExists("weekly"); err != nil || ok {
+		t.Errorf("SlugExists of a deleted series = %v, %v, want false", ok, err)
+	}
+	e, err := s.Events.GetBySlug("first")
+	check(t, err)
+	if e == nil || e.SeriesID != nil || e.OccurrenceDate != "" || e.SeriesSlug != "" {
+		t.Errorf("occurrence of a deleted series = %+v, want a standalone event", e)
+	}
+}
+
+func testVenues(t *testing.T, s Stores) {
+	hall := &models.Venue{
+		ID:            "venue-hall",
+		Name:          "hall",
+		Slug:          "hall",
+		Address:       "1 main street",
+		Latitude:      ptr(43.6),
+		Longitude:     ptr(1.44),
+		Accessibility: "lift",
+		MaxCapacity:   ptr(100),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	check(t, s.Venues.Create(hall))
+	check(t, s.Venues.Create(&models.Venue{ID: "venue-annex", Name: "Annex", Slug: "annex", CreatedAt: now, UpdatedAt: now}))
+	if err := s.Venues.Create(&models.Venue{ID: "venue-other", Name: "Other", Slug: "hall", CreatedAt: now, UpdatedAt: now}); err == nil {
+		t.Error("created a venue with a taken slug")
+	}
+	createEvent(t, s, "soon", days(1), func(e *models.Event) { e.VenueID = &hall.ID })
+	createEvent(t, s, "located", days(2), func(e *models.Event) {
+		e.VenueID = &hall.ID
+		e.Location = "room 2"
+		e.Latitude, e.Longitude = ptr(45.0), ptr(2.0)
+	})
+	createEvent(t, s, "past", days(-1), func(e *models.Event) { e.VenueID = &hall.ID })
+	createEvent(t, s, "running", days(-1), func(e *models.Event) { e.VenueID = &hall.ID; e.EndDate = ptr(days(1)) })
+	createEvent(t, s, "draft", days(1), func(e *models.Event) { e.VenueID = &hall.ID; e.Status = models.EventDraft })
+
+	got, err := s.Venues.GetBySlug("hall")
+	check(t, err)
+	if got == nil || got.Address != hall.Address || got.Accessibility != "lift" || got.MaxCapacity == nil || *got.MaxCapacity != 100 ||
+		got.Latitude == nil || *got.Latitude != 43.6 || got.EventCount != 3 {
+		t.Fatalf("GetBySlug = %+v, want %+v with 3 events", got, hall)
+	}
+	venues, err := s.Venues.ListAll()
+	check(t, err)
+	if len(venues) != 2 || venues[0].Slug != "annex" || venues[1].Slug != "hall" || venues[1].EventCount != 3 {
+		t.Errorf("ListAll = %+v, want annex then hall", venues)
+	}
+	events, err := s.Events.ListUpcomingByVenue(hall.ID)
+	check(t, err)
+	equal(t, "ListUpcomingByVenue", slugs(events), []string{"running", "soon", "located"})
+
+	hall.Name = "great hall"
+	hall.Slug = "great-hall"
+	hall.MaxCapacity = nil
+	check(t, s.Venues.Update(hall))
+	got, err = s.Venues.GetByID(hall.ID)
+	check(t, err)
+	if got.Name != "great hall" || got.Slug != "great-hall" || got.MaxCapacity != nil {
+		t.Errorf("updated venue = %+v", got)
+	}
+	if ok, err := s.Venues.SlugExists("hall"); err != nil || ok {
+		t.Errorf("SlugExists of the former slug = %v, %v, want false", ok, err)
+	}
+
+	check(t, s.Venues.Delete(hall.ID))
+	if got, err := s.Venues.GetByID(hall.ID); err != nil || got != nil {
+		t.Errorf("GetByID of a deleted venue = %v, %v, want nil", got, err)
+	}
+	e, err := s.Events.GetBySlug("soon")
+	check(t, err)
+	if e.VenueID != nil || e.Location != "great hall" || e.Latitude == nil || *e.Latitude != 43.6 || e.Longitude == nil || *e.Longitude != 1.44 {
+		t.Errorf("event at a deleted venue = %+v, want its name and coordinates", e)
+	}
+	e, err = s.Events.GetBySlug("located")
+	check(t, err)
+	if e.VenueID != nil || e.Location != "room 2" || *e.Latitude != 45.0 {
+		t.Errorf("event with its own place at a deleted venue = %+v, want it kept", e)
+	}
+}
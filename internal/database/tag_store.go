@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type TagStore struct {
+	db *DB
+}
+
+func NewTagStore(db *DB) *TagStore {
+	return &TagStore{db: db}
+}
+
+// ListAll returns all the tags by name, with the number of events using them.
+func (s *TagStore) ListAll() ([]models.Tag, error) {
+	return s.listTags(`SELECT t.id, t.name, t.slug, COUNT(et.event_id)
+		FROM tags t LEFT JOIN event_tags et ON et.tag_id = t.id
+		GROUP BY t.id, t.name, t.slug ORDER BY t.name`)
+}
+
+// ListUpcoming returns the tags of the published events to come, by name,
+// with the number of those events.
+func (s *TagStore) ListUpcoming() ([]models.Tag, error) {
+	return s.listTags(`SELECT t.id, t.name, t.slug, COUNT(e.id)
+		FROM tags t
+		JOIN event_tags et ON et.tag_id = t.id
+		JOIN events e ON e.id = et.event_id
+		WHERE `+eventEnd+` >= ? AND e.status = ?
+		GROUP BY t.id, t.name, t.slug ORDER BY t.name`, time.Now(), models.EventPublished)
+}
+
+func (s *TagStore) GetByID(id string) (*models.Tag, error) {
+	return s.getTag("SELECT id, name, slug FROM tags WHERE id = ?", id)
+}
+
+func (s *TagStore) GetBySlug(slug string) (*models.Tag, error) {
+	return s.getTag("SELECT id, name, slug FROM tags WHERE slug = ?", slug)
+}
+
+// ListByEvents returns the tags of each of the events, by name.
+func (s *TagStore) ListByEvents(eventIDs []string) (map[string][]models.Tag, error) {
+	tags := make(map[string][]models.Tag)
+	if len(eventIDs) == 0 {
+		return tags, nil
+	}
+	args := make([]any, len(eventIDs))
+	for i, id := range eventIDs {
+		args[i] = id
+	}
+	rows, err := s.db.Query(`SELECT et.event_id, t.id, t.name, t.slug
+		FROM event_tags et JOIN tags t ON t.id = et.tag_id
+		WHERE et.event_id IN (?`+strings.Repeat(", ?", len(eventIDs)-1)+`)
+		ORDER BY t.name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list event tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID string
+		var t models.Tag
+		if err := rows.Scan(&eventID, &t.ID, &t.Name, &t.Slug); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+		tags[eventID] = append(tags[eventID], t)
+	}
+	return tags, rows.Err()
+}
+
+// SetEventTags replaces the tags of an event. Tags are matched by slug, and
+// created with the given ID when they don't exist yet.
+func (s *TagStore) SetEventTags(eventID string, tags []models.Tag) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM event_tags WHERE event_id = ?", eventID); err != nil {
+		return fmt.Errorf("clear event tags: %w", err)
+	}
+	for _, t := range tags {
+		var id string
+		err := tx.QueryRow("SELECT id FROM tags WHERE slug = ?", t.Slug).Scan(&id)
+		if err == sql.ErrNoRows {
+			id = t.ID
+			_, err = tx.Exec("INSERT INTO tags (id, name, slug) VALUES (?, ?, ?)", id, t.Name, t.Slug)
+		}
+		if err != nil {
+			return fmt.Errorf("create tag: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO event_tags (event_id, tag_id) VALUES (?, ?)", eventID, id); err != nil {
+			return fmt.Errorf("tag event: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *TagStore) Update(t *models.Tag) error {
+	_, err := s.db.Exec("UPDATE tags SET name = ?, slug = ? WHERE id = ?", t.Name, t.Slug, t.ID)
+	if err != nil {
+		return fmt.Errorf("update tag: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a tag from all events and deletes it.
+func (s *TagStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM event_tags WHERE tag_id = ?", id); err != nil {
+		return fmt.Errorf("untag events: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", id); err != nil {
+		return fmt.Errorf("delete tag: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *TagStore) getTag(query string, args ...any) (*models.Tag, error) {
+	var t models.Tag
+	err := s.db.QueryRow(query, args...).Scan(&t.ID, &t.Name, &t.Slug)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get tag: %w", err)
+	}
+	return &t, nil
+}
+
+func (s *TagStore) listTags(query string, args ...any) ([]models.Tag, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Slug, &t.EventCount); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
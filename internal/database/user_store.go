@@ -103,3 +103,14 @@ func (s *UserStore) UpdatePassword(id string, passwordHash string) error {
 	}
 	return nil
 }
+
+func (s *UserStore) UpdateRole(id string, role models.Role) error {
+	_, err := s.db.Exec(
+		"UPDATE users SET role = ?, updated_at = ? WHERE id = ?",
+		role, time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update role: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type VenueStore struct {
+	db *DB
+}
+
+func NewVenueStore(db *DB) *VenueStore {
+	return &VenueStore{db: db}
+}
+
+const venueColumns = `v.id, v.name, v.slug, v.address, v.latitude, v.longitude, v.accessibility,
+		v.max_capacity, v.created_at, v.updated_at,
+		(SELECT COUNT(*) FROM events e WHERE e.venue_id = v.id AND ` + eventEnd + ` >= ? AND e.status = ?)`
+
+func (s *VenueStore) Create(v *models.Venue) error {
+	_, err := s.db.Exec(`INSERT INTO venues
+		(id, name, slug, address, latitude, longitude, accessibility, max_capacity, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		v.ID, v.Name, v.Slug, v.Address, v.Latitude, v.Longitude, v.Accessibility, v.MaxCapacity,
+		v.CreatedAt, v.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create venue: %w", err)
+	}
+	return nil
+}
+
+func (s *VenueStore) Update(v *models.Venue) error {
+	_, err := s.db.Exec(`UPDATE venues SET
+		name = ?, slug = ?, address = ?, latitude = ?, longitude = ?, accessibility = ?, max_capacity = ?, updated_at = ?
+		WHERE id = ?`,
+		v.Name, v.Slug, v.Address, v.Latitude, v.Longitude, v.Accessibility, v.MaxCapacity, v.UpdatedAt, v.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update venue: %w", err)
+	}
+	return nil
+}
+
+func (s *VenueStore) GetByID(id string) (*models.Venue, error) {
+	return s.getVenue("SELECT "+venueColumns+" FROM venues v WHERE v.id = ?", time.Now(), models.EventPublished, id)
+}
+
+func (s *VenueStore) GetBySlug(slug string) (*models.Venue, error) {
+	return s.getVenue("SELECT "+venueColumns+" FROM venues v WHERE v.slug = ?", time.Now(), models.EventPublished, slug)
+}
+
+func (s *VenueStore) SlugExists(slug string) (bool, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM venues WHERE slug = ?", slug).Scan(&count)
+	return count > 0, err
+}
+
+// ListAll returns all the venues by name, with their number of upcoming
+// events.
+func (s *VenueStore) ListAll() ([]models.Venue, error) {
+	rows, err := s.db.Query("SELECT "+venueColumns+" FROM venues v ORDER BY LOWER(v.name)", time.Now(), models.EventPublished)
+	if err != nil {
+		return nil, fmt.Errorf("list venues: %w", err)
+	}
+	defer rows.Close()
+
+	var venues []models.Venue
+	for rows.Next() {
+		v, err := scanVenue(rows)
+		if err != nil {
+			return nil, err
+		}
+		venues = append(venues, *v)
+	}
+	return venues, rows.Err()
+}
+
+// Delete deletes a venue. Its events are detached from it, and keep its name
+// and coordinates unless they had their own.
+func (s *VenueStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE events SET
+		location = CASE WHEN location = '' THEN (SELECT name FROM venues WHERE id = ?) ELSE location END,
+		latitude = CASE WHEN latitude IS NULL OR longitude IS NULL THEN (SELECT latitude FROM venues WHERE id = ?) ELSE latitude END,
+		longitude = CASE WHEN latitude IS NULL OR longitude IS NULL THEN (SELECT longitude FROM venues WHERE id = ?) ELSE longitude END,
+		venue_id = NULL
+		WHERE venue_id = ?`, id, id, id, id); err != nil {
+		return fmt.Errorf("detach events: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM venues WHERE id = ?", id); err != nil {
+		return fmt.Errorf("delete venue: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *VenueStore) getVenue(query string, args ...any) (*models.Venue, error) {
+	v, err := scanVenue(s.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+func scanVenue(row scanner) (*models.Venue, error) {
+	var v models.Venue
+	err := row.Scan(&v.ID, &v.Name, &v.Slug, &v.Address, &v.Latitude, &v.Longitude, &v.Accessibility,
+		&v.MaxCapacity, &v.CreatedAt, &v.UpdatedAt, &v.EventCount)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan venue: %w", err)
+	}
+	return &v, nil
+}
@@ -0,0 +1,283 @@
+// Package frab reads and writes agendas in the Frab (Pentabarf) XML schedule
+// format, used by free software conferences and read by apps such as
+// Giggity or ConfClerk.
+package frab
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+// ErrInvalid is returned for documents that are not Frab schedules.
+var ErrInvalid = errors.New("invalid schedule")
+
+const (
+	dateLayout = "2006-01-02"
+	timeLayout = "15:04"
+)
+
+// Schedule is the root element of a Frab document.
+type Schedule struct {
+	XMLName    xml.Name   `xml:"schedule"`
+	Version    string     `xml:"version,omitempty"`
+	Conference Conference `xml:"conference"`
+	Days       []Day      `xml:"day"`
+}
+
+type Conference struct {
+	Acronym          string `xml:"acronym"`
+	Title            string `xml:"title"`
+	Start            string `xml:"start"`
+	End              string `xml:"end"`
+	Days             int    `xml:"days"`
+	TimeslotDuration string `xml:"timeslot_duration,omitempty"`
+	BaseURL          string `xml:"base_url,omitempty"`
+	TimeZoneName     string `xml:"time_zone_name,omitempty"`
+}
+
+type Day struct {
+	Index int    `xml:"index,attr"`
+	Date  string `xml:"date,attr"`
+	Start string `xml:"start,attr,omitempty"`
+	End   string `xml:"end,attr,omitempty"`
+	Rooms []Room `xml:"room"`
+}
+
+type Room struct {
+	Name   string  `xml:"name,attr"`
+	Events []Event `xml:"event"`
+}
+
+// Event is a session in Frab terms.
+type Event struct {
+	ID          int      `xml:"id,attr"`
+	GUID        string   `xml:"guid,attr,omitempty"`
+	Date        string   `xml:"date,omitempty"`
+	Start       string   `xml:"start"`
+	Duration    string   `xml:"duration"`
+	Room        string   `xml:"room"`
+	Slug        string   `xml:"slug,omitempty"`
+	URL         string   `xml:"url,omitempty"`
+	Title       string   `xml:"title"`
+	Subtitle    string   `xml:"subtitle"`
+	Track       string   `xml:"track"`
+	Type        string   `xml:"type"`
+	Language    string   `xml:"language"`
+	Abstract    string   `xml:"abstract"`
+	Description string   `xml:"description"`
+	Persons     []Person `xml:"persons>person"`
+}
+
+type Person struct {
+	ID   int    `xml:"id,attr,omitempty"`
+	Name string `xml:",chardata"`
+}
+
+// Export returns the schedule of the sessions of an event. url is the
+// address of the public page of the event.
+func Export(event *models.Event, sessions []models.Session, url string) *Schedule {
+	loc := time.Local
+	s := &Schedule{
+		Version: event.UpdatedAt.UTC().Format(time.RFC3339),
+		Conference: Conference{
+			Acronym:          event.Slug,
+			Title:            event.Title,
+			TimeslotDuration: "00:05",
+			BaseURL:          url,
+			TimeZoneName:     loc.String(),
+		},
+	}
+
+	sorted := make([]models.Session, len(sessions))
+	copy(sorted, sessions)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartsAt.Before(sorted[j].StartsAt) })
+
+	persons := make(map[string]int)
+	for i, se := range sorted {
+		start := se.StartsAt.In(loc)
+		date := start.Format(dateLayout)
+		if len(s.Days) == 0 || s.Days[len(s.Days)-1].Date != date {
+			s.Days = append(s.Days, Day{Index: len(s.Days) + 1, Date: date, Start: start.Format(time.RFC3339)})
+		}
+		day := &s.Days[len(s.Days)-1]
+		if end := se.EndsAt.In(loc).Format(time.RFC3339); end > day.End {
+			day.End = end
+		}
+
+		var room *Room
+		for j := range day.Rooms {
+			if day.Rooms[j].Name == se.Room {
+				room = &day.Rooms[j]
+			}
+		}
+		if room == nil {
+			day.Rooms = append(day.Rooms, Room{Name: se.Room})
+			room = &day.Rooms[len(day.Rooms)-1]
+		}
+
+		e := Event{
+			ID:       i + 1,
+			GUID:     se.ID,
+			Date:     start.Format(time.RFC3339),
+			Start:    start.Format(timeLayout),
+			Duration: formatDuration(se.EndsAt.Sub(se.StartsAt)),
+			Room:     se.Room,
+			Title:    se.Title,
+			Abstract: se.Description,
+		}
+		for _, name := range splitSpeakers(se.Speaker) {
+			if _, ok := persons[name]; !ok {
+				persons[name] = len(persons) + 1
+			}
+			e.Persons = append(e.Persons, Person{ID: persons[name], Name: name})
+		}
+		room.Events = append(room.Events, e)
+	}
+
+	for i := range s.Days {
+		sort.SliceStable(s.Days[i].Rooms, func(a, b int) bool { return s.Days[i].Rooms[a].Name < s.Days[i].Rooms[b].Name })
+	}
+	if len(s.Days) > 0 {
+		s.Conference.Start = s.Days[0].Date
+		s.Conference.End = s.Days[len(s.Days)-1].Date
+		s.Conference.Days = len(s.Days)
+	} else {
+		s.Conference.Start = event.EventDate.In(loc).Format(dateLayout)
+		s.Conference.End = s.Conference.Start
+	}
+	return s
+}
+
+// Write writes the schedule as an XML document.
+func (s *Schedule) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Parse reads the sessions of a schedule. Their ID is the GUID of the Frab
+// event, if any. Times without an offset are read in loc.
+func Parse(r io.Reader, loc *time.Location) ([]models.Session, error) {
+	var s Schedule
+	if err := xml.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	var sessions []models.Session
+	for _, day := range s.Days {
+		for _, room := range day.Rooms {
+			for _, e := range room.Events {
+				start, err := eventStart(day, e, loc)
+				if err != nil {
+					return nil, fmt.Errorf("%w: event %q: %v", ErrInvalid, e.Title, err)
+				}
+				duration, err := parseDuration(e.Duration)
+				if err != nil {
+					return nil, fmt.Errorf("%w: event %q: %v", ErrInvalid, e.Title, err)
+				}
+				if strings.TrimSpace(e.Title) == "" {
+					return nil, fmt.Errorf("%w: event %d has no title", ErrInvalid, e.ID)
+				}
+
+				names := make([]string, 0, len(e.Persons))
+				for _, p := range e.Persons {
+					if name := strings.TrimSpace(p.Name); name != "" {
+						names = append(names, name)
+					}
+				}
+				roomName := strings.TrimSpace(e.Room)
+				if roomName == "" {
+					roomName = room.Name
+				}
+				sessions = append(sessions, models.Session{
+					ID:          strings.TrimSpace(e.GUID),
+					Title:       strings.TrimSpace(e.Title),
+					Speaker:     strings.Join(names, ", "),
+					Room:        roomName,
+					Description: description(e),
+					StartsAt:    start,
+					EndsAt:      start.Add(duration),
+				})
+			}
+		}
+	}
+	return sessions, nil
+}
+
+// eventStart returns the start of an event, from its full date if given, or
+// else from the date of its day and its start time.
+func eventStart(day Day, e Event, loc *time.Location) (time.Time, error) {
+	if e.Date != "" {
+		if t, err := time.Parse(time.RFC3339, e.Date); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.ParseInLocation(dateLayout+" "+timeLayout, day.Date+" "+e.Start, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start %q", e.Start)
+	}
+	return t, nil
+}
+
+// parseDuration parses durations written HH:MM or HH:MM:SS.
+func parseDuration(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var d time.Duration
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += time.Duration(n) * units[i]
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// description joins the subtitle, abstract and description of an event.
+func description(e Event) string {
+	var parts []string
+	for _, p := range []string{e.Subtitle, e.Abstract, e.Description} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// splitSpeakers splits the speakers of a session, separated by commas.
+func splitSpeakers(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -1,10 +1,17 @@
 package handlers
 
 import (
-	"encoding/csv"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -18,21 +25,28 @@ import (
 type AdminHandler struct {
 	events        *services.EventService
 	registrations *services.RegistrationService
+	analytics     *services.AnalyticsService
 	auth          *services.AuthService
 	settings      *services.SettingsService
+	uploadDir     string
 }
 
-func NewAdminHandler(events *services.EventService, registrations *services.RegistrationService, auth *services.AuthService, settings *services.SettingsService) *AdminHandler {
-	return &AdminHandler{events: events, registrations: registrations, auth: auth, settings: settings}
+func NewAdminHandler(events *services.EventService, registrations *services.RegistrationService, analytics *services.AnalyticsService, auth *services.AuthService, settings *services.SettingsService, uploadDir string) *AdminHandler {
+	return &AdminHandler{events: events, registrations: registrations, analytics: analytics, auth: auth, settings: settings, uploadDir: uploadDir}
 }
 
 func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	totalEvents, _ := h.events.Count()
 	upcomingEvents, _ := h.events.CountUpcoming()
 	totalRegistrations, _ := h.registrations.TotalCount()
+	analytics, err := h.analytics.Dashboard(time.Now())
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
 
 	siteName, accentColor := h.settings.GetSiteSettings()
-	admin.Dashboard(siteName, accentColor, middleware.GetDisplayName(r), totalEvents, upcomingEvents, totalRegistrations).Render(r.Context(), w)
+	admin.Dashboard(siteName, accentColor, middleware.GetDisplayName(r), totalEvents, upcomingEvents, totalRegistrations, analytics).Render(r.Context(), w)
 }
 
 func (h *AdminHandler) Attendees(w http.ResponseWriter, r *http.Request) {
@@ -43,11 +57,29 @@ func (h *AdminHandler) Attendees(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	regs, err := h.registrations.ListByEvent(id)
+	// The table shows a page of the registrations, the counts above it being
+	// those of the whole list.
+	counts, err := h.registrations.CountByStatus(id)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	duplicates, err := h.registrations.Duplicates(id)
 	if err != nil {
 		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
 		return
 	}
+	params := r.URL.Query()
+	page := requestPage(r, adminPageSize)
+	shown, total, err := h.registrations.ListPage(id, registrationFilter(params), page)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	page.Total = total
+	for i := range shown {
+		shown[i].Duplicate = duplicates[shown[i].ID]
+	}
 
 	siteName, accentColor := h.settings.GetSiteSettings()
 	csrfField := middleware.CSRFTemplateField(r)
@@ -56,7 +88,27 @@ func (h *AdminHandler) Attendees(w http.ResponseWriter, r *http.Request) {
 	if len(flashes) > 0 {
 		flash = flashes[0]
 	}
-	admin.Attendees(event, regs, siteName, accentColor, middleware.GetDisplayName(r), csrfField, flash).Render(r.Context(), w)
+	errorFlashes := middleware.GetFlashes(w, r, "error")
+	errorMsg := ""
+	if len(errorFlashes) > 0 {
+		errorMsg = errorFlashes[0]
+	}
+	admin.Attendees(event, counts, len(duplicates), shown, params, page, labelOptions(), siteName, accentColor, middleware.GetDisplayName(r), csrfField, flash, errorMsg).Render(r.Context(), w)
+}
+
+// registrationFilter reads the filter of the attendee list from the query
+// parameters: q, status, sort and dir (asc or desc).
+func registrationFilter(params url.Values) models.RegistrationFilter {
+	f := models.RegistrationFilter{
+		Query: strings.TrimSpace(params.Get("q")),
+		Sort:  params.Get("sort"),
+		Desc:  params.Get("dir") == "desc",
+	}
+	switch status := models.RegistrationStatus(params.Get("status")); status {
+	case models.StatusConfirmed, models.StatusPending, models.StatusRejected:
+		f.Status = status
+	}
+	return f
 }
 
 func (h *AdminHandler) AttendeesCSV(w http.ResponseWriter, r *http.Request) {
@@ -78,17 +130,411 @@ func (h *AdminHandler) AttendeesCSV(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
 
-	writer := csv.NewWriter(w)
-	writer.Write([]string{
-		i18n.T(ctx, "csv.name"),
-		i18n.T(ctx, "csv.email"),
-		i18n.T(ctx, "csv.comment"),
-		i18n.T(ctx, "csv.registered_at"),
-	})
-	for _, reg := range regs {
-		writer.Write([]string{reg.Name, reg.Email, reg.Comment, i18n.FormatDateTimeCSV(ctx, reg.RegisteredAt)})
-	}
-	writer.Flush()
+	services.WriteAttendeesCSV(ctx, w, regs)
+}
+
+// ReviewAttendees approves or rejects one or more registrations.
+func (h *AdminHandler) ReviewAttendees(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	eventID := chi.URLParam(r, "id")
+	r.ParseForm()
+
+	var status models.RegistrationStatus
+	switch r.PostForm.Get("decision") {
+	case "approve":
+		status = models.StatusConfirmed
+	case "reject":
+		status = models.StatusRejected
+	default:
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusBadRequest)
+		return
+	}
+
+	redirect := fmt.Sprintf("/admin/events/%s/attendees", eventID)
+	n, err := h.registrations.Review(ctx, eventID, r.PostForm["reg_id"], status)
+	switch {
+	case errors.Is(err, services.ErrEventNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrRegistrationFull):
+		middleware.SetFlash(w, r, "error", i18n.Tf(ctx, "flash.review_full_fmt", n))
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	case errors.Is(err, services.ErrSessionFull):
+		middleware.SetFlash(w, r, "error", i18n.Tf(ctx, "flash.review_session_full_fmt", n))
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	case err != nil:
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	if status == models.StatusConfirmed {
+		middleware.SetFlash(w, r, "success", i18n.Tn(ctx, "flash.registrations_approved", n))
+	} else {
+		middleware.SetFlash(w, r, "success", i18n.Tn(ctx, "flash.registrations_rejected", n))
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// NewAttendeeForm shows the form to add an attendee by hand.
+func (h *AdminHandler) NewAttendeeForm(w http.ResponseWriter, r *http.Request) {
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.renderAttendeeForm(w, r, event, &models.Registration{}, "")
+}
+
+// CreateAttendee adds an attendee on behalf of the organizers.
+func (h *AdminHandler) CreateAttendee(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	in := parseAttendeeForm(r)
+	_, err = h.registrations.AddAttendee(ctx, event.ID, in, parseAttendeeOptions(r, ""))
+	if err != nil {
+		reg := &models.Registration{Name: in.Name, Email: in.Email, Comment: in.Comment}
+		h.renderAttendeeFormError(w, r, event, reg, in, err)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(ctx, "flash.attendee_created"))
+	http.Redirect(w, r, fmt.Sprintf("/admin/events/%s/attendees", event.ID), http.StatusFound)
+}
+
+// EditAttendeeForm shows the form to edit or move a registration.
+func (h *AdminHandler) EditAttendeeForm(w http.ResponseWriter, r *http.Request) {
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	reg, err := h.registrations.GetAttendee(event.ID, chi.URLParam(r, "regID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.renderAttendeeForm(w, r, event, reg, "")
+}
+
+// UpdateAttendee saves the changes made to a registration.
+func (h *AdminHandler) UpdateAttendee(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	regID := chi.URLParam(r, "regID")
+
+	in := parseAttendeeForm(r)
+	_, err = h.registrations.UpdateAttendee(ctx, event.ID, regID, in, parseAttendeeOptions(r, ""))
+	if err != nil {
+		if errors.Is(err, services.ErrRegistrationNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		reg := &models.Registration{ID: regID, EventID: event.ID, Name: in.Name, Email: in.Email, Comment: in.Comment}
+		h.renderAttendeeFormError(w, r, event, reg, in, err)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(ctx, "flash.attendee_updated"))
+	http.Redirect(w, r, fmt.Sprintf("/admin/events/%s/attendees", event.ID), http.StatusFound)
+}
+
+// MoveAttendee moves a registration to another event.
+func (h *AdminHandler) MoveAttendee(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	regID := chi.URLParam(r, "regID")
+
+	_, err = h.registrations.MoveAttendee(ctx, event.ID, regID, r.FormValue("target_event"), parseAttendeeOptions(r, "move_"))
+	switch {
+	case errors.Is(err, services.ErrRegistrationNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrRegistrationFull), errors.Is(err, services.ErrDuplicateRegistration), errors.Is(err, services.ErrEventNotFound):
+		reg, getErr := h.registrations.GetAttendee(event.ID, regID)
+		if getErr != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		h.renderAttendeeForm(w, r, event, reg, mapAttendeeError(ctx, err))
+		return
+	case err != nil:
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(ctx, "flash.attendee_moved"))
+	http.Redirect(w, r, fmt.Sprintf("/admin/events/%s/attendees", event.ID), http.StatusFound)
+}
+
+func parseAttendeeForm(r *http.Request) services.AttendeeInput {
+	return services.AttendeeInput{
+		Name:       r.FormValue("name"),
+		Email:      r.FormValue("email"),
+		Comment:    r.FormValue("comment"),
+		Companions: strings.Split(r.FormValue("companions"), "\n"),
+	}
+}
+
+// parseAttendeeOptions reads the option checkboxes, whose names start with
+// prefix on forms holding several sets of options.
+func parseAttendeeOptions(r *http.Request, prefix string) services.AttendeeOptions {
+	return services.AttendeeOptions{
+		BypassCapacity: r.FormValue(prefix+"bypass_capacity") == "true",
+		Notify:         r.FormValue(prefix+"notify") == "true",
+	}
+}
+
+func (h *AdminHandler) renderAttendeeFormError(w http.ResponseWriter, r *http.Request, event *models.Event, reg *models.Registration, in services.AttendeeInput, err error) {
+	ctx := r.Context()
+	switch {
+	case errors.Is(err, services.ErrNameRequired), errors.Is(err, services.ErrInvalidEmail), errors.Is(err, services.ErrRegistrationFull):
+	default:
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	for _, c := range in.Companions {
+		if c = strings.TrimSpace(c); c != "" {
+			reg.Companions = append(reg.Companions, models.Companion{Name: c})
+		}
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	h.renderAttendeeForm(w, r, event, reg, mapAttendeeError(ctx, err))
+}
+
+func (h *AdminHandler) renderAttendeeForm(w http.ResponseWriter, r *http.Request, event *models.Event, reg *models.Registration, errMsg string) {
+	var others []models.Event
+	if reg.ID != "" {
+		all, err := h.events.ListAll()
+		if err != nil {
+			http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+			return
+		}
+		for _, e := range all {
+			if e.ID != event.ID {
+				others = append(others, e)
+			}
+		}
+	}
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	admin.AttendeeForm(event, reg, others, siteName, accentColor, middleware.GetDisplayName(r), csrfField, errMsg).Render(r.Context(), w)
+}
+
+func mapAttendeeError(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(err, services.ErrNameRequired):
+		return i18n.T(ctx, "error.name_required")
+	case errors.Is(err, services.ErrInvalidEmail):
+		return i18n.T(ctx, "import.error.invalid_email")
+	case errors.Is(err, services.ErrRegistrationFull):
+		return i18n.T(ctx, "attendee_form.error.full")
+	case errors.Is(err, services.ErrDuplicateRegistration):
+		return i18n.T(ctx, "attendee_form.error.duplicate")
+	case errors.Is(err, services.ErrEventNotFound):
+		return i18n.T(ctx, "error.event_not_found")
+	default:
+		return i18n.T(ctx, "error.internal")
+	}
+}
+
+// maxImportSize bounds the size of an uploaded attendee CSV file.
+const maxImportSize = 2 << 20
+
+// ImportAttendeesForm shows the CSV upload form of an attendee import.
+func (h *AdminHandler) ImportAttendeesForm(w http.ResponseWriter, r *http.Request) {
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.renderImport(w, r, event, nil, "")
+}
+
+// ImportAttendees previews an uploaded CSV file with the column mapping and
+// options of the form, and imports it once confirmed. The file is posted
+// back with each step so that no state is kept on the server.
+func (h *AdminHandler) ImportAttendees(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 2*maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		h.renderImport(w, r, event, nil, i18n.T(ctx, "import.error.too_large"))
+		return
+	}
+
+	// A new file starts over with the detected mapping and default options
+	var data []byte
+	file, _, err := r.FormFile("file")
+	fresh := err == nil
+	if fresh {
+		defer file.Close()
+		data, err = io.ReadAll(io.LimitReader(file, maxImportSize+1))
+		if err == nil && len(data) > maxImportSize {
+			err = errors.New("file too large")
+		}
+	} else {
+		data, err = base64.StdEncoding.DecodeString(r.FormValue("csv_data"))
+	}
+	if err != nil {
+		h.renderImport(w, r, event, nil, i18n.T(ctx, "import.error.too_large"))
+		return
+	}
+
+	records, err := services.ParseImportCSV(bytes.NewReader(data))
+	if err != nil {
+		h.renderImport(w, r, event, nil, mapImportError(ctx, err))
+		return
+	}
+
+	width := 0
+	for _, record := range records {
+		width = max(width, len(record))
+	}
+	mapping := make([]services.ImportField, width)
+	var opts services.ImportOptions
+	if fresh {
+		detected, found := services.DetectImportMapping(records[0])
+		copy(mapping, detected)
+		opts = services.ImportOptions{
+			DateFormat:     services.DetectImportDateFormat(ctx, records, mapping, found),
+			HasHeader:      found,
+			SkipDuplicates: true,
+		}
+	} else {
+		for i := range mapping {
+			f := services.ImportField(r.FormValue(fmt.Sprintf("map_%d", i)))
+			if slices.Contains(services.ImportFields, f) {
+				mapping[i] = f
+			}
+		}
+		opts = services.ImportOptions{
+			DateFormat:     services.ImportDateFormat(r.FormValue("date_format")),
+			HasHeader:      r.FormValue("has_header") == "true",
+			BypassCapacity: r.FormValue("bypass_capacity") == "true",
+			SkipDuplicates: r.FormValue("skip_duplicates") == "true",
+			SendEmails:     r.FormValue("send_emails") == "true",
+		}
+		if !slices.Contains(services.ImportDateFormats, opts.DateFormat) {
+			opts.DateFormat = services.DetectImportDateFormat(ctx, records, mapping, opts.HasHeader)
+		}
+	}
+
+	preview := &admin.ImportPreview{
+		Data:           base64.StdEncoding.EncodeToString(data),
+		DateFormat:     string(opts.DateFormat),
+		HasDates:       slices.Contains(mapping, services.ImportRegisteredAt),
+		HasHeader:      opts.HasHeader,
+		BypassCapacity: opts.BypassCapacity,
+		SkipDuplicates: opts.SkipDuplicates,
+		SendEmails:     opts.SendEmails,
+	}
+	for _, f := range services.ImportFields {
+		preview.Fields = append(preview.Fields, string(f))
+	}
+	for _, f := range services.ImportDateFormats {
+		preview.DateFormats = append(preview.DateFormats, string(f))
+	}
+	for i, f := range mapping {
+		title := i18n.Tf(ctx, "import.column_fmt", i+1)
+		if opts.HasHeader && i < len(records[0]) && strings.TrimSpace(records[0][i]) != "" {
+			title = records[0][i]
+		}
+		preview.Columns = append(preview.Columns, admin.ImportColumn{Title: title, Field: string(f)})
+	}
+
+	if r.FormValue("action") == "import" {
+		report, err := h.registrations.Import(ctx, event.ID, records, mapping, opts)
+		if err == nil {
+			middleware.SetFlash(w, r, "success", i18n.Tn(ctx, "flash.attendees_imported", report.Imported))
+			http.Redirect(w, r, fmt.Sprintf("/admin/events/%s/attendees", event.ID), http.StatusFound)
+			return
+		}
+		if !errors.Is(err, services.ErrImportNoNameColumn) {
+			http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	report, err := h.registrations.PreviewImport(ctx, event.ID, records, mapping, opts)
+	switch {
+	case errors.Is(err, services.ErrImportNoNameColumn):
+		h.renderImport(w, r, event, preview, mapImportError(ctx, err))
+		return
+	case err != nil:
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	preview.Valid = report.Valid()
+	preview.Seats = report.Seats()
+	preview.Duplicates = report.Duplicates()
+	for _, row := range report.Rows {
+		pr := admin.ImportPreviewRow{Line: row.Line, Registration: row.Registration, Duplicate: row.Duplicate}
+		if row.Err != nil {
+			pr.Error = mapImportError(ctx, row.Err)
+		}
+		if errors.Is(row.Err, services.ErrImportInvalidDate) {
+			pr.Registration.RegisteredAt = time.Time{} // not the time of the import
+		}
+		preview.Rows = append(preview.Rows, pr)
+	}
+	h.renderImport(w, r, event, preview, "")
+}
+
+func (h *AdminHandler) renderImport(w http.ResponseWriter, r *http.Request, event *models.Event, preview *admin.ImportPreview, errMsg string) {
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	if errMsg != "" && preview == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	admin.AttendeeImport(event, preview, siteName, accentColor, middleware.GetDisplayName(r), csrfField, errMsg).Render(r.Context(), w)
+}
+
+func mapImportError(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(err, services.ErrImportInvalidCSV):
+		return i18n.T(ctx, "import.error.invalid_csv")
+	case errors.Is(err, services.ErrImportEmpty):
+		return i18n.T(ctx, "import.error.empty")
+	case errors.Is(err, services.ErrImportTooManyRows):
+		return i18n.Tf(ctx, "import.error.too_many_rows_fmt", services.MaxImportRows)
+	case errors.Is(err, services.ErrImportNoNameColumn):
+		return i18n.T(ctx, "import.error.no_name_column")
+	case errors.Is(err, services.ErrNameRequired):
+		return i18n.T(ctx, "error.name_required")
+	case errors.Is(err, services.ErrInvalidEmail):
+		return i18n.T(ctx, "import.error.invalid_email")
+	case errors.Is(err, services.ErrImportInvalidDate):
+		return i18n.T(ctx, "import.error.invalid_date")
+	case errors.Is(err, services.ErrImportInvalidStatus):
+		return i18n.T(ctx, "import.error.invalid_status")
+	case errors.Is(err, services.ErrDuplicateRegistration):
+		return i18n.T(ctx, "import.error.duplicate")
+	case errors.Is(err, services.ErrRegistrationFull):
+		return i18n.T(ctx, "import.error.full")
+	default:
+		return i18n.T(ctx, "error.internal")
+	}
 }
 
 func (h *AdminHandler) DeleteAttendee(w http.ResponseWriter, r *http.Request) {
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -21,12 +24,16 @@ import (
 type EventHandler struct {
 	events        *services.EventService
 	registrations *services.RegistrationService
+	tags          *services.TagService
+	series        *services.SeriesService
+	venues        *services.VenueService
+	auth          *services.AuthService
 	settings      *services.SettingsService
 	uploadDir     string
 }
 
-func NewEventHandler(events *services.EventService, registrations *services.RegistrationService, settings *services.SettingsService, uploadDir string) *EventHandler {
-	return &EventHandler{events: events, registrations: registrations, settings: settings, uploadDir: uploadDir}
+func NewEventHandler(events *services.EventService, registrations *services.RegistrationService, tags *services.TagService, series *services.SeriesService, venues *services.VenueService, auth *services.AuthService, settings *services.SettingsService, uploadDir string) *EventHandler {
+	return &EventHandler{events: events, registrations: registrations, tags: tags, series: series, venues: venues, auth: auth, settings: settings, uploadDir: uploadDir}
 }
 
 // Public routes
@@ -37,8 +44,52 @@ func (h *EventHandler) Home(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
 		return
 	}
+	tags, err := h.tags.ListUpcoming()
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	siteName, accentColor := h.settings.GetSiteSettings()
+	public.Home(events, tags, nil, siteName, accentColor).Render(r.Context(), w)
+}
+
+// Tag lists the upcoming events with a tag.
+func (h *EventHandler) Tag(w http.ResponseWriter, r *http.Request) {
+	tag, err := h.tags.GetBySlug(chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	if tag == nil {
+		http.NotFound(w, r)
+		return
+	}
+	events, err := h.events.ListUpcomingByTag(tag.ID)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	tags, err := h.tags.ListUpcoming()
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	siteName, accentColor := h.settings.GetSiteSettings()
+	public.Home(events, tags, tag, siteName, accentColor).Render(r.Context(), w)
+}
+
+// Search lists the public events matching the q query parameter.
+func (h *EventHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	page := requestPage(r, publicPageSize)
+	events, total, err := h.events.Search(query, true, page)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	page.Total = total
 	siteName, accentColor := h.settings.GetSiteSettings()
-	public.Home(events, siteName, accentColor).Render(r.Context(), w)
+	public.Search(query, events, page, siteName, accentColor).Render(r.Context(), w)
 }
 
 func (h *EventHandler) Show(w http.ResponseWriter, r *http.Request) {
@@ -52,10 +103,19 @@ func (h *EventHandler) Show(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if event.Status == models.EventDraft {
+		// Drafts are only shown with their preview link
+		preview := r.URL.Query().Get("preview")
+		if subtle.ConstantTimeCompare([]byte(preview), []byte(event.PreviewToken)) != 1 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
 
 	var regs []models.Registration
 	if event.AttendeeListPublic {
-		regs, _ = h.registrations.ListByEvent(event.ID)
+		regs, _ = h.registrations.ListConfirmedByEvent(event.ID)
 	}
 
 	siteName, accentColor := h.settings.GetSiteSettings()
@@ -66,14 +126,24 @@ func (h *EventHandler) Show(w http.ResponseWriter, r *http.Request) {
 		flash = flashes[0]
 	}
 
-	challenge := captcha.Generate(w, r)
-	public.Event(event, regs, csrfField, siteName, accentColor, flash, "", challenge.Question).Render(r.Context(), w)
+	challenge := captcha.Generate(captchaProvider(h.settings), w, r)
+	public.Event(event, regs, csrfField, siteName, accentColor, flash, "", challenge, "").Render(r.Context(), w)
 }
 
 // Admin routes
 
+// List lists a page of the events selected by the query parameters, see
+// eventFilter.
 func (h *EventHandler) List(w http.ResponseWriter, r *http.Request) {
-	events, err := h.events.ListAll()
+	params := r.URL.Query()
+	page := requestPage(r, adminPageSize)
+	events, total, err := h.events.ListPage(eventFilter(params), page)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	page.Total = total
+	users, err := h.auth.ListUsers()
 	if err != nil {
 		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
 		return
@@ -85,36 +155,84 @@ func (h *EventHandler) List(w http.ResponseWriter, r *http.Request) {
 	if len(flashes) > 0 {
 		flash = flashes[0]
 	}
-	admin.Events(events, siteName, accentColor, middleware.GetDisplayName(r), csrfField, flash).Render(r.Context(), w)
+	admin.Events(events, params, page, users, siteName, accentColor, middleware.GetDisplayName(r), csrfField, flash).Render(r.Context(), w)
+}
+
+// eventFilter reads the filter of the admin event list from the query
+// parameters: q, when (upcoming or past), registration (open or closed),
+// creator, from and to (inclusive dates), sort and dir (asc or desc).
+// Invalid values are ignored.
+func eventFilter(params url.Values) models.EventFilter {
+	f := models.EventFilter{
+		Query:     strings.TrimSpace(params.Get("q")),
+		CreatedBy: params.Get("creator"),
+		Sort:      params.Get("sort"),
+		Desc:      params.Get("dir") == "desc",
+	}
+	switch params.Get("when") {
+	case "upcoming":
+		f.Upcoming = boolPtr(true)
+	case "past":
+		f.Upcoming = boolPtr(false)
+	}
+	switch params.Get("registration") {
+	case "open":
+		f.Open = boolPtr(true)
+	case "closed":
+		f.Open = boolPtr(false)
+	}
+	if t, err := time.ParseInLocation("2006-01-02", params.Get("from"), time.Local); err == nil {
+		f.From = &t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", params.Get("to"), time.Local); err == nil {
+		to := t.AddDate(0, 0, 1)
+		f.To = &to
+	}
+	return f
+}
+
+func boolPtr(b bool) *bool {
+	return &b
 }
 
 func (h *EventHandler) NewForm(w http.ResponseWriter, r *http.Request) {
-	siteName, accentColor := h.settings.GetSiteSettings()
-	csrfField := middleware.CSRFTemplateField(r)
 	event := &models.Event{
 		AttendeeListPublic: true,
 		RegistrationOpen:   true,
+		DuplicatePolicy:    models.DuplicateAllow,
+		Status:             models.EventDraft,
 	}
-	admin.EventForm(event, false, siteName, accentColor, middleware.GetDisplayName(r), csrfField, "").Render(r.Context(), w)
+	h.renderEventForm(w, r, event, &models.Series{HorizonDays: services.DefaultHorizonDays}, false, "")
 }
 
 func (h *EventHandler) Create(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
 
 	event, err := h.parseEventForm(r)
+	repeat, repeatErr := parseRepeatForm(r)
 	if err != nil {
-		siteName, accentColor := h.settings.GetSiteSettings()
-		csrfField := middleware.CSRFTemplateField(r)
-		admin.EventForm(event, false, siteName, accentColor, middleware.GetDisplayName(r), csrfField, err.Error()).Render(r.Context(), w)
+		h.renderEventForm(w, r, event, repeat, false, err.Error())
+		return
+	}
+	if repeatErr != nil {
+		h.renderEventForm(w, r, event, repeat, false, repeatErr.Error())
 		return
 	}
+	if err := h.applyVenue(r.Context(), event, nil); err != nil {
+		h.renderEventForm(w, r, event, repeat, false, err.Error())
+		return
+	}
+	if repeat.Rule != "" {
+		if err := h.series.Check(repeat.Rule, r.FormValue("repeat_exceptions"), repeat.HorizonDays); err != nil {
+			h.renderEventForm(w, r, event, repeat, false, seriesErrorMessage(r.Context(), err))
+			return
+		}
+	}
 	event.CreatedBy = middleware.GetUserID(r)
 
 	imgFile, err := saveUpload(r, "image", h.uploadDir)
 	if err != nil {
-		siteName, accentColor := h.settings.GetSiteSettings()
-		csrfField := middleware.CSRFTemplateField(r)
-		admin.EventForm(event, false, siteName, accentColor, middleware.GetDisplayName(r), csrfField, i18n.T(r.Context(), "error.upload_invalid_type")).Render(r.Context(), w)
+		h.renderEventForm(w, r, event, repeat, false, i18n.T(r.Context(), "error.upload_invalid_type"))
 		return
 	}
 	event.ImagePath = imgFile
@@ -122,9 +240,7 @@ func (h *EventHandler) Create(w http.ResponseWriter, r *http.Request) {
 	bannerFile, err := saveUpload(r, "banner", h.uploadDir)
 	if err != nil {
 		deleteUpload(h.uploadDir, imgFile)
-		siteName, accentColor := h.settings.GetSiteSettings()
-		csrfField := middleware.CSRFTemplateField(r)
-		admin.EventForm(event, false, siteName, accentColor, middleware.GetDisplayName(r), csrfField, i18n.T(r.Context(), "error.upload_invalid_type")).Render(r.Context(), w)
+		h.renderEventForm(w, r, event, repeat, false, i18n.T(r.Context(), "error.upload_invalid_type"))
 		return
 	}
 	event.BannerPath = bannerFile
@@ -136,6 +252,13 @@ func (h *EventHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if repeat.Rule != "" {
+		if _, err := h.series.Create(event, repeat.Rule, r.FormValue("repeat_exceptions"), repeat.HorizonDays, time.Now()); err != nil {
+			http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.event_created"))
 	http.Redirect(w, r, "/admin/events", http.StatusFound)
 }
@@ -151,9 +274,7 @@ func (h *EventHandler) EditForm(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	siteName, accentColor := h.settings.GetSiteSettings()
-	csrfField := middleware.CSRFTemplateField(r)
-	admin.EventForm(event, true, siteName, accentColor, middleware.GetDisplayName(r), csrfField, "").Render(r.Context(), w)
+	h.renderEventForm(w, r, event, h.eventSeries(event), true, "")
 }
 
 func (h *EventHandler) Update(w http.ResponseWriter, r *http.Request) {
@@ -167,13 +288,16 @@ func (h *EventHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	event, err := h.parseEventForm(r)
+	if err == nil {
+		err = h.applyVenue(r.Context(), event, existing.VenueID)
+	}
 	if err != nil {
-		siteName, accentColor := h.settings.GetSiteSettings()
-		csrfField := middleware.CSRFTemplateField(r)
 		event.ID = id
 		event.ImagePath = existing.ImagePath
 		event.BannerPath = existing.BannerPath
-		admin.EventForm(event, true, siteName, accentColor, middleware.GetDisplayName(r), csrfField, err.Error()).Render(r.Context(), w)
+		event.SeriesID = existing.SeriesID
+		event.OccurrenceDate = existing.OccurrenceDate
+		h.renderEventForm(w, r, event, h.eventSeries(existing), true, err.Error())
 		return
 	}
 	event.ID = id
@@ -182,23 +306,23 @@ func (h *EventHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 	event.CreatedBy = existing.CreatedBy
 	event.CreatedAt = existing.CreatedAt
+	event.PreviewToken = existing.PreviewToken
+	event.RegistrationsOpenedAt = existing.RegistrationsOpenedAt
+	event.SeriesID = existing.SeriesID
+	event.OccurrenceDate = existing.OccurrenceDate
 
 	// Handle image upload
 	imgFile, err := saveUpload(r, "image", h.uploadDir)
 	if err != nil {
-		siteName, accentColor := h.settings.GetSiteSettings()
-		csrfField := middleware.CSRFTemplateField(r)
 		event.ImagePath = existing.ImagePath
 		event.BannerPath = existing.BannerPath
-		admin.EventForm(event, true, siteName, accentColor, middleware.GetDisplayName(r), csrfField, i18n.T(r.Context(), "error.upload_invalid_type")).Render(r.Context(), w)
+		h.renderEventForm(w, r, event, h.eventSeries(existing), true, i18n.T(r.Context(), "error.upload_invalid_type"))
 		return
 	}
 	switch {
 	case imgFile != "":
-		deleteUpload(h.uploadDir, existing.ImagePath)
 		event.ImagePath = imgFile
 	case r.FormValue("remove_image") == "true":
-		deleteUpload(h.uploadDir, existing.ImagePath)
 		event.ImagePath = ""
 	default:
 		event.ImagePath = existing.ImagePath
@@ -207,27 +331,41 @@ func (h *EventHandler) Update(w http.ResponseWriter, r *http.Request) {
 	// Handle banner upload
 	bannerFile, err := saveUpload(r, "banner", h.uploadDir)
 	if err != nil {
-		siteName, accentColor := h.settings.GetSiteSettings()
-		csrfField := middleware.CSRFTemplateField(r)
+		deleteUpload(h.uploadDir, imgFile)
+		event.ImagePath = existing.ImagePath
 		event.BannerPath = existing.BannerPath
-		admin.EventForm(event, true, siteName, accentColor, middleware.GetDisplayName(r), csrfField, i18n.T(r.Context(), "error.upload_invalid_type")).Render(r.Context(), w)
+		h.renderEventForm(w, r, event, h.eventSeries(existing), true, i18n.T(r.Context(), "error.upload_invalid_type"))
 		return
 	}
 	switch {
 	case bannerFile != "":
-		deleteUpload(h.uploadDir, existing.BannerPath)
 		event.BannerPath = bannerFile
 	case r.FormValue("remove_banner") == "true":
-		deleteUpload(h.uploadDir, existing.BannerPath)
 		event.BannerPath = ""
 	default:
 		event.BannerPath = existing.BannerPath
 	}
 
 	if err := h.events.Update(event); err != nil {
+		deleteUpload(h.uploadDir, imgFile)
+		deleteUpload(h.uploadDir, bannerFile)
 		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
 		return
 	}
+	if r.FormValue("scope") == "future" {
+		if err := h.series.UpdateFuture(event); err != nil {
+			http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Occurrences and clones may share the replaced images
+	if event.ImagePath != existing.ImagePath {
+		h.releaseUpload(existing.ImagePath)
+	}
+	if event.BannerPath != existing.BannerPath {
+		h.releaseUpload(existing.BannerPath)
+	}
 
 	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.event_updated"))
 	http.Redirect(w, r, "/admin/events", http.StatusFound)
@@ -242,13 +380,18 @@ func (h *EventHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A deleted occurrence is not generated again
+	if err := h.series.SkipOccurrence(event); err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
 	if err := h.events.Delete(id); err != nil {
 		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
 		return
 	}
 
-	deleteUpload(h.uploadDir, event.ImagePath)
-	deleteUpload(h.uploadDir, event.BannerPath)
+	h.releaseUpload(event.ImagePath)
+	h.releaseUpload(event.BannerPath)
 
 	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.event_deleted"))
 	http.Redirect(w, r, "/admin/events", http.StatusFound)
@@ -266,6 +409,91 @@ func (h *EventHandler) Clone(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin/events", http.StatusFound)
 }
 
+// releaseUpload deletes an uploaded file no event uses anymore.
+func (h *EventHandler) releaseUpload(filename string) {
+	if filename == "" {
+		return
+	}
+	inUse, err := h.events.UploadInUse(filename)
+	if err != nil || inUse {
+		return
+	}
+	deleteUpload(h.uploadDir, filename)
+}
+
+// applyVenue checks the venue picked for the event. An event moving to a
+// venue without a capacity of its own takes the capacity of the venue.
+func (h *EventHandler) applyVenue(ctx context.Context, event *models.Event, previousVenueID *string) error {
+	if event.VenueID == nil {
+		return nil
+	}
+	venue, err := h.venues.GetByID(*event.VenueID)
+	if err != nil || venue == nil {
+		return errInvalid(ctx, "field.venue")
+	}
+	moved := previousVenueID == nil || *previousVenueID != venue.ID
+	if moved && event.MaxCapacity == nil {
+		event.MaxCapacity = venue.MaxCapacity
+	}
+	return nil
+}
+
+// eventSeries returns the series of an occurrence, or nil.
+func (h *EventHandler) eventSeries(event *models.Event) *models.Series {
+	if event.SeriesID == nil {
+		return nil
+	}
+	series, _ := h.series.GetByID(*event.SeriesID)
+	return series
+}
+
+// renderEventForm renders the event form, offering the existing tags for
+// autocompletion. When creating, series holds the repeat fields; when
+// editing, the series of the occurrence if any.
+func (h *EventHandler) renderEventForm(w http.ResponseWriter, r *http.Request, event *models.Event, series *models.Series, isEdit bool, errorMsg string) {
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	allTags, _ := h.tags.List()
+	venues, _ := h.venues.List()
+	admin.EventForm(event, series, isEdit, allTags, venues, siteName, accentColor, middleware.GetDisplayName(r), csrfField, errorMsg).Render(r.Context(), w)
+}
+
+// parseRepeatForm reads the repeat fields of the new event form. The rule is
+// empty for a single event.
+func parseRepeatForm(r *http.Request) (*models.Series, error) {
+	repeat := &models.Series{
+		Rule:        strings.TrimSpace(r.FormValue("repeat_rule")),
+		Exceptions:  strings.Fields(strings.ReplaceAll(r.FormValue("repeat_exceptions"), ",", " ")),
+		HorizonDays: services.DefaultHorizonDays,
+	}
+	if v := r.FormValue("repeat_horizon"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return repeat, errInvalid(r.Context(), "field.repeat_horizon")
+		}
+		repeat.HorizonDays = n
+	}
+	return repeat, nil
+}
+
+// seriesErrorMessage returns the message shown for an invalid rule,
+// exceptions or horizon.
+func seriesErrorMessage(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(err, services.ErrInvalidRule):
+		return errInvalid(ctx, "field.repeat_rule").Error()
+	case errors.Is(err, services.ErrInvalidExceptionDate):
+		return errInvalid(ctx, "field.repeat_exceptions").Error()
+	case errors.Is(err, services.ErrInvalidHorizon):
+		return errInvalid(ctx, "field.repeat_horizon").Error()
+	}
+	return i18n.T(ctx, "error.internal")
+}
+
+// maxCompanions bounds the companions an event may allow per registration,
+// as the public form shows one field for each.
+const maxCompanions = 20
+
 func (h *EventHandler) parseEventForm(r *http.Request) (*models.Event, error) {
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
 		r.ParseForm()
@@ -294,6 +522,33 @@ func (h *EventHandler) parseEventForm(r *http.Request) (*models.Event, error) {
 		EventDate:          eventDate,
 		AttendeeListPublic: r.FormValue("attendee_list_public") == "true",
 		RegistrationOpen:   r.FormValue("registration_open") == "true",
+		DuplicatePolicy:    models.DuplicatePolicy(r.FormValue("duplicate_policy")),
+		ApprovalRequired:   r.FormValue("approval_required") == "true",
+		Status:             models.EventStatus(r.FormValue("status")),
+		Tags:               services.ParseTags(r.FormValue("tags")),
+	}
+	if v := r.FormValue("venue_id"); v != "" {
+		event.VenueID = &v
+	}
+
+	switch event.Status {
+	case models.EventDraft, models.EventPublished, models.EventArchived:
+	default:
+		event.Status = models.EventPublished
+	}
+
+	switch event.DuplicatePolicy {
+	case models.DuplicateAllow, models.DuplicateWarn, models.DuplicateReject:
+	default:
+		event.DuplicatePolicy = models.DuplicateAllow
+	}
+
+	if ed := r.FormValue("end_date"); ed != "" {
+		t, err := time.ParseInLocation("2006-01-02T15:04", ed, time.Local)
+		if err != nil || !t.After(eventDate) {
+			return event, errInvalid(ctx, "field.end_date")
+		}
+		event.EndDate = &t
 	}
 
 	if dl := r.FormValue("registration_deadline"); dl != "" {
@@ -304,6 +559,24 @@ func (h *EventHandler) parseEventForm(r *http.Request) (*models.Event, error) {
 		event.RegistrationDeadline = &t
 	}
 
+	// Only drafts can be scheduled for publication, and closed
+	// registrations for opening
+	if v := r.FormValue("publish_at"); v != "" && event.Status == models.EventDraft {
+		t, err := time.ParseInLocation("2006-01-02T15:04", v, time.Local)
+		if err != nil {
+			return event, errInvalid(ctx, "field.publish_at")
+		}
+		event.PublishAt = &t
+	}
+
+	if v := r.FormValue("registration_opens_at"); v != "" && !event.RegistrationOpen {
+		t, err := time.ParseInLocation("2006-01-02T15:04", v, time.Local)
+		if err != nil {
+			return event, errInvalid(ctx, "field.registration_opens_at")
+		}
+		event.RegistrationOpensAt = &t
+	}
+
 	if cap := r.FormValue("max_capacity"); cap != "" {
 		n, err := strconv.Atoi(cap)
 		if err != nil || n < 1 {
@@ -312,6 +585,14 @@ func (h *EventHandler) parseEventForm(r *http.Request) (*models.Event, error) {
 		event.MaxCapacity = &n
 	}
 
+	if mc := r.FormValue("max_companions"); mc != "" {
+		n, err := strconv.Atoi(mc)
+		if err != nil || n < 0 || n > maxCompanions {
+			return event, errInvalid(ctx, "field.max_companions")
+		}
+		event.MaxCompanions = n
+	}
+
 	if lat := r.FormValue("latitude"); lat != "" {
 		v, err := strconv.ParseFloat(lat, 64)
 		if err != nil {
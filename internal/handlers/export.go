@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/internal/spreadsheet"
+)
+
+// spreadsheetFormats maps the export formats to their media type and writer.
+var spreadsheetFormats = map[string]struct {
+	contentType string
+	write       func(io.Writer, *spreadsheet.Workbook) error
+}{
+	"xlsx": {spreadsheet.XLSXContentType, spreadsheet.WriteXLSX},
+	"ods":  {spreadsheet.ODSContentType, spreadsheet.WriteODS},
+}
+
+// AttendeesSpreadsheet exports the attendees of an event as an XLSX or ODS
+// workbook, with a summary sheet.
+func (h *AdminHandler) AttendeesSpreadsheet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format := chi.URLParam(r, "format")
+	if _, ok := spreadsheetFormats[format]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	regs, err := h.registrations.ListByEvent(event.ID)
+	if err != nil {
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	wb := services.AttendeeWorkbook(ctx, []models.Event{*event}, map[string][]models.Registration{event.ID: regs}, false)
+	writeSpreadsheet(w, r, wb, format, i18n.Tf(ctx, "export.filename_fmt", event.Slug, format))
+}
+
+// ExportEvents exports the attendees of all the events taking place in a
+// date range as an XLSX or ODS workbook. Both dates are optional and
+// inclusive.
+func (h *AdminHandler) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format := r.URL.Query().Get("format")
+	if _, ok := spreadsheetFormats[format]; !ok {
+		http.Error(w, i18n.T(ctx, "export.error.format"), http.StatusBadRequest)
+		return
+	}
+
+	from := time.Time{}
+	to := time.Date(9999, 1, 1, 0, 0, 0, 0, time.Local)
+	fromLabel, toLabel := "", ""
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			http.Error(w, i18n.T(ctx, "export.error.date"), http.StatusBadRequest)
+			return
+		}
+		from, fromLabel = t, v
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			http.Error(w, i18n.T(ctx, "export.error.date"), http.StatusBadRequest)
+			return
+		}
+		to, toLabel = t.AddDate(0, 0, 1), v
+	}
+
+	events, err := h.events.ListBetween(from, to)
+	if err != nil {
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	regsByEvent := make(map[string][]models.Registration)
+	for _, e := range events {
+		regs, err := h.registrations.ListByEvent(e.ID)
+		if err != nil {
+			http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+			return
+		}
+		regsByEvent[e.ID] = regs
+	}
+
+	wb := services.AttendeeWorkbook(ctx, events, regsByEvent, true)
+	name := strings.Trim(strings.Join([]string{fromLabel, toLabel}, "_"), "_")
+	if name == "" {
+		name = "all"
+	}
+	writeSpreadsheet(w, r, wb, format, i18n.Tf(ctx, "export.all_filename_fmt", name, format))
+}
+
+// writeSpreadsheet renders the workbook before sending anything, so that a
+// failure can still be reported.
+func writeSpreadsheet(w http.ResponseWriter, r *http.Request, wb *spreadsheet.Workbook, format, filename string) {
+	f := spreadsheetFormats[format]
+	var buf bytes.Buffer
+	if err := f.write(&buf, wb); err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Write(buf.Bytes())
+}
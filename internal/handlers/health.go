@@ -3,23 +3,39 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/toulibre/libreregistration/internal/database"
 )
 
 type HealthHandler struct {
-	db *database.DB
+	db       *database.DB
+	draining atomic.Bool
 }
 
 func NewHealthHandler(db *database.DB) *HealthHandler {
 	return &HealthHandler{db: db}
 }
 
-func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
-	err := h.db.PingContext(r.Context())
+// SetDraining makes the health check fail with the "draining" status, so
+// that load balancers stop sending requests before the server shuts down.
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
 
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if h.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "draining",
+		})
+		return
+	}
+
+	err := h.db.PingContext(r.Context())
+
 	if err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/toulibre/libreregistration/internal/database"
+	"github.com/toulibre/libreregistration/internal/metrics"
+)
+
+type MetricsHandler struct {
+	db    *database.DB
+	token string
+}
+
+// NewMetricsHandler returns the handler of the metrics endpoint. When token
+// is set, scrapers must send it as a bearer token.
+func NewMetricsHandler(db *database.DB, token string) *MetricsHandler {
+	return &MetricsHandler{db: db, token: token}
+}
+
+// Metrics writes the metrics in the OpenMetrics text format, along with the
+// state of the database connection pool and the schema version.
+func (h *MetricsHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	version, err := database.SchemaVersion(h.db)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not read the schema version", "error", err)
+		version = -1
+	}
+	stats := h.db.Stats()
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	metrics.Default.Write(w,
+		metrics.Gauge("schema_version", "Number of the latest database migration applied, -1 if unknown.", float64(version)),
+		metrics.Gauge("db_max_open_connections", "Maximum number of open database connections, 0 for unlimited.", float64(stats.MaxOpenConnections)),
+		metrics.Gauge("db_open_connections", "Open database connections, in use or idle.", float64(stats.OpenConnections)),
+		metrics.Gauge("db_in_use_connections", "Database connections in use.", float64(stats.InUse)),
+		metrics.Gauge("db_idle_connections", "Idle database connections.", float64(stats.Idle)),
+		metrics.Total("db_wait", "Times a database connection was waited for.", float64(stats.WaitCount)),
+		metrics.Total("db_wait_seconds", "Time spent waiting for a database connection.", stats.WaitDuration.Seconds()),
+		metrics.Total("db_closed_max_idle", "Database connections closed for exceeding the idle limit.", float64(stats.MaxIdleClosed)),
+		metrics.Total("db_closed_max_lifetime", "Database connections closed for exceeding their lifetime.", float64(stats.MaxLifetimeClosed)),
+	)
+}
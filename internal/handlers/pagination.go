@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+// Results per page of the search results.
+const (
+	publicPageSize = 20
+	adminPageSize  = 50
+)
+
+// requestPage returns the page asked for by the page query parameter, the
+// first one by default.
+func requestPage(r *http.Request, size int) models.Page {
+	n, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || n < 1 {
+		n = 1
+	}
+	return models.Page{Number: n, Size: size}
+}
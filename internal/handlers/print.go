@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/color"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/pdf"
+	"github.com/toulibre/libreregistration/templates/admin"
+)
+
+// labelLayout describes a sheet of adhesive labels. Lengths are in
+// millimeters.
+type labelLayout struct {
+	Key, Name             string
+	PageWidth, PageHeight float64 // in points
+	Cols, Rows            int
+	Width, Height         float64
+	Left, Top             float64
+	PitchX, PitchY        float64
+}
+
+// labelLayouts are the label sheets badges can be printed on.
+var labelLayouts = []labelLayout{
+	{"l7165", "Avery L7165 (A4, 8)", pdf.A4Width, pdf.A4Height, 2, 4, 99.1, 67.7, 4.65, 13.1, 101.6, 67.7},
+	{"l7173", "Avery L7173 (A4, 10)", pdf.A4Width, pdf.A4Height, 2, 5, 99.1, 57, 4.65, 6, 101.6, 57},
+	{"5163", "Avery 5163 (Letter, 10)", pdf.LetterWidth, pdf.LetterHeight, 2, 5, 101.6, 50.8, 3.96, 12.7, 106.38, 50.8},
+}
+
+var (
+	colorBlack = color.Gray{0}
+	colorGrey  = color.Gray{0x66}
+	colorLine  = color.Gray{0xbb}
+	colorShade = color.Gray{0xee}
+)
+
+// attendeeLine is a person expected at the event: a registrant or one of
+// their companions.
+type attendeeLine struct {
+	Name string
+	Note string
+}
+
+// attendeeLines lists the confirmed registrants and their companions. With
+// byName, people are sorted by name in the collation order of the locale;
+// otherwise they keep the registration order, companions following their
+// registrant.
+func attendeeLines(ctx context.Context, regs []models.Registration, byName bool) []attendeeLine {
+	var lines []attendeeLine
+	for _, reg := range regs {
+		lines = append(lines, attendeeLine{Name: reg.Name})
+		for _, c := range reg.Companions {
+			lines = append(lines, attendeeLine{Name: c.Name, Note: i18n.Tf(ctx, "print.companion_of", reg.Name)})
+		}
+	}
+	if byName {
+		col := collate.New(language.Make(i18n.Locale(ctx)), collate.IgnoreCase, collate.IgnoreDiacritics)
+		sort.SliceStable(lines, func(i, j int) bool {
+			return col.CompareString(lines[i].Name, lines[j].Name) < 0
+		})
+	}
+	return lines
+}
+
+// SignInSheet renders an A4 sign-in sheet of the confirmed attendees of an
+// event, with a signature column. The last page is filled with blank rows
+// for walk-ins.
+func (h *AdminHandler) SignInSheet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	regs, err := h.registrations.ListConfirmedByEvent(event.ID)
+	if err != nil {
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	siteName, _ := h.settings.GetSiteSettings()
+	lines := attendeeLines(ctx, regs, r.URL.Query().Get("sort") != "date")
+
+	doc := pdf.New(pdf.A4Width, pdf.A4Height)
+	doc.SetTitle(i18n.T(ctx, "print.signin_title") + " - " + event.Title)
+	banner := h.loadBanner(doc, event)
+
+	margin := pdf.MM(15)
+	contentW := pdf.A4Width - 2*margin
+	bottom := pdf.A4Height - margin - pdf.MM(8)
+	headerH, rowH := pdf.MM(7), pdf.MM(10)
+	numW, sigW := pdf.MM(10), pdf.MM(60)
+	nameW := contentW - numW - sigW
+
+	var pages []*pdf.Page
+	newPage := func() (*pdf.Page, float64) {
+		p := doc.AddPage()
+		pages = append(pages, p)
+		y := margin
+		if len(pages) == 1 {
+			if banner != nil {
+				bw, bh := fitImage(banner, contentW, pdf.MM(35))
+				p.Image(banner, margin+(contentW-bw)/2, y, bw, bh)
+				y += bh + pdf.MM(6)
+			}
+			p.SetFillColor(colorGrey)
+			p.Text(pdf.Helvetica, 9, margin, y+9, siteName)
+			p.SetFillColor(colorBlack)
+			p.Text(pdf.HelveticaBold, 16, margin, y+28, pdf.Truncate(pdf.HelveticaBold, 16, event.Title, contentW))
+			details := i18n.FormatDateTime(ctx, event.EventDate)
+			if place := event.Place(); place != "" {
+				details += " · " + place
+			}
+			p.Text(pdf.Helvetica, 10, margin, y+44, pdf.Truncate(pdf.Helvetica, 10, details, contentW))
+			p.TextRight(pdf.HelveticaBold, 10, margin+contentW, y+9, i18n.T(ctx, "print.signin_title"))
+			y += 44 + pdf.MM(6)
+		} else {
+			p.Text(pdf.HelveticaBold, 11, margin, y+11, pdf.Truncate(pdf.HelveticaBold, 11, event.Title, contentW))
+			y += 11 + pdf.MM(5)
+		}
+
+		p.SetFillColor(colorShade)
+		p.FillRect(margin, y, contentW, headerH)
+		p.SetFillColor(colorBlack)
+		p.Text(pdf.HelveticaBold, 9, margin+pdf.MM(2), y+pdf.MM(4.8), i18n.T(ctx, "print.col.number"))
+		p.Text(pdf.HelveticaBold, 9, margin+numW+pdf.MM(2), y+pdf.MM(4.8), i18n.T(ctx, "csv.name"))
+		p.Text(pdf.HelveticaBold, 9, margin+numW+nameW+pdf.MM(2), y+pdf.MM(4.8), i18n.T(ctx, "print.col.signature"))
+		return p, y + headerH
+	}
+
+	p, y := newPage()
+	tableTop := y - headerH
+	closeTable := func() {
+		p.SetStrokeColor(colorLine)
+		p.Rect(margin, tableTop, contentW, y-tableTop, 0.5)
+		p.Line(margin+numW, tableTop, margin+numW, y, 0.5)
+		p.Line(margin+numW+nameW, tableTop, margin+numW+nameW, y, 0.5)
+	}
+	row := func(n int, line attendeeLine) {
+		p.SetStrokeColor(colorLine)
+		p.Line(margin, y, margin+contentW, y, 0.5)
+		if line.Name != "" {
+			p.SetFillColor(colorGrey)
+			p.TextRight(pdf.Helvetica, 9, margin+numW-pdf.MM(2), y+pdf.MM(5.5), fmt.Sprint(n))
+			p.SetFillColor(colorBlack)
+			p.Text(pdf.HelveticaBold, 10, margin+numW+pdf.MM(2), y+pdf.MM(5.5), pdf.Truncate(pdf.HelveticaBold, 10, line.Name, nameW-pdf.MM(4)))
+			if line.Note != "" {
+				p.SetFillColor(colorGrey)
+				p.Text(pdf.Helvetica, 7.5, margin+numW+pdf.MM(2), y+pdf.MM(8.5), pdf.Truncate(pdf.Helvetica, 7.5, line.Note, nameW-pdf.MM(4)))
+				p.SetFillColor(colorBlack)
+			}
+		}
+		y += rowH
+	}
+
+	for i, line := range lines {
+		if y+rowH > bottom {
+			closeTable()
+			p, y = newPage()
+			tableTop = y - headerH
+		}
+		row(i+1, line)
+	}
+	for y+rowH <= bottom {
+		row(0, attendeeLine{})
+	}
+	closeTable()
+
+	for i, page := range pages {
+		page.SetFillColor(colorGrey)
+		page.Text(pdf.Helvetica, 8, margin, pdf.A4Height-margin, siteName)
+		page.TextRight(pdf.Helvetica, 8, margin+contentW, pdf.A4Height-margin, i18n.Tf(ctx, "print.page_fmt", i+1, len(pages)))
+	}
+
+	writePDF(w, r, doc, i18n.Tf(ctx, "print.signin_filename_fmt", event.Slug))
+}
+
+// Badges renders a name badge for each confirmed attendee and companion of
+// an event, on the label sheet given by the layout parameter.
+func (h *AdminHandler) Badges(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	layout := labelLayouts[0]
+	if key := r.URL.Query().Get("layout"); key != "" {
+		found := false
+		for _, l := range labelLayouts {
+			if l.Key == key {
+				layout, found = l, true
+			}
+		}
+		if !found {
+			http.Error(w, i18n.T(ctx, "print.error.layout"), http.StatusBadRequest)
+			return
+		}
+	}
+	regs, err := h.registrations.ListConfirmedByEvent(event.ID)
+	if err != nil {
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	siteName, accentColor := h.settings.GetSiteSettings()
+	lines := attendeeLines(ctx, regs, true)
+
+	doc := pdf.New(layout.PageWidth, layout.PageHeight)
+	doc.SetTitle(i18n.T(ctx, "print.badges_title") + " - " + event.Title)
+	banner := h.loadBanner(doc, event)
+	accent := parseHexColor(accentColor)
+	date := i18n.FormatDateTime(ctx, event.EventDate)
+
+	perPage := layout.Cols * layout.Rows
+	var p *pdf.Page
+	for i, line := range lines {
+		if i%perPage == 0 {
+			p = doc.AddPage()
+		}
+		n := i % perPage
+		x := pdf.MM(layout.Left + float64(n%layout.Cols)*layout.PitchX)
+		y := pdf.MM(layout.Top + float64(n/layout.Cols)*layout.PitchY)
+		pad := pdf.MM(4)
+		width, height := pdf.MM(layout.Width)-2*pad, pdf.MM(layout.Height)-2*pad
+		x, y = x+pad, y+pad
+		cx := x + width/2
+
+		// Header: the event banner, or the site name in the accent color
+		top := y
+		if banner != nil {
+			bw, bh := fitImage(banner, width, height*0.3)
+			p.Image(banner, cx-bw/2, y, bw, bh)
+			top += bh
+		} else {
+			p.SetFillColor(accent)
+			p.TextCenter(pdf.HelveticaBold, 10, cx, y+10, pdf.Truncate(pdf.HelveticaBold, 10, siteName, width))
+			p.FillRect(x, y+14, width, 1.5)
+			top += 16
+		}
+
+		// Footer: the event title and date
+		p.SetFillColor(colorGrey)
+		p.TextCenter(pdf.Helvetica, 8, cx, y+height, pdf.Truncate(pdf.Helvetica, 8, date, width))
+		p.TextCenter(pdf.HelveticaBold, 8, cx, y+height-11, pdf.Truncate(pdf.HelveticaBold, 8, event.Title, width))
+		footer := y + height - 20
+
+		// The name, as large as it fits, in the middle of the remaining space
+		size := 24.0
+		for size > 12 && pdf.Width(pdf.HelveticaBold, size, line.Name) > width {
+			size--
+		}
+		size = math.Min(size, (footer-top)*0.5)
+		middle := (top + footer) / 2
+		p.SetFillColor(colorBlack)
+		if line.Note != "" {
+			p.TextCenter(pdf.HelveticaBold, size, cx, middle+size*0.35-5, pdf.Truncate(pdf.HelveticaBold, size, line.Name, width))
+			p.SetFillColor(colorGrey)
+			p.TextCenter(pdf.Helvetica, 8, cx, middle+size*0.35+7, pdf.Truncate(pdf.Helvetica, 8, line.Note, width))
+		} else {
+			p.TextCenter(pdf.HelveticaBold, size, cx, middle+size*0.35, pdf.Truncate(pdf.HelveticaBold, size, line.Name, width))
+		}
+	}
+	if len(lines) == 0 {
+		doc.AddPage()
+	}
+
+	writePDF(w, r, doc, i18n.Tf(ctx, "print.badges_filename_fmt", event.Slug))
+}
+
+// loadBanner embeds the banner of the event, falling back to its image. It
+// returns nil when there is none or it cannot be decoded, such as WebP
+// images.
+func (h *AdminHandler) loadBanner(doc *pdf.Document, event *models.Event) *pdf.Image {
+	for _, name := range []string{event.BannerPath, event.ImagePath} {
+		if name == "" {
+			continue
+		}
+		f, err := os.Open(filepath.Join(h.uploadDir, filepath.Base(name)))
+		if err != nil {
+			continue
+		}
+		img, err := doc.AddImage(f)
+		f.Close()
+		if err == nil {
+			return img
+		}
+	}
+	return nil
+}
+
+// labelOptions lists the label layouts for the badges form.
+func labelOptions() []admin.LabelOption {
+	options := make([]admin.LabelOption, len(labelLayouts))
+	for i, l := range labelLayouts {
+		options[i] = admin.LabelOption{Key: l.Key, Name: l.Name}
+	}
+	return options
+}
+
+// fitImage returns the size of an image scaled down to fit in a box,
+// keeping its aspect ratio.
+func fitImage(img *pdf.Image, maxW, maxH float64) (w, h float64) {
+	scale := math.Min(maxW/float64(img.Width), maxH/float64(img.Height))
+	return float64(img.Width) * scale, float64(img.Height) * scale
+}
+
+// parseHexColor parses a #rrggbb color, defaulting to black.
+func parseHexColor(s string) color.Color {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(strings.ToLower(s), "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return colorBlack
+	}
+	return color.RGBA{r, g, b, 0xff}
+}
+
+// writePDF renders the document before sending anything, so that a failure
+// can still be reported.
+func writePDF(w http.ResponseWriter, r *http.Request, doc *pdf.Document, filename string) {
+	var buf bytes.Buffer
+	if err := doc.Write(&buf); err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	w.Write(buf.Bytes())
+}
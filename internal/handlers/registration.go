@@ -50,35 +50,82 @@ func (h *RegistrationHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Spam protection: math captcha
-	if !captcha.Verify(w, r) {
+	// Spam protection: configured challenge provider
+	if !captcha.Verify(captchaProvider(h.settings), w, r) {
 		h.renderError(w, r, event, i18n.T(r.Context(), "error.captcha_invalid"))
 		return
 	}
 
-	_, err = h.registrations.Register(r.Context(), event.ID, name, email, comment)
+	reg, err := h.registrations.Register(r.Context(), event.ID, name, email, comment, r.PostForm["companion"], r.PostForm["session"])
 	if err != nil {
+		if errors.Is(err, services.ErrDuplicateRegistration) {
+			// Offer to resend the confirmation instead
+			h.renderErrorWithResend(w, r, event, mapRegistrationError(r.Context(), err), email)
+			return
+		}
 		h.renderError(w, r, event, mapRegistrationError(r.Context(), err))
 		return
 	}
 
-	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.registration_confirmed"))
+	switch {
+	case reg.Status == models.StatusPending:
+		middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.registration_pending"))
+	case reg.Duplicate:
+		middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.registration_confirmed_duplicate"))
+	default:
+		middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.registration_confirmed"))
+	}
+	http.Redirect(w, r, "/event/"+slug, http.StatusFound)
+}
+
+// ResendConfirmation emails the cancellation link again to an attendee who
+// tried to register twice. The form has the same challenge as registrations,
+// and a registration gets at most one email every few minutes.
+func (h *RegistrationHandler) ResendConfirmation(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	event, err := h.events.GetBySlug(slug)
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if captcha.IsHoneypotFilled(r) {
+		http.Redirect(w, r, "/event/"+slug, http.StatusFound)
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if !captcha.Verify(captchaProvider(h.settings), w, r) {
+		h.renderErrorWithResend(w, r, event, i18n.T(r.Context(), "error.captcha_invalid"), email)
+		return
+	}
+	if err := h.registrations.ResendConfirmation(r.Context(), event.ID, email); err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	// Same message whether or not a registration exists
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.confirmation_resent"))
 	http.Redirect(w, r, "/event/"+slug, http.StatusFound)
 }
 
 func (h *RegistrationHandler) renderError(w http.ResponseWriter, r *http.Request, event *models.Event, errMsg string) {
+	h.renderErrorWithResend(w, r, event, errMsg, "")
+}
+
+func (h *RegistrationHandler) renderErrorWithResend(w http.ResponseWriter, r *http.Request, event *models.Event, errMsg, resendEmail string) {
 	siteName, accentColor := h.settings.GetSiteSettings()
 	csrfField := middleware.CSRFTemplateField(r)
-	regs, _ := h.registrations.ListByEvent(event.ID)
-	challenge := captcha.Generate(w, r)
+	regs, _ := h.registrations.ListConfirmedByEvent(event.ID)
+	challenge := captcha.Generate(captchaProvider(h.settings), w, r)
 	w.WriteHeader(http.StatusBadRequest)
-	public.Event(event, regs, csrfField, siteName, accentColor, "", errMsg, challenge.Question).Render(r.Context(), w)
+	public.Event(event, regs, csrfField, siteName, accentColor, "", errMsg, challenge, resendEmail).Render(r.Context(), w)
 }
 
 func (h *RegistrationHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 
-	reg, err := h.registrations.Cancel(token)
+	reg, err := h.registrations.Cancel(r.Context(), token)
 	if err != nil {
 		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
 		return
@@ -96,11 +143,16 @@ func (h *RegistrationHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	regs, _ := h.registrations.ListByEvent(event.ID)
+	regs, _ := h.registrations.ListConfirmedByEvent(event.ID)
 	siteName, accentColor := h.settings.GetSiteSettings()
 	csrfField := middleware.CSRFTemplateField(r)
-	challenge := captcha.Generate(w, r)
-	public.Event(event, regs, csrfField, siteName, accentColor, "", i18n.T(r.Context(), "flash.registration_canceled"), challenge.Question).Render(r.Context(), w)
+	challenge := captcha.Generate(captchaProvider(h.settings), w, r)
+	public.Event(event, regs, csrfField, siteName, accentColor, "", i18n.T(r.Context(), "flash.registration_canceled"), challenge, "").Render(r.Context(), w)
+}
+
+// captchaProvider returns the anti-spam provider selected in the settings.
+func captchaProvider(settings *services.SettingsService) captcha.Provider {
+	return captcha.Lookup(settings.CaptchaProvider())
 }
 
 func mapRegistrationError(ctx context.Context, err error) string {
@@ -113,6 +165,14 @@ func mapRegistrationError(ctx context.Context, err error) string {
 		return i18n.T(ctx, "error.registration_deadline_passed")
 	case errors.Is(err, services.ErrRegistrationFull):
 		return i18n.T(ctx, "error.registration_full")
+	case errors.Is(err, services.ErrDuplicateRegistration):
+		return i18n.T(ctx, "error.registration_duplicate")
+	case errors.Is(err, services.ErrTooManyCompanions):
+		return i18n.T(ctx, "error.too_many_companions")
+	case errors.Is(err, services.ErrSessionFull):
+		return i18n.T(ctx, "error.session_full")
+	case errors.Is(err, services.ErrSessionNotFound):
+		return i18n.T(ctx, "error.session_not_found")
 	default:
 		return i18n.T(ctx, "error.internal")
 	}
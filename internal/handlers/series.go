@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/middleware"
+	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/templates/admin"
+	"github.com/toulibre/libreregistration/templates/public"
+)
+
+type SeriesHandler struct {
+	series   *services.SeriesService
+	events   *services.EventService
+	settings *services.SettingsService
+}
+
+func NewSeriesHandler(series *services.SeriesService, events *services.EventService, settings *services.SettingsService) *SeriesHandler {
+	return &SeriesHandler{series: series, events: events, settings: settings}
+}
+
+// Show lists the upcoming occurrences of a series.
+func (h *SeriesHandler) Show(w http.ResponseWriter, r *http.Request) {
+	series, err := h.series.GetBySlug(chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	if series == nil {
+		http.NotFound(w, r)
+		return
+	}
+	events, err := h.events.ListUpcomingBySeries(series.ID)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	siteName, accentColor := h.settings.GetSiteSettings()
+	public.Series(series, events, siteName, accentColor).Render(r.Context(), w)
+}
+
+// Admin routes
+
+func (h *SeriesHandler) List(w http.ResponseWriter, r *http.Request) {
+	series, err := h.series.List()
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	siteName, accentColor := h.settings.GetSiteSettings()
+	flashes := middleware.GetFlashes(w, r, "success")
+	flash := ""
+	if len(flashes) > 0 {
+		flash = flashes[0]
+	}
+	admin.SeriesList(series, siteName, accentColor, middleware.GetDisplayName(r), flash).Render(r.Context(), w)
+}
+
+func (h *SeriesHandler) Detail(w http.ResponseWriter, r *http.Request) {
+	series, err := h.series.GetByID(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	if series == nil {
+		http.NotFound(w, r)
+		return
+	}
+	occurrences, err := h.events.ListBySeries(series.ID)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	flashes := middleware.GetFlashes(w, r, "success")
+	flash := ""
+	if len(flashes) > 0 {
+		flash = flashes[0]
+	}
+	errorFlashes := middleware.GetFlashes(w, r, "error")
+	errorMsg := ""
+	if len(errorFlashes) > 0 {
+		errorMsg = errorFlashes[0]
+	}
+	admin.SeriesDetail(series, occurrences, siteName, accentColor, middleware.GetDisplayName(r), csrfField, flash, errorMsg).Render(r.Context(), w)
+}
+
+// Update changes the schedule of a series, see SeriesService.Update.
+func (h *SeriesHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	back := fmt.Sprintf("/admin/series/%s", id)
+
+	horizonDays, err := strconv.Atoi(r.FormValue("horizon_days"))
+	if err != nil {
+		middleware.SetFlash(w, r, "error", errInvalid(ctx, "field.repeat_horizon").Error())
+		http.Redirect(w, r, back, http.StatusFound)
+		return
+	}
+	err = h.series.Update(id, r.FormValue("rule"), r.FormValue("exceptions"), horizonDays, time.Now())
+	switch {
+	case errors.Is(err, services.ErrSeriesNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrInvalidRule), errors.Is(err, services.ErrInvalidExceptionDate), errors.Is(err, services.ErrInvalidHorizon):
+		middleware.SetFlash(w, r, "error", seriesErrorMessage(ctx, err))
+	case err != nil:
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	default:
+		middleware.SetFlash(w, r, "success", i18n.T(ctx, "flash.series_updated"))
+	}
+	http.Redirect(w, r, back, http.StatusFound)
+}
+
+// Delete ends a series, keeping its occurrences as standalone events.
+func (h *SeriesHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.series.Delete(chi.URLParam(r, "id")); err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.series_deleted"))
+	http.Redirect(w, r, "/admin/series", http.StatusFound)
+}
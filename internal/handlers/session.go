@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/middleware"
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/templates/admin"
+)
+
+// maxScheduleSize bounds the Frab schedules imported.
+const maxScheduleSize = 4 << 20
+
+type SessionHandler struct {
+	sessions *services.SessionService
+	events   *services.EventService
+	settings *services.SettingsService
+	baseURL  string
+}
+
+func NewSessionHandler(sessions *services.SessionService, events *services.EventService, settings *services.SettingsService, baseURL string) *SessionHandler {
+	return &SessionHandler{sessions: sessions, events: events, settings: settings, baseURL: baseURL}
+}
+
+// Schedule exports the agenda of a public event as a Frab schedule.
+func (h *SessionHandler) Schedule(w http.ResponseWriter, r *http.Request) {
+	event, err := h.events.GetBySlug(chi.URLParam(r, "slug"))
+	if err != nil || event == nil || event.Status == models.EventDraft {
+		http.NotFound(w, r)
+		return
+	}
+	h.writeSchedule(w, r, event)
+}
+
+// Admin routes
+
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	attendees, err := h.sessions.AttendeeNames(event.ID)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	flashes := middleware.GetFlashes(w, r, "success")
+	flash := ""
+	if len(flashes) > 0 {
+		flash = flashes[0]
+	}
+	errorFlashes := middleware.GetFlashes(w, r, "error")
+	errorMsg := ""
+	if len(errorFlashes) > 0 {
+		errorMsg = errorFlashes[0]
+	}
+	admin.Sessions(event, attendees, siteName, accentColor, middleware.GetDisplayName(r), csrfField, flash, errorMsg).Render(r.Context(), w)
+}
+
+func (h *SessionHandler) NewForm(w http.ResponseWriter, r *http.Request) {
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// Sessions follow each other by default
+	start := event.EventDate
+	if n := len(event.Sessions); n > 0 {
+		start = event.Sessions[n-1].EndsAt
+	}
+	se := &models.Session{EventID: event.ID, StartsAt: start, EndsAt: start.Add(time.Hour)}
+	h.renderForm(w, r, event, se, false, "")
+}
+
+func (h *SessionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	se, err := parseSessionForm(r)
+	se.EventID = event.ID
+	if err == nil {
+		err = h.sessions.Create(se)
+	}
+	if err != nil {
+		h.renderFormError(w, r, event, se, false, err)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.session_created"))
+	http.Redirect(w, r, sessionsPath(event.ID), http.StatusFound)
+}
+
+func (h *SessionHandler) EditForm(w http.ResponseWriter, r *http.Request) {
+	event, se, ok := h.eventSession(w, r)
+	if !ok {
+		return
+	}
+	h.renderForm(w, r, event, se, true, "")
+}
+
+func (h *SessionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	event, existing, ok := h.eventSession(w, r)
+	if !ok {
+		return
+	}
+	se, err := parseSessionForm(r)
+	se.ID = existing.ID
+	se.EventID = event.ID
+	if err == nil {
+		err = h.sessions.Update(se)
+	}
+	if err != nil {
+		h.renderFormError(w, r, event, se, true, err)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.session_updated"))
+	http.Redirect(w, r, sessionsPath(event.ID), http.StatusFound)
+}
+
+func (h *SessionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	event, se, ok := h.eventSession(w, r)
+	if !ok {
+		return
+	}
+	if err := h.sessions.Delete(se.ID); err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.session_deleted"))
+	http.Redirect(w, r, sessionsPath(event.ID), http.StatusFound)
+}
+
+// Import replaces the agenda with an uploaded Frab schedule.
+func (h *SessionHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxScheduleSize)
+	file, _, err := r.FormFile("schedule")
+	if err != nil {
+		middleware.SetFlash(w, r, "error", i18n.T(ctx, "error.schedule_missing"))
+		http.Redirect(w, r, sessionsPath(event.ID), http.StatusFound)
+		return
+	}
+	defer file.Close()
+
+	n, err := h.sessions.Import(event.ID, file)
+	switch {
+	case errors.Is(err, services.ErrInvalidSchedule):
+		slog.WarnContext(ctx, "schedule import rejected", "event", event.Slug, "error", err)
+		middleware.SetFlash(w, r, "error", i18n.T(ctx, "error.schedule_invalid"))
+	case err != nil:
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	default:
+		middleware.SetFlash(w, r, "success", i18n.Tn(ctx, "flash.sessions_imported", n))
+	}
+	http.Redirect(w, r, sessionsPath(event.ID), http.StatusFound)
+}
+
+// Export downloads the agenda of any event, drafts included, as a Frab
+// schedule.
+func (h *SessionHandler) Export(w http.ResponseWriter, r *http.Request) {
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-schedule.xml"`, event.Slug))
+	h.writeSchedule(w, r, event)
+}
+
+func (h *SessionHandler) writeSchedule(w http.ResponseWriter, r *http.Request, event *models.Event) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if err := h.sessions.Export(w, event, h.baseURL+"/event/"+event.Slug); err != nil {
+		slog.ErrorContext(r.Context(), "could not export the schedule", "event", event.Slug, "error", err)
+	}
+}
+
+// eventSession returns the event and session of the URL, or responds with
+// Not Found.
+func (h *SessionHandler) eventSession(w http.ResponseWriter, r *http.Request) (*models.Event, *models.Session, bool) {
+	event, err := h.events.GetByID(chi.URLParam(r, "id"))
+	if err != nil || event == nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	se, err := h.sessions.GetByID(chi.URLParam(r, "sessionID"))
+	if err != nil || se == nil || se.EventID != event.ID {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	return event, se, true
+}
+
+func (h *SessionHandler) renderForm(w http.ResponseWriter, r *http.Request, event *models.Event, se *models.Session, isEdit bool, errorMsg string) {
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	admin.SessionForm(event, se, isEdit, siteName, accentColor, middleware.GetDisplayName(r), csrfField, errorMsg).Render(r.Context(), w)
+}
+
+func (h *SessionHandler) renderFormError(w http.ResponseWriter, r *http.Request, event *models.Event, se *models.Session, isEdit bool, err error) {
+	msg := sessionErrorMessage(r.Context(), err)
+	if msg == "" {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	h.renderForm(w, r, event, se, isEdit, msg)
+}
+
+func parseSessionForm(r *http.Request) (*models.Session, error) {
+	ctx := r.Context()
+	se := &models.Session{
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Speaker:     strings.TrimSpace(r.FormValue("speaker")),
+		Room:        strings.TrimSpace(r.FormValue("room")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+	}
+	startsAt, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("starts_at"), time.Local)
+	if err != nil {
+		return se, errInvalid(ctx, "field.session_starts_at")
+	}
+	se.StartsAt = startsAt
+	endsAt, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("ends_at"), time.Local)
+	if err != nil {
+		return se, errInvalid(ctx, "field.session_ends_at")
+	}
+	se.EndsAt = endsAt
+	if v := r.FormValue("max_capacity"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return se, errInvalid(ctx, "field.capacity")
+		}
+		se.MaxCapacity = &n
+	}
+	return se, nil
+}
+
+// sessionErrorMessage returns the message shown for an invalid session, or
+// "" for internal errors.
+func sessionErrorMessage(ctx context.Context, err error) string {
+	var ve *validationError
+	switch {
+	case errors.As(err, &ve):
+		return ve.Error()
+	case errors.Is(err, services.ErrSessionTitleRequired):
+		return errMissing(ctx, "field.title").Error()
+	case errors.Is(err, services.ErrInvalidSessionTime):
+		return i18n.T(ctx, "error.session_ends_before_start")
+	}
+	return ""
+}
+
+func sessionsPath(eventID string) string {
+	return fmt.Sprintf("/admin/events/%s/sessions", eventID)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/middleware"
+	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/templates/admin"
+)
+
+type TagHandler struct {
+	tags     *services.TagService
+	settings *services.SettingsService
+}
+
+func NewTagHandler(tags *services.TagService, settings *services.SettingsService) *TagHandler {
+	return &TagHandler{tags: tags, settings: settings}
+}
+
+func (h *TagHandler) List(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.tags.List()
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	flashes := middleware.GetFlashes(w, r, "success")
+	flash := ""
+	if len(flashes) > 0 {
+		flash = flashes[0]
+	}
+	errorFlashes := middleware.GetFlashes(w, r, "error")
+	errorMsg := ""
+	if len(errorFlashes) > 0 {
+		errorMsg = errorFlashes[0]
+	}
+	admin.Tags(tags, siteName, accentColor, middleware.GetDisplayName(r), csrfField, flash, errorMsg).Render(r.Context(), w)
+}
+
+func (h *TagHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.tags.Rename(chi.URLParam(r, "id"), r.FormValue("name"))
+	switch {
+	case errors.Is(err, services.ErrTagNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrTagExists):
+		middleware.SetFlash(w, r, "error", i18n.T(ctx, "error.tag_exists"))
+	case errors.Is(err, services.ErrNameRequired):
+		middleware.SetFlash(w, r, "error", i18n.T(ctx, "error.tag_name_required"))
+	case err != nil:
+		http.Error(w, i18n.T(ctx, "error.internal"), http.StatusInternalServerError)
+		return
+	default:
+		middleware.SetFlash(w, r, "success", i18n.T(ctx, "flash.tag_renamed"))
+	}
+	http.Redirect(w, r, "/admin/tags", http.StatusFound)
+}
+
+func (h *TagHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.tags.Delete(chi.URLParam(r, "id")); err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.tag_deleted"))
+	http.Redirect(w, r, "/admin/tags", http.StatusFound)
+}
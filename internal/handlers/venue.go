@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/middleware"
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/templates/admin"
+	"github.com/toulibre/libreregistration/templates/public"
+)
+
+type VenueHandler struct {
+	venues   *services.VenueService
+	events   *services.EventService
+	settings *services.SettingsService
+}
+
+func NewVenueHandler(venues *services.VenueService, events *services.EventService, settings *services.SettingsService) *VenueHandler {
+	return &VenueHandler{venues: venues, events: events, settings: settings}
+}
+
+// Show lists the upcoming events at a venue.
+func (h *VenueHandler) Show(w http.ResponseWriter, r *http.Request) {
+	venue, err := h.venues.GetBySlug(chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	if venue == nil {
+		http.NotFound(w, r)
+		return
+	}
+	events, err := h.events.ListUpcomingByVenue(venue.ID)
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	siteName, accentColor := h.settings.GetSiteSettings()
+	public.Venue(venue, events, siteName, accentColor).Render(r.Context(), w)
+}
+
+// Admin routes
+
+func (h *VenueHandler) List(w http.ResponseWriter, r *http.Request) {
+	venues, err := h.venues.List()
+	if err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	flashes := middleware.GetFlashes(w, r, "success")
+	flash := ""
+	if len(flashes) > 0 {
+		flash = flashes[0]
+	}
+	admin.Venues(venues, siteName, accentColor, middleware.GetDisplayName(r), csrfField, flash).Render(r.Context(), w)
+}
+
+func (h *VenueHandler) NewForm(w http.ResponseWriter, r *http.Request) {
+	h.renderForm(w, r, &models.Venue{}, false, "")
+}
+
+func (h *VenueHandler) Create(w http.ResponseWriter, r *http.Request) {
+	venue, err := parseVenueForm(r)
+	if err == nil {
+		err = h.venues.Create(venue)
+	}
+	if err != nil {
+		h.renderFormError(w, r, venue, false, err)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.venue_created"))
+	http.Redirect(w, r, "/admin/venues", http.StatusFound)
+}
+
+func (h *VenueHandler) EditForm(w http.ResponseWriter, r *http.Request) {
+	venue, err := h.venues.GetByID(chi.URLParam(r, "id"))
+	if err != nil || venue == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.renderForm(w, r, venue, true, "")
+}
+
+func (h *VenueHandler) Update(w http.ResponseWriter, r *http.Request) {
+	venue, err := parseVenueForm(r)
+	venue.ID = chi.URLParam(r, "id")
+	if err == nil {
+		err = h.venues.Update(venue)
+	}
+	if errors.Is(err, services.ErrVenueNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.renderFormError(w, r, venue, true, err)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.venue_updated"))
+	http.Redirect(w, r, "/admin/venues", http.StatusFound)
+}
+
+func (h *VenueHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.venues.Delete(chi.URLParam(r, "id")); err != nil {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.SetFlash(w, r, "success", i18n.T(r.Context(), "flash.venue_deleted"))
+	http.Redirect(w, r, "/admin/venues", http.StatusFound)
+}
+
+func (h *VenueHandler) renderForm(w http.ResponseWriter, r *http.Request, venue *models.Venue, isEdit bool, errorMsg string) {
+	siteName, accentColor := h.settings.GetSiteSettings()
+	csrfField := middleware.CSRFTemplateField(r)
+	admin.VenueForm(venue, isEdit, siteName, accentColor, middleware.GetDisplayName(r), csrfField, errorMsg).Render(r.Context(), w)
+}
+
+func (h *VenueHandler) renderFormError(w http.ResponseWriter, r *http.Request, venue *models.Venue, isEdit bool, err error) {
+	msg := venueErrorMessage(r.Context(), err)
+	if msg == "" {
+		http.Error(w, i18n.T(r.Context(), "error.internal"), http.StatusInternalServerError)
+		return
+	}
+	h.renderForm(w, r, venue, isEdit, msg)
+}
+
+func parseVenueForm(r *http.Request) (*models.Venue, error) {
+	ctx := r.Context()
+	venue := &models.Venue{
+		Name:          strings.TrimSpace(r.FormValue("name")),
+		Address:       strings.TrimSpace(r.FormValue("address")),
+		Accessibility: strings.TrimSpace(r.FormValue("accessibility")),
+	}
+
+	if cap := r.FormValue("max_capacity"); cap != "" {
+		n, err := strconv.Atoi(cap)
+		if err != nil || n < 1 {
+			return venue, errInvalid(ctx, "field.capacity")
+		}
+		venue.MaxCapacity = &n
+	}
+
+	if lat := r.FormValue("latitude"); lat != "" {
+		v, err := strconv.ParseFloat(lat, 64)
+		if err != nil || v < -90 || v > 90 {
+			return venue, errInvalid(ctx, "field.latitude")
+		}
+		venue.Latitude = &v
+	}
+
+	if lng := r.FormValue("longitude"); lng != "" {
+		v, err := strconv.ParseFloat(lng, 64)
+		if err != nil || v < -180 || v > 180 {
+			return venue, errInvalid(ctx, "field.longitude")
+		}
+		venue.Longitude = &v
+	}
+
+	if (venue.Latitude == nil) != (venue.Longitude == nil) {
+		return venue, &validationError{msg: i18n.T(ctx, "error.coordinates_incomplete")}
+	}
+	return venue, nil
+}
+
+// venueErrorMessage returns the message shown for an invalid venue, or "" for
+// internal errors.
+func venueErrorMessage(ctx context.Context, err error) string {
+	var ve *validationError
+	switch {
+	case errors.As(err, &ve):
+		return ve.Error()
+	case errors.Is(err, services.ErrVenueNameRequired):
+		return errMissing(ctx, "field.venue_name").Error()
+	}
+	return ""
+}
@@ -99,6 +99,17 @@ func FormatDateTime(ctx context.Context, t time.Time) string {
 	}
 }
 
+// FormatTime formats a time as a localized time of day.
+func FormatTime(ctx context.Context, t time.Time) string {
+	lang := Locale(ctx)
+	switch lang {
+	case "en":
+		return t.Format("3:04 PM")
+	default:
+		return t.Format("15h04")
+	}
+}
+
 // FormatDateTimeCSV formats a time for CSV export.
 func FormatDateTimeCSV(ctx context.Context, t time.Time) string {
 	lang := Locale(ctx)
@@ -110,6 +121,19 @@ func FormatDateTimeCSV(ctx context.Context, t time.Time) string {
 	}
 }
 
+// Matches reports whether s is the translation of key in any locale,
+// ignoring case and surrounding spaces. It recognizes values written in
+// another language, such as the headers of a CSV export.
+func Matches(key, s string) bool {
+	s = strings.TrimSpace(s)
+	for _, m := range translations {
+		if v, ok := m[key]; ok && strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
 // HTMLLang returns the BCP47 language tag for the HTML lang attribute.
 func HTMLLang(ctx context.Context) string {
 	return Locale(ctx)
@@ -0,0 +1,124 @@
+// Package logging sets up the structured logger of the application. Records
+// carry the ID of the request they were logged for, and sensitive values are
+// redacted unless told otherwise.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Options configure the logger.
+type Options struct {
+	Format string // "text" or "json"
+	Level  string // "debug", "info", "warn" or "error"
+	Redact bool   // hide the sensitive values
+}
+
+// New returns a logger writing to w.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", opts.Level)
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	if opts.Redact {
+		handlerOpts.ReplaceAttr = redact
+	}
+
+	var h slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "text":
+		h = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		h = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", opts.Format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// Setup makes a logger writing to w the default one, including for the
+// standard log package.
+func Setup(w io.Writer, opts Options) error {
+	logger, err := New(w, opts)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of a request, added to the
+// records logged with it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request of the context, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// contextHandler adds the request ID of the context to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Redacted replaces the sensitive values in the logs.
+const Redacted = "[redacted]"
+
+// sensitiveKeys are the attributes whose values are redacted.
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"cancel_token":  true,
+	"preview_token": true,
+	"authorization": true,
+	"email":         true,
+	"to":            true,
+}
+
+// tokenPaths match the URL paths holding a secret token.
+var tokenPaths = regexp.MustCompile(`^/cancel/[^/]+`)
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	switch {
+	case sensitiveKeys[a.Key]:
+		return slog.String(a.Key, Redacted)
+	case a.Key == "path" && a.Value.Kind() == slog.KindString:
+		return slog.String(a.Key, tokenPaths.ReplaceAllString(a.Value.String(), "/cancel/"+Redacted))
+	}
+	return a
+}
@@ -3,23 +3,76 @@ package mail
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/smtp"
+	"time"
 
 	"github.com/toulibre/libreregistration/internal/config"
 	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/metrics"
 )
 
 func SendConfirmation(cfg *config.Config, ctx context.Context, to, eventTitle, cancelURL string) {
 	subject := i18n.Tf(ctx, "mail.confirmation_subject_fmt", eventTitle)
 	body := i18n.Tf(ctx, "mail.confirmation_body_fmt", eventTitle, cancelURL, cfg.SMTPFrom)
 
-	if err := send(cfg, to, subject, body); err != nil {
-		log.Printf("Failed to send email to %s: %v", to, err)
+	if err := send(ctx, cfg, to, subject, body); err != nil {
+		slog.ErrorContext(ctx, "could not send email", "to", to, "error", err)
 	}
 }
 
-func send(cfg *config.Config, to, subject, body string) error {
+// SendApplicationReceived tells the attendee their registration awaits review.
+func SendApplicationReceived(cfg *config.Config, ctx context.Context, to, eventTitle, cancelURL string) {
+	subject := i18n.Tf(ctx, "mail.pending_subject_fmt", eventTitle)
+	body := i18n.Tf(ctx, "mail.pending_body_fmt", eventTitle, cancelURL, cfg.SMTPFrom)
+
+	if err := send(ctx, cfg, to, subject, body); err != nil {
+		slog.ErrorContext(ctx, "could not send email", "to", to, "error", err)
+	}
+}
+
+// SendApproval tells the attendee their registration has been approved.
+func SendApproval(cfg *config.Config, ctx context.Context, to, eventTitle, cancelURL string) {
+	subject := i18n.Tf(ctx, "mail.approved_subject_fmt", eventTitle)
+	body := i18n.Tf(ctx, "mail.approved_body_fmt", eventTitle, cancelURL, cfg.SMTPFrom)
+
+	if err := send(ctx, cfg, to, subject, body); err != nil {
+		slog.ErrorContext(ctx, "could not send email", "to", to, "error", err)
+	}
+}
+
+// SendRejection tells the attendee their registration has been declined.
+func SendRejection(cfg *config.Config, ctx context.Context, to, eventTitle string) {
+	subject := i18n.Tf(ctx, "mail.rejected_subject_fmt", eventTitle)
+	body := i18n.Tf(ctx, "mail.rejected_body_fmt", eventTitle, cfg.SMTPFrom)
+
+	if err := send(ctx, cfg, to, subject, body); err != nil {
+		slog.ErrorContext(ctx, "could not send email", "to", to, "error", err)
+	}
+}
+
+// SendUpdate tells the attendee an organizer changed their registration.
+func SendUpdate(cfg *config.Config, ctx context.Context, to, eventTitle, cancelURL string) {
+	subject := i18n.Tf(ctx, "mail.updated_subject_fmt", eventTitle)
+	body := i18n.Tf(ctx, "mail.updated_body_fmt", eventTitle, cancelURL, cfg.SMTPFrom)
+
+	if err := send(ctx, cfg, to, subject, body); err != nil {
+		slog.ErrorContext(ctx, "could not send email", "to", to, "error", err)
+	}
+}
+
+// SendMove tells the attendee an organizer moved their registration to
+// another event.
+func SendMove(cfg *config.Config, ctx context.Context, to, fromTitle, toTitle string, toDate time.Time, cancelURL string) {
+	subject := i18n.Tf(ctx, "mail.moved_subject_fmt", toTitle)
+	body := i18n.Tf(ctx, "mail.moved_body_fmt", fromTitle, toTitle, i18n.FormatDateTime(ctx, toDate), cancelURL, cfg.SMTPFrom)
+
+	if err := send(ctx, cfg, to, subject, body); err != nil {
+		slog.ErrorContext(ctx, "could not send email", "to", to, "error", err)
+	}
+}
+
+func send(ctx context.Context, cfg *config.Config, to, subject, body string) error {
 	addr := fmt.Sprintf("%s:%s", cfg.SMTPHost, cfg.SMTPPort)
 	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
 		cfg.SMTPFrom, to, subject, body)
@@ -29,5 +82,12 @@ func send(cfg *config.Config, to, subject, body string) error {
 		auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPHost)
 	}
 
-	return smtp.SendMail(addr, auth, cfg.SMTPFrom, []string{to}, []byte(msg))
+	err := smtp.SendMail(addr, auth, cfg.SMTPFrom, []string{to}, []byte(msg))
+	if err != nil {
+		metrics.Mails.Inc("failed")
+		return err
+	}
+	metrics.Mails.Inc("sent")
+	slog.DebugContext(ctx, "email sent", "to", to, "subject", subject)
+	return nil
 }
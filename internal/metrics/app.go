@@ -0,0 +1,19 @@
+package metrics
+
+// Metrics of the application, updated where the events happen.
+var (
+	HTTPRequests = NewCounter("http_requests",
+		"HTTP requests handled, by route pattern, method and status code.", "route", "method", "code")
+	HTTPDuration = NewHistogram("http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by route pattern and method.", DefaultBuckets, "route", "method")
+	Registrations = NewCounter("registrations",
+		"Registrations recorded, by source and resulting status.", "source", "status")
+	Cancellations = NewCounter("cancellations",
+		"Registrations cancelled by their attendee.")
+	CaptchaFailures = NewCounter("captcha_failures",
+		"Registration forms refused by the anti-spam check, by provider.", "provider")
+	Mails = NewCounter("mails",
+		"Emails handed to the SMTP server, by result (sent or failed).", "result")
+	Backups = NewCounter("backups",
+		"Scheduled and command line backups, by result (created or failed).", "result")
+)
@@ -0,0 +1,266 @@
+// Package metrics keeps the counters and histograms of the application and
+// writes them in the OpenMetrics text format, for Prometheus to scrape.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the OpenMetrics text format.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// namespace prefixes the names of all the metrics.
+const namespace = "libreregistration_"
+
+// DefaultBuckets are the upper bounds of the latency histograms, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector is a metric family.
+type Collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metric families written together.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// Default is the registry of the metrics declared by this package.
+var Default = &Registry{}
+
+// Register adds collectors to the registry.
+func (r *Registry) Register(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, cs...)
+}
+
+// Write writes the metrics of the registry and the extra collectors,
+// usually collected at scrape time.
+func (r *Registry) Write(w io.Writer, extra ...Collector) error {
+	r.mu.Lock()
+	collectors := append(append([]Collector(nil), r.collectors...), extra...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// desc describes a metric family.
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", d.name, typ, d.name, escaper.Replace(d.help))
+}
+
+// series is the state of a metric for a set of label values.
+type series[T any] struct {
+	labels []string
+	value  T
+}
+
+// vec keeps the series of a metric family by label values.
+type vec[T any] struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series[T]
+	init   func() T
+}
+
+func (v *vec[T]) with(values []string, fn func(*T)) {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series[T]{labels: append([]string(nil), values...), value: v.init()}
+		v.series[key] = s
+	}
+	fn(&s.value)
+}
+
+// each calls fn for each series, ordered by label values.
+func (v *vec[T]) each(fn func(labels []string, value T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fn(v.series[k].labels, v.series[k].value)
+	}
+}
+
+// Counter counts events, by label values.
+type Counter struct {
+	vec[float64]
+}
+
+// NewCounter declares a counter in the default registry. Its name is given
+// without the namespace nor the _total suffix.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec[float64]{
+		desc:   desc{name: namespace + name, help: help, labels: labels},
+		series: make(map[string]*series[float64]),
+		init:   func() float64 { return 0 },
+	}}
+	if len(labels) == 0 {
+		c.with(nil, func(*float64) {})
+	}
+	Default.Register(c)
+	return c
+}
+
+// Inc adds one to the counter of the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds n, which must not be negative, to the counter of the label values.
+func (c *Counter) Add(n float64, values ...string) {
+	c.with(values, func(v *float64) { *v += n })
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	c.each(func(labels []string, value float64) {
+		writeSample(w, c.name+"_total", c.desc.labels, labels, "", "", value)
+	})
+}
+
+// Histogram counts observations in buckets, by label values.
+type Histogram struct {
+	vec[*histogramValue]
+	buckets []float64
+}
+
+type histogramValue struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram declares a histogram in the default registry, with the upper
+// bounds of its buckets in increasing order.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{buckets: buckets}
+	h.vec = vec[*histogramValue]{
+		desc:   desc{name: namespace + name, help: help, labels: labels},
+		series: make(map[string]*series[*histogramValue]),
+		init:   func() *histogramValue { return &histogramValue{counts: make([]uint64, len(buckets))} },
+	}
+	Default.Register(h)
+	return h
+}
+
+// Observe records a value for the label values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.with(values, func(v **histogramValue) {
+		hv := *v
+		if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+			hv.counts[i]++
+		}
+		hv.count++
+		hv.sum += value
+	})
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.each(func(labels []string, hv *histogramValue) {
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += hv.counts[i]
+			writeSample(w, h.name+"_bucket", h.desc.labels, labels, "le", formatFloat(le), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.desc.labels, labels, "le", "+Inf", float64(hv.count))
+		writeSample(w, h.name+"_count", h.desc.labels, labels, "", "", float64(hv.count))
+		writeSample(w, h.name+"_sum", h.desc.labels, labels, "", "", hv.sum)
+	})
+}
+
+// Value is a metric without labels collected at scrape time, such as the
+// size of a pool.
+type Value struct {
+	desc
+	typ   string
+	value float64
+}
+
+// Gauge returns a gauge of the given value, to pass to Registry.Write.
+func Gauge(name, help string, value float64) *Value {
+	return &Value{desc: desc{name: namespace + name, help: help}, typ: "gauge", value: value}
+}
+
+// Total returns a counter of the given total, to pass to Registry.Write.
+func Total(name, help string, total float64) *Value {
+	return &Value{desc: desc{name: namespace + name, help: help}, typ: "counter", value: total}
+}
+
+func (v *Value) write(w *bufio.Writer) {
+	v.header(w, v.typ)
+	name := v.name
+	if v.typ == "counter" {
+		name += "_total"
+	}
+	writeSample(w, name, nil, nil, "", "", v.value)
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l, escaper.Replace(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escaper escapes label values and help texts.
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
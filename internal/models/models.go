@@ -27,28 +27,166 @@ func (u User) DisplayName() string {
 	return u.Username
 }
 
+// DuplicatePolicy controls what happens when someone registers twice for an event.
+type DuplicatePolicy string
+
+const (
+	DuplicateAllow  DuplicatePolicy = "allow"
+	DuplicateWarn   DuplicatePolicy = "warn"
+	DuplicateReject DuplicatePolicy = "reject"
+)
+
+// EventStatus controls the visibility of an event. Drafts are only shown
+// with their preview link, archived events are hidden from the home page.
+type EventStatus string
+
+const (
+	EventDraft     EventStatus = "draft"
+	EventPublished EventStatus = "published"
+	EventArchived  EventStatus = "archived"
+)
+
 type Event struct {
-	ID                   string
-	Title                string
-	Slug                 string
-	Description          string
-	DescriptionHTML      string // rendered markdown, not stored
-	Location             string
-	EventDate            time.Time
-	RegistrationDeadline *time.Time
-	MaxCapacity          *int
-	AttendeeListPublic   bool
-	RegistrationOpen     bool
-	ImagePath            string
-	BannerPath           string
-	Latitude             *float64
-	Longitude            *float64
-	CreatedBy            string
-	CreatedAt            time.Time
-	UpdatedAt            time.Time
-	RegistrationCount    int // computed, not stored
+	ID                    string
+	Title                 string
+	Slug                  string
+	Description           string
+	DescriptionHTML       string // rendered markdown, not stored
+	Location              string // overrides the name of the venue
+	EventDate             time.Time
+	EndDate               *time.Time // last day of multi-day events
+	RegistrationDeadline  *time.Time
+	MaxCapacity           *int
+	AttendeeListPublic    bool
+	RegistrationOpen      bool
+	ImagePath             string
+	BannerPath            string
+	Latitude              *float64 // overrides the coordinates of the venue
+	Longitude             *float64
+	VenueID               *string
+	Venue                 *Venue // only loaded with a single event
+	DuplicatePolicy       DuplicatePolicy
+	ApprovalRequired      bool
+	MaxCompanions         int // companions allowed per registration, 0 disables group registrations
+	Status                EventStatus
+	PublishAt             *time.Time // a draft is published at that time
+	RegistrationOpensAt   *time.Time // registration opens at that time
+	RegistrationsOpenedAt *time.Time // when registration first opened
+	PreviewToken          string     // grants access to the draft page
+	Tags                  []Tag      // stored in event_tags
+	Sessions              []Session  // agenda, only loaded with a single event
+	SeriesID              *string    // series the event is an occurrence of
+	OccurrenceDate        string     // date of the occurrence in its series, as YYYY-MM-DD
+	CreatedBy             string
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	RegistrationCount     int    // seats taken by confirmed registrations, computed, not stored
+	PendingCount          int    // registrations awaiting review, computed, not stored
+	SeriesSlug            string // slug of the series, computed, not stored
+	VenueName             string // name of the venue, computed, not stored
+	VenueSlug             string // slug of the venue, computed, not stored
+}
+
+// End returns when the event ends: its end date for multi-day events, or
+// else its date. Events are to come until they end.
+func (e *Event) End() time.Time {
+	if e.EndDate != nil {
+		return *e.EndDate
+	}
+	return e.EventDate
+}
+
+// Place returns where the event takes place: its own location, or else the
+// name of its venue.
+func (e *Event) Place() string {
+	if e.Location != "" {
+		return e.Location
+	}
+	return e.VenueName
+}
+
+// Coordinates returns the position of the event on a map: its own, or else
+// those of its venue when loaded. Both are nil when unknown.
+func (e *Event) Coordinates() (lat, lng *float64) {
+	if e.Latitude != nil && e.Longitude != nil {
+		return e.Latitude, e.Longitude
+	}
+	if e.Venue != nil && e.Venue.Latitude != nil && e.Venue.Longitude != nil {
+		return e.Venue.Latitude, e.Venue.Longitude
+	}
+	return nil, nil
+}
+
+// Venue is a place hosting events. Events at a venue take its name and
+// coordinates unless they set their own, and its capacity by default.
+type Venue struct {
+	ID            string
+	Name          string
+	Slug          string
+	Address       string
+	Latitude      *float64
+	Longitude     *float64
+	Accessibility string // access notes: steps, lift, toilets…
+	MaxCapacity   *int   // default capacity of its events
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	EventCount    int // upcoming published events, computed, not stored
 }
 
+// Session is a talk or workshop in the agenda of an event. Attendees can
+// register to the sessions with a capacity.
+type Session struct {
+	ID                string
+	EventID           string
+	Title             string
+	Speaker           string
+	Room              string
+	Description       string
+	StartsAt          time.Time
+	EndsAt            time.Time
+	MaxCapacity       *int
+	CreatedAt         time.Time
+	RegistrationCount int // seats taken by confirmed registrations, computed, not stored
+}
+
+// Full reports whether the session has no seats left.
+func (s Session) Full() bool {
+	return s.MaxCapacity != nil && s.RegistrationCount >= *s.MaxCapacity
+}
+
+// Tag groups events by category on the public site.
+type Tag struct {
+	ID         string
+	Name       string
+	Slug       string
+	EventCount int // computed, not stored
+}
+
+// Series is a recurring event. Its occurrences are events generated ahead of
+// time from the recurrence rule, each with its own registrations.
+type Series struct {
+	ID          string
+	Title       string
+	Slug        string
+	Rule        string    // in RRULE syntax, see package recurrence
+	StartsAt    time.Time // first occurrence, the rule starts from
+	Exceptions  []string  // dates of the skipped occurrences, as YYYY-MM-DD
+	HorizonDays int       // occurrences are generated this many days ahead
+	CreatedBy   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// RegistrationStatus is the review state of a registration. Only confirmed
+// registrations take a place.
+type RegistrationStatus string
+
+const (
+	StatusPending   RegistrationStatus = "pending"
+	StatusConfirmed RegistrationStatus = "confirmed"
+	StatusRejected  RegistrationStatus = "rejected"
+)
+
 type Registration struct {
 	ID           string
 	EventID      string
@@ -56,10 +194,173 @@ type Registration struct {
 	Email        string
 	Comment      string
 	CancelToken  string
+	Status       RegistrationStatus
+	Seats        int // the attendee plus their companions
 	RegisteredAt time.Time
+	Companions   []Companion
+	SessionIDs   []string // sessions of the event the attendee registered to
+	Duplicate    bool     // same normalized email (or name) as another registration, computed, not stored
+}
+
+// RegistrationCount is a number of registrations, and of the seats they take.
+type RegistrationCount struct {
+	Registrations int
+	Seats         int
+}
+
+// RegistrationCounts are the registrations to an event counted by status.
+type RegistrationCounts map[RegistrationStatus]RegistrationCount
+
+// Total returns the count of the registrations, whatever their status.
+func (c RegistrationCounts) Total() RegistrationCount {
+	var total RegistrationCount
+	for _, n := range c {
+		total.Registrations += n.Registrations
+		total.Seats += n.Seats
+	}
+	return total
+}
+
+// Cancellation records a registration cancelled by its attendee, which is
+// deleted, for the statistics.
+type Cancellation struct {
+	RegistrationID string
+	EventID        string
+	Email          string
+	Seats          int
+	RegisteredAt   time.Time
+	CancelledAt    time.Time
+}
+
+// Companion is a person registered along with the attendee, taking a seat of
+// their own.
+type Companion struct {
+	ID             string
+	RegistrationID string
+	Name           string
+	Position       int
 }
 
 type Setting struct {
 	Key   string
 	Value string
 }
+
+// EventFilter selects and orders the events of a list. Its zero value selects
+// all of them, latest first, or best matches first for a search.
+type EventFilter struct {
+	Query     string        // words to search for
+	Statuses  []EventStatus // any status when empty
+	Upcoming  *bool         // events to come or past ones, both when nil
+	Open      *bool         // registration open or closed, both when nil
+	CreatedBy string        // user ID, anyone when empty
+	From, To  *time.Time    // range of the event date, To excluded
+	Sort      string        // "title", "date", "registrations" or "status"
+	Desc      bool
+}
+
+// RegistrationFilter selects and orders the registrations of an event. Its
+// zero value selects all of them, in registration order, or best matches
+// first for a search.
+type RegistrationFilter struct {
+	Query  string
+	Status RegistrationStatus // any status when empty
+	Sort   string             // "name", "email", "date" or "status"
+	Desc   bool
+}
+
+// Page selects a page of a result list, numbered from 1, and tells how many
+// results there are in all.
+type Page struct {
+	Number int
+	Size   int
+	Total  int // results on all the pages, filled in by the stores' callers
+}
+
+// Offset returns the number of results before the page.
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// Count returns the number of pages, at least one.
+func (p Page) Count() int {
+	if p.Size <= 0 || p.Total <= p.Size {
+		return 1
+	}
+	return (p.Total + p.Size - 1) / p.Size
+}
+
+func (p Page) HasPrev() bool {
+	return p.Number > 1
+}
+
+func (p Page) HasNext() bool {
+	return p.Number < p.Count()
+}
+
+// Analytics sums up the registrations across events for the dashboard.
+type Analytics struct {
+	Curves         []RegistrationCurve // of the latest events with registrations
+	FillRates      []FillRate          // of the latest events with a capacity
+	Registrations  int                 // registrations not rejected, cancelled ones excluded
+	Cancellations  int
+	Weekdays       []WeekdayStat       // Monday first
+	Attendees      int                 // distinct emails
+	Returning      []ReturningAttendee // most frequent first
+	ReturningCount int
+}
+
+// CancellationRate returns the share of the registrations that were
+// cancelled, between 0 and 1.
+func (a Analytics) CancellationRate() float64 {
+	if a.Registrations+a.Cancellations == 0 {
+		return 0
+	}
+	return float64(a.Cancellations) / float64(a.Registrations+a.Cancellations)
+}
+
+// RegistrationCurve is the number of seats taken at an event along the days
+// since its registrations opened.
+type RegistrationCurve struct {
+	Event  Event
+	Points []CurvePoint // by increasing day, starting at day 0
+}
+
+type CurvePoint struct {
+	Day   float64
+	Seats int
+}
+
+// FillRate is the number of seats taken at an event against its capacity.
+type FillRate struct {
+	Event    Event
+	Seats    int
+	Capacity int
+}
+
+func (f FillRate) Rate() float64 {
+	return float64(f.Seats) / float64(f.Capacity)
+}
+
+// WeekdayStat counts the past events taking place on a day of the week and
+// their confirmed seats.
+type WeekdayStat struct {
+	Weekday time.Weekday
+	Events  int
+	Seats   int
+}
+
+// Average returns the average number of seats per event, 0 without events.
+func (w WeekdayStat) Average() float64 {
+	if w.Events == 0 {
+		return 0
+	}
+	return float64(w.Seats) / float64(w.Events)
+}
+
+// ReturningAttendee is an email registered to several events.
+type ReturningAttendee struct {
+	Name   string // of the latest registration
+	Email  string
+	Events int
+}
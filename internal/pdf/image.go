@@ -0,0 +1,85 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	// Decoders of the upload formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Image is an image embedded in a document. It can be drawn on any page.
+type Image struct {
+	Width, Height int
+
+	id         int
+	colorSpace string
+	filter     string
+	data       []byte
+}
+
+// AddImage reads a JPEG, PNG or GIF image and embeds it in the document.
+// JPEG files are embedded as is; other images are flattened on a white
+// background.
+func (d *Document) AddImage(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	img := &Image{id: len(d.images) + 1}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	img.Width, img.Height = cfg.Width, cfg.Height
+
+	switch {
+	case format == "jpeg" && cfg.ColorModel == color.YCbCrModel:
+		img.colorSpace, img.filter, img.data = "DeviceRGB", "DCTDecode", data
+	case format == "jpeg" && cfg.ColorModel == color.GrayModel:
+		img.colorSpace, img.filter, img.data = "DeviceGray", "DCTDecode", data
+	default:
+		decoded, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decode image: %w", err)
+		}
+		img.colorSpace, img.filter = "DeviceRGB", "FlateDecode"
+		if img.data, err = flatten(decoded); err != nil {
+			return nil, err
+		}
+	}
+
+	d.images = append(d.images, img)
+	return img, nil
+}
+
+// flatten returns the compressed RGB samples of an image, blended on white.
+func flatten(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, 0, b.Dx()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			// Colors are premultiplied: add the white showing through
+			white := 0xffff - a
+			row = append(row, byte((r+white)>>8), byte((g+white)>>8), byte((bl+white)>>8))
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,318 @@
+// Package pdf writes simple PDF documents: text in the standard Helvetica
+// fonts, lines, rectangles and images. It has no dependency outside the
+// standard library and golang.org/x/text.
+//
+// Coordinates are in points (1/72 inch) from the top-left corner of the page,
+// and text is positioned by its baseline.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Page sizes in points.
+const (
+	A4Width      = 595.28
+	A4Height     = 841.89
+	LetterWidth  = 612.0
+	LetterHeight = 792.0
+)
+
+// MM converts millimeters to points.
+func MM(v float64) float64 {
+	return v * 72 / 25.4
+}
+
+// Font is one of the standard fonts every PDF reader provides.
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = []string{"Helvetica", "Helvetica-Bold"}
+
+// Document is a PDF document being built in memory.
+type Document struct {
+	width, height float64
+	title         string
+	pages         []*Page
+	images        []*Image
+}
+
+// Page is a page of a document. Drawing operations are appended to its
+// content stream.
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+// New returns an empty document whose pages have the given size in points.
+func New(width, height float64) *Document {
+	return &Document{width: width, height: height}
+}
+
+// SetTitle sets the title shown by PDF readers.
+func (d *Document) SetTitle(title string) {
+	d.title = title
+}
+
+// AddPage appends a blank page to the document and returns it.
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Width returns the width of s in points, in the given font and size.
+func Width(f Font, size float64, s string) float64 {
+	widths := &helveticaWidths
+	if f == HelveticaBold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, c := range encode(s) {
+		if c >= 32 {
+			total += int(widths[c-32])
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Truncate shortens s with an ellipsis so that it fits in maxWidth points.
+func Truncate(f Font, size float64, s string, maxWidth float64) string {
+	if Width(f, size, s) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for n := len(runes) - 1; n > 0; n-- {
+		t := strings.TrimRight(string(runes[:n]), " ") + "…"
+		if Width(f, size, t) <= maxWidth {
+			return t
+		}
+	}
+	return ""
+}
+
+// Text draws s with its baseline starting at (x, y), in the current fill
+// color. Characters outside the Windows-1252 set are replaced by "?".
+func (p *Page) Text(f Font, size, x, y float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		int(f)+1, num(size), num(x), num(p.doc.height-y), escapeString(encode(s)))
+}
+
+// TextCenter draws s centered horizontally on x.
+func (p *Page) TextCenter(f Font, size, x, y float64, s string) {
+	p.Text(f, size, x-Width(f, size, s)/2, y, s)
+}
+
+// TextRight draws s ending at x.
+func (p *Page) TextRight(f Font, size, x, y float64, s string) {
+	p.Text(f, size, x-Width(f, size, s), y, s)
+}
+
+// SetFillColor sets the color of text and filled shapes.
+func (p *Page) SetFillColor(c color.Color) {
+	r, g, b := rgb(c)
+	fmt.Fprintf(&p.content, "%s %s %s rg\n", num(r), num(g), num(b))
+}
+
+// SetStrokeColor sets the color of lines and outlines.
+func (p *Page) SetStrokeColor(c color.Color) {
+	r, g, b := rgb(c)
+	fmt.Fprintf(&p.content, "%s %s %s RG\n", num(r), num(g), num(b))
+}
+
+// Line draws a line of the given width between two points.
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		num(width), num(x1), num(p.doc.height-y1), num(x2), num(p.doc.height-y2))
+}
+
+// Rect draws the outline of a rectangle whose top-left corner is (x, y).
+func (p *Page) Rect(x, y, w, h, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s %s %s re S\n",
+		num(width), num(x), num(p.doc.height-y-h), num(w), num(h))
+}
+
+// FillRect fills a rectangle whose top-left corner is (x, y) with the
+// current fill color.
+func (p *Page) FillRect(x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "%s %s %s %s re f\n",
+		num(x), num(p.doc.height-y-h), num(w), num(h))
+}
+
+// Image draws an image in the rectangle whose top-left corner is (x, y).
+func (p *Page) Image(img *Image, x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /Im%d Do Q\n",
+		num(w), num(h), num(x), num(p.doc.height-y-h), img.id)
+}
+
+// Write writes the document to w.
+func (d *Document) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	var offsets []int
+	// Objects are numbered in the order they are written, so the numbers of
+	// the fonts, images and pages are known in advance.
+	const catalogID, pagesID, infoID, resourcesID, firstFontID = 1, 2, 3, 4, 5
+	firstImageID := firstFontID + len(fontNames)
+	firstPageID := firstImageID + len(d.images)
+
+	begin := func(id int) {
+		offsets = append(offsets, buf.Len())
+		if len(offsets) != id {
+			panic("pdf: objects written out of order")
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n", id)
+	}
+	end := func() { buf.WriteString("endobj\n") }
+	stream := func(dict string, data []byte) {
+		fmt.Fprintf(&buf, "<< %s /Length %d >>\nstream\n", dict, len(data))
+		buf.Write(data)
+		buf.WriteString("\nendstream\n")
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	begin(catalogID)
+	fmt.Fprintf(&buf, "<< /Type /Catalog /Pages %d 0 R >>\n", pagesID)
+	end()
+
+	begin(pagesID)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageID+2*i)
+	}
+	fmt.Fprintf(&buf, "<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %s %s] >>\n",
+		strings.Join(kids, " "), len(d.pages), num(d.width), num(d.height))
+	end()
+
+	begin(infoID)
+	fmt.Fprintf(&buf, "<< /Title %s /Producer (LibreRegistration) >>\n", textString(d.title))
+	end()
+
+	begin(resourcesID)
+	buf.WriteString("<< /Font <<")
+	for i := range fontNames {
+		fmt.Fprintf(&buf, " /F%d %d 0 R", i+1, firstFontID+i)
+	}
+	buf.WriteString(" >> /XObject <<")
+	for _, img := range d.images {
+		fmt.Fprintf(&buf, " /Im%d %d 0 R", img.id, firstImageID+img.id-1)
+	}
+	buf.WriteString(" >> /ProcSet [/PDF /Text /ImageB /ImageC] >>\n")
+	end()
+
+	for i, name := range fontNames {
+		begin(firstFontID + i)
+		fmt.Fprintf(&buf, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>\n", name)
+		end()
+	}
+
+	for _, img := range d.images {
+		begin(firstImageID + img.id - 1)
+		stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s",
+			img.Width, img.Height, img.colorSpace, img.filter), img.data)
+		end()
+	}
+
+	for i, p := range d.pages {
+		id := firstPageID + 2*i
+		begin(id)
+		fmt.Fprintf(&buf, "<< /Type /Page /Parent %d 0 R /Resources %d 0 R /Contents %d 0 R >>\n",
+			pagesID, resourcesID, id+1)
+		end()
+
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(p.content.Bytes())
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		begin(id + 1)
+		stream("/Filter /FlateDecode", z.Bytes())
+		end()
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, catalogID, infoID, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encode converts s to Windows-1252, the encoding of the standard fonts.
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch r {
+		case '\n', '\r', '\t':
+			r = ' '
+		}
+		b, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok || b < 32 {
+			b = '?'
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// escapeString returns b as a PDF literal string, without the parentheses.
+func escapeString(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch c {
+		case '\\', '(', ')':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// textString returns s as a PDF text string, in UTF-16 so that any
+// character is kept.
+func textString(s string) string {
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, r := range s {
+		if r > 0xFFFF {
+			r -= 0x10000
+			fmt.Fprintf(&sb, "%04X%04X", 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+			continue
+		}
+		fmt.Fprintf(&sb, "%04X", r)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+func rgb(c color.Color) (r, g, b float64) {
+	cr, cg, cb, _ := c.RGBA()
+	return float64(cr) / 0xffff, float64(cg) / 0xffff, float64(cb) / 0xffff
+}
+
+// num formats a coordinate with at most two decimals.
+func num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,361 @@
+// Package recurrence computes the dates of recurring events from rules in a
+// subset of the iCalendar RRULE syntax (RFC 5545), such as
+// "FREQ=MONTHLY;BYDAY=1SA" for every first Saturday of the month.
+//
+// The supported parts are FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL,
+// BYDAY, BYMONTHDAY, BYMONTH, COUNT and UNTIL. BYDAY ordinals, as in 1SA or
+// -1FR, count within the month, so they need a MONTHLY or YEARLY frequency.
+// Occurrences keep the time of day of the first one.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the period a rule repeats at.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// WeekDay is a day of the week, optionally the Nth of the month: 1 for the
+// first, -1 for the last, 0 for all of them.
+type WeekDay struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq       Frequency
+	Interval   int // in periods of Freq, at least 1
+	ByDay      []WeekDay
+	ByMonthDay []int // negative days count from the end of the month
+	ByMonth    []time.Month
+	Count      int       // number of occurrences, unlimited when 0
+	Until      time.Time // last possible occurrence, unlimited when zero
+}
+
+// ErrInvalid is returned for rules that cannot be parsed.
+var ErrInvalid = errors.New("invalid recurrence rule")
+
+var dayNames = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// maxPeriods bounds the periods looked at, for rules matching no date such
+// as the 30th of February.
+const maxPeriods = 10000
+
+// Parse parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH". Parts are
+// case-insensitive, and an "RRULE:" prefix is allowed. A date-only UNTIL, or
+// one without a Z suffix, is in loc.
+func Parse(s string, loc *time.Location) (Rule, error) {
+	r := Rule{Interval: 1}
+	s = strings.TrimSpace(strings.ToUpper(s))
+	s = strings.TrimPrefix(s, "RRULE:")
+	if s == "" {
+		return r, fmt.Errorf("%w: empty", ErrInvalid)
+	}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || value == "" {
+			return r, fmt.Errorf("%w: %q", ErrInvalid, part)
+		}
+		if seen[name] {
+			return r, fmt.Errorf("%w: %s given twice", ErrInvalid, name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(value)
+			if !slices.Contains([]Frequency{Daily, Weekly, Monthly, Yearly}, r.Freq) {
+				err = fmt.Errorf("unsupported frequency %s", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = parseInt(value, 1, 1000)
+		case "COUNT":
+			r.Count, err = parseInt(value, 1, 10000)
+		case "UNTIL":
+			r.Until, err = parseUntil(value, loc)
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				var d WeekDay
+				if d, err = parseWeekDay(v); err != nil {
+					break
+				}
+				r.ByDay = append(r.ByDay, d)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				var n int
+				if n, err = parseInt(v, -31, 31); err != nil || n == 0 {
+					err = fmt.Errorf("invalid month day %s", v)
+					break
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				var n int
+				if n, err = parseInt(v, 1, 12); err != nil {
+					break
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(n))
+			}
+		case "WKST":
+			// Weeks start on Monday: only WKST=MO is accepted
+			if value != "MO" {
+				err = fmt.Errorf("unsupported week start %s", value)
+			}
+		default:
+			err = fmt.Errorf("unsupported part %s", name)
+		}
+		if err != nil {
+			return r, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+
+	if r.Freq == "" {
+		return r, fmt.Errorf("%w: FREQ is required", ErrInvalid)
+	}
+	slices.Sort(r.ByMonth)
+	if r.Count > 0 && !r.Until.IsZero() {
+		return r, fmt.Errorf("%w: COUNT and UNTIL cannot be combined", ErrInvalid)
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return r, fmt.Errorf("%w: numbered days need a monthly or yearly frequency", ErrInvalid)
+		}
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq == Weekly {
+		return r, fmt.Errorf("%w: BYMONTHDAY cannot be used with a weekly frequency", ErrInvalid)
+	}
+	return r, nil
+}
+
+func parseInt(s string, min, max int) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "+"))
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("invalid number %s", s)
+	}
+	return n, nil
+}
+
+func parseWeekDay(s string) (WeekDay, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return WeekDay{}, fmt.Errorf("invalid day %s", s)
+	}
+	day, ok := dayNames[s[len(s)-2:]]
+	if !ok {
+		return WeekDay{}, fmt.Errorf("invalid day %s", s)
+	}
+	d := WeekDay{Day: day}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := parseInt(prefix, -5, 5)
+		if err != nil || n == 0 {
+			return WeekDay{}, fmt.Errorf("invalid day %s", s)
+		}
+		d.N = n
+	}
+	return d, nil
+}
+
+func parseUntil(s string, loc *time.Location) (time.Time, error) {
+	switch {
+	case strings.HasSuffix(s, "Z"):
+		return time.Parse("20060102T150405Z", s)
+	case strings.Contains(s, "T"):
+		return time.ParseInLocation("20060102T150405", s, loc)
+	default:
+		// A date alone includes the whole day
+		t, err := time.ParseInLocation("20060102", s, loc)
+		return t.AddDate(0, 0, 1).Add(-time.Second), err
+	}
+}
+
+// String returns the rule in RRULE syntax, without the prefix.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = strings.ToUpper(d.Day.String()[:2])
+			if d.N != 0 {
+				days[i] = strconv.Itoa(d.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of the rule starting at start that fall
+// in [from, to), in order. The first occurrence is start itself, whether
+// it matches the rule or not, as in iCalendar.
+func (r Rule) Between(start, from, to time.Time) []time.Time {
+	var out []time.Time
+	n := 0
+	emit := func(t time.Time) bool {
+		if (!r.Until.IsZero() && t.After(r.Until)) || !t.Before(to) {
+			return false
+		}
+		n++
+		if r.Count > 0 && n > r.Count {
+			return false
+		}
+		if !t.Before(from) {
+			out = append(out, t)
+		}
+		return true
+	}
+
+	if !emit(start) {
+		return out
+	}
+	for k := 0; k < maxPeriods; k++ {
+		for _, t := range r.period(start, k*r.Interval) {
+			if !t.After(start) {
+				continue
+			}
+			if !emit(t) {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// period returns the candidate dates of the period that is k periods after
+// the one of start, in order.
+func (r Rule) period(start time.Time, k int) []time.Time {
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, start.Location())
+	}
+
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		t := at(y, m, d+k)
+		if r.matchesDay(t) {
+			days = append(days, t)
+		}
+	case Weekly:
+		// Weeks start on Monday
+		monday := d - (int(start.Weekday())+6)%7 + 7*k
+		for i := 0; i < 7; i++ {
+			t := at(y, m, monday+i)
+			if len(r.ByDay) == 0 && t.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchesDay(t) {
+				days = append(days, t)
+			}
+		}
+	case Monthly:
+		first := at(y, m+time.Month(k), 1)
+		if r.matchesMonth(first.Month()) {
+			days = r.monthDays(first, d)
+		}
+	case Yearly:
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{m}
+		}
+		for _, month := range months {
+			days = append(days, r.monthDays(at(y+k, month, 1), d)...)
+		}
+	}
+	return days
+}
+
+// monthDays returns the days of the month starting at first that match the
+// BYMONTHDAY and BYDAY parts, or the day of the month of the start date when
+// neither is given.
+func (r Rule) monthDays(first time.Time, startDay int) []time.Time {
+	length := first.AddDate(0, 1, -1).Day()
+	var days []time.Time
+	for d := 1; d <= length; d++ {
+		t := first.AddDate(0, 0, d-1)
+		switch {
+		case len(r.ByMonthDay) == 0 && len(r.ByDay) == 0:
+			if d != startDay {
+				continue
+			}
+		case len(r.ByMonthDay) > 0 && !slices.ContainsFunc(r.ByMonthDay, func(n int) bool {
+			return n == d || n == d-length-1
+		}):
+			continue
+		case len(r.ByDay) > 0 && !slices.ContainsFunc(r.ByDay, func(wd WeekDay) bool {
+			if wd.Day != t.Weekday() {
+				return false
+			}
+			nth := (d-1)/7 + 1             // counted from the start of the month
+			nthLast := -((length-d)/7 + 1) // counted from the end
+			return wd.N == 0 || wd.N == nth || wd.N == nthLast
+		}):
+			continue
+		}
+		days = append(days, t)
+	}
+	return days
+}
+
+func (r Rule) matchesDay(t time.Time) bool {
+	if !r.matchesMonth(t.Month()) {
+		return false
+	}
+	if len(r.ByDay) > 0 && !slices.ContainsFunc(r.ByDay, func(wd WeekDay) bool { return wd.Day == t.Weekday() }) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 {
+		length := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+		if !slices.ContainsFunc(r.ByMonthDay, func(n int) bool { return n == t.Day() || n == t.Day()-length-1 }) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Rule) matchesMonth(m time.Month) bool {
+	return len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, m)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+// Number of events shown by the charts of the dashboard.
+const (
+	analyticsCurves    = 5
+	analyticsFillRates = 10
+	analyticsReturning = 10
+)
+
+type AnalyticsService struct {
+	events        EventStore
+	registrations RegistrationStore
+}
+
+func NewAnalyticsService(events EventStore, registrations RegistrationStore) *AnalyticsService {
+	return &AnalyticsService{events: events, registrations: registrations}
+}
+
+// Dashboard computes the analytics of all the events as of now. Rejected
+// registrations are left out, drafts are left out of the fill rates and
+// weekdays.
+func (s *AnalyticsService) Dashboard(now time.Time) (*models.Analytics, error) {
+	events, err := s.events.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	regs, err := s.registrations.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	cancellations, err := s.registrations.ListCancellations()
+	if err != nil {
+		return nil, err
+	}
+
+	byEvent := make(map[string][]models.Registration)
+	for _, r := range regs {
+		if r.Status != models.StatusRejected {
+			byEvent[r.EventID] = append(byEvent[r.EventID], r)
+		}
+	}
+
+	a := &models.Analytics{Cancellations: len(cancellations)}
+	for _, e := range events {
+		if len(a.Curves) < analyticsCurves && e.RegistrationsOpenedAt != nil && len(byEvent[e.ID]) > 0 {
+			a.Curves = append(a.Curves, registrationCurve(e, byEvent[e.ID]))
+		}
+		if e.Status == models.EventDraft {
+			continue
+		}
+		if len(a.FillRates) < analyticsFillRates && e.MaxCapacity != nil && *e.MaxCapacity > 0 {
+			a.FillRates = append(a.FillRates, models.FillRate{Event: e, Seats: e.RegistrationCount, Capacity: *e.MaxCapacity})
+		}
+	}
+	a.Weekdays = weekdayStats(events, now)
+	countAttendees(a, regs)
+	for _, r := range byEvent {
+		a.Registrations += len(r)
+	}
+	return a, nil
+}
+
+// registrationCurve accumulates the seats of the registrations to an event,
+// ordered by date, from the opening of its registrations. Registrations
+// added before the opening count from day 0.
+func registrationCurve(e models.Event, regs []models.Registration) models.RegistrationCurve {
+	curve := models.RegistrationCurve{Event: e, Points: []models.CurvePoint{{}}}
+	seats := 0
+	for _, r := range regs {
+		seats += r.Seats
+		day := max(r.RegisteredAt.Sub(*e.RegistrationsOpenedAt).Hours()/24, 0)
+		curve.Points = append(curve.Points, models.CurvePoint{Day: day, Seats: seats})
+	}
+	return curve
+}
+
+// weekdayStats counts the past published or archived events by day of the
+// week, Monday first.
+func weekdayStats(events []models.Event, now time.Time) []models.WeekdayStat {
+	stats := make([]models.WeekdayStat, 7)
+	for i := range stats {
+		stats[i].Weekday = time.Weekday((i + 1) % 7)
+	}
+	for _, e := range events {
+		if e.Status == models.EventDraft || !e.EventDate.Before(now) {
+			continue
+		}
+		stat := &stats[(int(e.EventDate.Weekday())+6)%7]
+		stat.Events++
+		stat.Seats += e.RegistrationCount
+	}
+	return stats
+}
+
+// countAttendees counts the distinct emails of the registrations and finds those
+// registered to several events.
+func countAttendees(a *models.Analytics, regs []models.Registration) {
+	type attendee struct {
+		name   string
+		email  string
+		events map[string]bool
+	}
+	byEmail := make(map[string]*attendee)
+	for _, r := range regs {
+		email := strings.ToLower(strings.TrimSpace(r.Email))
+		if email == "" || r.Status == models.StatusRejected {
+			continue
+		}
+		at, ok := byEmail[email]
+		if !ok {
+			at = &attendee{email: email, events: make(map[string]bool)}
+			byEmail[email] = at
+		}
+		at.name = r.Name
+		at.events[r.EventID] = true
+	}
+
+	a.Attendees = len(byEmail)
+	var returning []models.ReturningAttendee
+	for _, at := range byEmail {
+		if len(at.events) > 1 {
+			returning = append(returning, models.ReturningAttendee{Name: at.name, Email: at.email, Events: len(at.events)})
+		}
+	}
+	sort.Slice(returning, func(i, j int) bool {
+		if returning[i].Events != returning[j].Events {
+			return returning[i].Events > returning[j].Events
+		}
+		return returning[i].Email < returning[j].Email
+	})
+	a.ReturningCount = len(returning)
+	if len(returning) > analyticsReturning {
+		returning = returning[:analyticsReturning]
+	}
+	a.Returning = returning
+}
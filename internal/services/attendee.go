@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toulibre/libreregistration/internal/mail"
+	"github.com/toulibre/libreregistration/internal/metrics"
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+// AttendeeInput holds the details organizers can set on a registration.
+type AttendeeInput struct {
+	Name       string
+	Email      string
+	Comment    string
+	Companions []string
+}
+
+// AttendeeOptions controls how organizers' changes are applied.
+type AttendeeOptions struct {
+	BypassCapacity bool // allow going beyond the event's maximum capacity
+	Notify         bool // email the attendee about the change
+}
+
+// normalize trims the input, drops empty companions and validates it.
+func (in *AttendeeInput) normalize() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Email = strings.TrimSpace(in.Email)
+	in.Comment = strings.TrimSpace(in.Comment)
+	var companions []string
+	for _, c := range in.Companions {
+		if c = strings.TrimSpace(c); c != "" {
+			companions = append(companions, c)
+		}
+	}
+	in.Companions = companions
+
+	if in.Name == "" {
+		return ErrNameRequired
+	}
+	if in.Email != "" {
+		if addr, err := netmail.ParseAddress(in.Email); err != nil || addr.Address != in.Email {
+			return ErrInvalidEmail
+		}
+	}
+	return nil
+}
+
+// apply copies the input onto the registration.
+func (in *AttendeeInput) apply(reg *models.Registration) {
+	reg.Name = in.Name
+	reg.Email = in.Email
+	reg.Comment = in.Comment
+	reg.Companions = nil
+	for i, c := range in.Companions {
+		reg.Companions = append(reg.Companions, models.Companion{
+			ID:             uuid.New().String(),
+			RegistrationID: reg.ID,
+			Name:           c,
+			Position:       i,
+		})
+	}
+	reg.Seats = 1 + len(in.Companions)
+}
+
+// AddAttendee registers someone on behalf of the organizers, for instance
+// after a phone call. The registration is confirmed right away, whether or
+// not registrations are open.
+func (s *RegistrationService) AddAttendee(ctx context.Context, eventID string, in AttendeeInput, opts AttendeeOptions) (*models.Registration, error) {
+	if err := in.normalize(); err != nil {
+		return nil, err
+	}
+	event, err := s.events.GetByID(eventID)
+	if err != nil {
+		return nil, fmt.Errorf("get event: %w", err)
+	}
+	if event == nil {
+		return nil, ErrEventNotFound
+	}
+
+	reg := &models.Registration{
+		ID:           uuid.New().String(),
+		EventID:      eventID,
+		CancelToken:  uuid.New().String(),
+		Status:       models.StatusConfirmed,
+		RegisteredAt: time.Now(),
+	}
+	in.apply(reg)
+
+	if !opts.BypassCapacity {
+		if err := s.checkSeats(event, reg.Seats); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.registrations.Create(reg); err != nil {
+		return nil, fmt.Errorf("create registration: %w", err)
+	}
+	metrics.Registrations.Inc("admin", string(reg.Status))
+	slog.InfoContext(ctx, "attendee added", "event", event.Slug, "registration", reg.ID, "status", reg.Status, "email", reg.Email)
+
+	if opts.Notify {
+		s.sendStatusMail(ctx, event, reg)
+	}
+	return reg, nil
+}
+
+// UpdateAttendee changes the details of a registration of the event.
+func (s *RegistrationService) UpdateAttendee(ctx context.Context, eventID, regID string, in AttendeeInput, opts AttendeeOptions) (*models.Registration, error) {
+	if err := in.normalize(); err != nil {
+		return nil, err
+	}
+	event, reg, err := s.getEventRegistration(eventID, regID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldSeats := reg.Seats
+	in.apply(reg)
+	if reg.Status == models.StatusConfirmed && reg.Seats > oldSeats && !opts.BypassCapacity {
+		if err := s.checkSeats(event, reg.Seats-oldSeats); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.registrations.Update(reg); err != nil {
+		return nil, err
+	}
+
+	if opts.Notify && reg.Email != "" && s.cfg.SMTPHost != "" {
+		cancelURL := fmt.Sprintf("%s/cancel/%s", s.cfg.BaseURL, reg.CancelToken)
+		s.sendMail(func() { mail.SendUpdate(s.cfg, ctx, reg.Email, event.Title, cancelURL) })
+	}
+	return reg, nil
+}
+
+// MoveAttendee moves a registration of the event, companions included, to
+// another event, such as the next session of a workshop. The target event
+// checks it as a new registration: its duplicate policy applies, and the
+// registration is pending if it requires approval, confirmed otherwise.
+// Rejected registrations stay rejected. The cancellation link is kept.
+func (s *RegistrationService) MoveAttendee(ctx context.Context, eventID, regID, targetEventID string, opts AttendeeOptions) (*models.Registration, error) {
+	event, reg, err := s.getEventRegistration(eventID, regID)
+	if err != nil {
+		return nil, err
+	}
+	if targetEventID == eventID {
+		return reg, nil
+	}
+	target, err := s.events.GetByID(targetEventID)
+	if err != nil {
+		return nil, fmt.Errorf("get event: %w", err)
+	}
+	if target == nil {
+		return nil, ErrEventNotFound
+	}
+
+	if reg.Status != models.StatusRejected {
+		reg.Status = models.StatusConfirmed
+		if target.ApprovalRequired {
+			reg.Status = models.StatusPending
+		}
+	}
+	if reg.Status == models.StatusConfirmed && !opts.BypassCapacity {
+		if err := s.checkSeats(target, reg.Seats); err != nil {
+			return nil, err
+		}
+	}
+	// A duplicate of the source event may not be one in the target
+	reg.Duplicate = false
+	if target.DuplicatePolicy == models.DuplicateWarn || target.DuplicatePolicy == models.DuplicateReject {
+		existing, err := s.findByIdentity(target.ID, reg.Email, reg.Name)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if target.DuplicatePolicy == models.DuplicateReject {
+				return nil, ErrDuplicateRegistration
+			}
+			reg.Duplicate = true
+		}
+	}
+	reg.EventID = target.ID
+	if err := s.registrations.Update(reg); err != nil {
+		return nil, err
+	}
+
+	if opts.Notify && reg.Email != "" && s.cfg.SMTPHost != "" {
+		cancelURL := fmt.Sprintf("%s/cancel/%s", s.cfg.BaseURL, reg.CancelToken)
+		s.sendMail(func() { mail.SendMove(s.cfg, ctx, reg.Email, event.Title, target.Title, target.EventDate, cancelURL) })
+	}
+	return reg, nil
+}
+
+// GetAttendee returns a registration of the event, or ErrRegistrationNotFound.
+func (s *RegistrationService) GetAttendee(eventID, regID string) (*models.Registration, error) {
+	_, reg, err := s.getEventRegistration(eventID, regID)
+	return reg, err
+}
+
+func (s *RegistrationService) getEventRegistration(eventID, regID string) (*models.Event, *models.Registration, error) {
+	event, err := s.events.GetByID(eventID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get event: %w", err)
+	}
+	if event == nil {
+		return nil, nil, ErrEventNotFound
+	}
+	reg, err := s.registrations.GetByID(regID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get registration: %w", err)
+	}
+	if reg == nil || reg.EventID != eventID {
+		return nil, nil, ErrRegistrationNotFound
+	}
+	return event, reg, nil
+}
+
+// checkSeats returns ErrRegistrationFull if the event has not got that many
+// seats left.
+func (s *RegistrationService) checkSeats(event *models.Event, seats int) error {
+	if event.MaxCapacity == nil {
+		return nil
+	}
+	count, err := s.registrations.CountByEvent(event.ID)
+	if err != nil {
+		return fmt.Errorf("count registrations: %w", err)
+	}
+	if count+seats > *event.MaxCapacity {
+		return ErrRegistrationFull
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/config"
+	"github.com/toulibre/libreregistration/internal/database/memory"
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/internal/worker"
+)
+
+// fixture is a registration service on memory stores. No mail is sent: SMTP
+// is not configured.
+type fixture struct {
+	registrations *services.RegistrationService
+	events        *memory.EventStore
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	db := memory.New()
+	events := memory.NewEventStore(db)
+	return &fixture{
+		registrations: services.NewRegistrationService(memory.NewRegistrationStore(db), events, memory.NewSessionStore(db), &config.Config{}, worker.NewSupervisor()),
+		events:        events,
+	}
+}
+
+// event creates a published event open to registrations, changed by edit.
+func (f *fixture) event(t *testing.T, slug string, edit func(e *models.Event)) *models.Event {
+	t.Helper()
+	e := &models.Event{
+		ID:               "event-" + slug,
+		Title:            "Event " + slug,
+		Slug:             slug,
+		EventDate:        time.Now().Add(7 * 24 * time.Hour),
+		RegistrationOpen: true,
+		DuplicatePolicy:  models.DuplicateAllow,
+		Status:           models.EventPublished,
+	}
+	if edit != nil {
+		edit(e)
+	}
+	if err := f.events.Create(e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// register registers someone, failing the test on errors.
+func (f *fixture) register(t *testing.T, event *models.Event, name, email string, companions ...string) *models.Registration {
+	t.Helper()
+	reg, err := f.registrations.Register(context.Background(), event.ID, name, email, "", companions, nil)
+	if err != nil {
+		t.Fatalf("register %s: %v", name, err)
+	}
+	return reg
+}
+
+func TestMoveAttendeeStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to bool // whether the events require approval
+		review   models.RegistrationStatus
+		want     models.RegistrationStatus
+	}{
+		{"pending to an open event", true, false, "", models.StatusConfirmed},
+		{"confirmed to an event requiring approval", false, true, "", models.StatusPending},
+		{"approved to an event requiring approval", true, true, models.StatusConfirmed, models.StatusPending},
+		{"rejected", true, false, models.StatusRejected, models.StatusRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			from := f.event(t, "from", func(e *models.Event) { e.ApprovalRequired = tt.from })
+			to := f.event(t, "to", func(e *models.Event) { e.ApprovalRequired = tt.to })
+			reg := f.register(t, from, "Ada", "ada@example.org")
+			if tt.review != "" {
+				if _, err := f.registrations.Review(ctx, from.ID, []string{reg.ID}, tt.review); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := f.registrations.MoveAttendee(ctx, from.ID, reg.ID, to.ID, services.AttendeeOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := f.registrations.GetAttendee(to.ID, reg.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.want {
+				t.Errorf("status = %s, want %s", got.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveAttendeeDuplicates(t *testing.T) {
+	tests := []struct {
+		policy        models.DuplicatePolicy
+		wantErr       error
+		wantDuplicate bool
+	}{
+		{models.DuplicateAllow, nil, false},
+		{models.DuplicateWarn, nil, true},
+		{models.DuplicateReject, services.ErrDuplicateRegistration, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			from := f.event(t, "from", nil)
+			to := f.event(t, "to", func(e *models.Event) { e.DuplicatePolicy = tt.policy })
+			reg := f.register(t, from, "Ada", "ada@example.org")
+			f.register(t, to, "Ada Lovelace", "ADA@example.org")
+
+			moved, err := f.registrations.MoveAttendee(ctx, from.ID, reg.ID, to.ID, services.AttendeeOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MoveAttendee error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// The registration is left where it was
+				if _, err := f.registrations.GetAttendee(from.ID, reg.ID); err != nil {
+					t.Errorf("registration not in its event anymore: %v", err)
+				}
+				return
+			}
+			if moved.Duplicate != tt.wantDuplicate {
+				t.Errorf("Duplicate = %v, want %v", moved.Duplicate, tt.wantDuplicate)
+			}
+		})
+	}
+}
+
+func TestMoveAttendeeCapacity(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	capacity := 2
+	from := f.event(t, "from", func(e *models.Event) { e.MaxCompanions = 1 })
+	to := f.event(t, "to", func(e *models.Event) { e.MaxCapacity = &capacity })
+	reg := f.register(t, from, "Ada", "ada@example.org", "Charles")
+	f.register(t, to, "Grace", "grace@example.org")
+
+	if _, err := f.registrations.MoveAttendee(ctx, from.ID, reg.ID, to.ID, services.AttendeeOptions{}); !errors.Is(err, services.ErrRegistrationFull) {
+		t.Fatalf("MoveAttendee error = %v, want %v", err, services.ErrRegistrationFull)
+	}
+	if _, err := f.registrations.MoveAttendee(ctx, from.ID, reg.ID, to.ID, services.AttendeeOptions{BypassCapacity: true}); err != nil {
+		t.Fatalf("MoveAttendee beyond capacity: %v", err)
+	}
+}
+
+func TestMoveAttendeeDuplicateFlag(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	from := f.event(t, "from", func(e *models.Event) { e.DuplicatePolicy = models.DuplicateWarn })
+	to := f.event(t, "to", func(e *models.Event) { e.DuplicatePolicy = models.DuplicateWarn })
+	f.register(t, from, "Ada", "ada@example.org")
+	reg := f.register(t, from, "Ada", "ada@example.org")
+	if !reg.Duplicate {
+		t.Fatal("second registration not flagged as a duplicate")
+	}
+
+	// Nobody in the target event is the same person
+	moved, err := f.registrations.MoveAttendee(ctx, from.ID, reg.ID, to.ID, services.AttendeeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Duplicate {
+		t.Error("duplicate flag of the source event carried over")
+	}
+}
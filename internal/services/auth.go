@@ -2,21 +2,20 @@ package services
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
-	"github.com/toulibre/libreregistration/internal/database"
 	"github.com/toulibre/libreregistration/internal/models"
 )
 
 type AuthService struct {
-	users *database.UserStore
+	users UserStore
 }
 
-func NewAuthService(users *database.UserStore) *AuthService {
+func NewAuthService(users UserStore) *AuthService {
 	return &AuthService{users: users}
 }
 
@@ -64,7 +63,7 @@ func (s *AuthService) SeedAdmin(username, password string) error {
 		return fmt.Errorf("create admin: %w", err)
 	}
 
-	log.Printf("Admin user '%s' created", username)
+	slog.Info("admin user created", "username", username)
 	return nil
 }
 
@@ -121,4 +120,34 @@ func (s *AuthService) ChangePassword(userID, currentPassword, newPassword string
 	return s.users.UpdatePassword(userID, string(hash))
 }
 
+// ResetPassword sets the password of a user without checking the current
+// one, for an administrator who lost it.
+func (s *AuthService) ResetPassword(username, password string) error {
+	user, err := s.users.GetByUsername(username)
+	if err != nil {
+		return fmt.Errorf("reset password: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("reset password: %w", ErrUserNotFound)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+
+	return s.users.UpdatePassword(user.ID, string(hash))
+}
+
+func (s *AuthService) SetRole(username string, role models.Role) error {
+	user, err := s.users.GetByUsername(username)
+	if err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("set role: %w", ErrUserNotFound)
+	}
+	return s.users.UpdateRole(user.ID, role)
+}
+
 var ErrInvalidCurrentPassword = fmt.Errorf("invalid current password")
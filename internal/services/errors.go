@@ -3,8 +3,33 @@ package services
 import "errors"
 
 var (
-	ErrEventNotFound             = errors.New("event not found")
-	ErrRegistrationNotOpen       = errors.New("registration not open")
+	ErrEventNotFound              = errors.New("event not found")
+	ErrRegistrationNotOpen        = errors.New("registration not open")
 	ErrRegistrationDeadlinePassed = errors.New("registration deadline passed")
-	ErrRegistrationFull          = errors.New("registration full")
+	ErrRegistrationFull           = errors.New("registration full")
+	ErrDuplicateRegistration      = errors.New("duplicate registration")
+	ErrTooManyCompanions          = errors.New("too many companions")
+	ErrRegistrationNotFound       = errors.New("registration not found")
+	ErrImportInvalidCSV           = errors.New("invalid csv file")
+	ErrImportEmpty                = errors.New("empty import")
+	ErrImportTooManyRows          = errors.New("too many rows to import")
+	ErrImportNoNameColumn         = errors.New("no column mapped to the name")
+	ErrNameRequired               = errors.New("name required")
+	ErrInvalidEmail               = errors.New("invalid email")
+	ErrImportInvalidDate          = errors.New("invalid registration date")
+	ErrImportInvalidStatus        = errors.New("invalid status")
+	ErrTagNotFound                = errors.New("tag not found")
+	ErrTagExists                  = errors.New("tag already exists")
+	ErrSeriesNotFound             = errors.New("series not found")
+	ErrInvalidRule                = errors.New("invalid recurrence rule")
+	ErrInvalidExceptionDate       = errors.New("invalid exception date")
+	ErrInvalidHorizon             = errors.New("invalid generation horizon")
+	ErrSessionNotFound            = errors.New("session not found")
+	ErrSessionFull                = errors.New("session full")
+	ErrSessionTitleRequired       = errors.New("session title required")
+	ErrInvalidSessionTime         = errors.New("session ends before it starts")
+	ErrInvalidSchedule            = errors.New("invalid schedule file")
+	ErrVenueNotFound              = errors.New("venue not found")
+	ErrVenueNameRequired          = errors.New("venue name required")
+	ErrUserNotFound               = errors.New("user not found")
 )
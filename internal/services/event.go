@@ -2,31 +2,45 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/yuin/goldmark"
 
-	"github.com/toulibre/libreregistration/internal/database"
 	"github.com/toulibre/libreregistration/internal/models"
 	"github.com/toulibre/libreregistration/internal/slug"
 )
 
 type EventService struct {
-	events *database.EventStore
-	md     goldmark.Markdown
+	events   EventStore
+	tags     TagStore
+	sessions SessionStore
+	venues   VenueStore
+	md       goldmark.Markdown
 }
 
-func NewEventService(events *database.EventStore) *EventService {
+func NewEventService(events EventStore, tags TagStore, sessions SessionStore, venues VenueStore) *EventService {
 	return &EventService{
-		events: events,
-		md:     goldmark.New(),
+		events:   events,
+		tags:     tags,
+		sessions: sessions,
+		venues:   venues,
+		md:       goldmark.New(),
 	}
 }
 
 func (s *EventService) Create(e *models.Event) error {
 	e.ID = uuid.New().String()
+	if e.DuplicatePolicy == "" {
+		e.DuplicatePolicy = models.DuplicateAllow
+	}
+	if e.Status == "" {
+		e.Status = models.EventPublished
+	}
+	e.PreviewToken = uuid.New().String()
 	if e.Slug == "" {
 		e.Slug = slug.Generate(e.Title)
 	}
@@ -51,13 +65,30 @@ func (s *EventService) Create(e *models.Event) error {
 	now := time.Now()
 	e.CreatedAt = now
 	e.UpdatedAt = now
+	if e.RegistrationOpen {
+		e.RegistrationsOpenedAt = &now
+	}
 
-	return s.events.Create(e)
+	if err := s.events.Create(e); err != nil {
+		return err
+	}
+	e.Tags = normalizeTags(e.Tags)
+	return s.tags.SetEventTags(e.ID, e.Tags)
 }
 
 func (s *EventService) Update(e *models.Event) error {
+	if e.PreviewToken == "" {
+		e.PreviewToken = uuid.New().String()
+	}
 	e.UpdatedAt = time.Now()
-	return s.events.Update(e)
+	if e.RegistrationOpen && e.RegistrationsOpenedAt == nil {
+		e.RegistrationsOpenedAt = &e.UpdatedAt
+	}
+	if err := s.events.Update(e); err != nil {
+		return err
+	}
+	e.Tags = normalizeTags(e.Tags)
+	return s.tags.SetEventTags(e.ID, e.Tags)
 }
 
 func (s *EventService) GetByID(id string) (*models.Event, error) {
@@ -66,7 +97,9 @@ func (s *EventService) GetByID(id string) (*models.Event, error) {
 		return nil, err
 	}
 	if e != nil {
-		e.DescriptionHTML = s.renderMarkdown(e.Description)
+		if err := s.complete(e); err != nil {
+			return nil, err
+		}
 	}
 	return e, nil
 }
@@ -77,17 +110,116 @@ func (s *EventService) GetBySlug(slug string) (*models.Event, error) {
 		return nil, err
 	}
 	if e != nil {
-		e.DescriptionHTML = s.renderMarkdown(e.Description)
+		if err := s.complete(e); err != nil {
+			return nil, err
+		}
 	}
 	return e, nil
 }
 
+// complete renders the description of a single event and loads its tags,
+// agenda and venue.
+func (s *EventService) complete(e *models.Event) error {
+	e.DescriptionHTML = s.renderMarkdown(e.Description)
+	if err := s.attachTags([]*models.Event{e}); err != nil {
+		return err
+	}
+	sessions, err := s.sessions.ListByEvent(e.ID)
+	if err != nil {
+		return err
+	}
+	e.Sessions = sessions
+	if e.VenueID != nil {
+		venue, err := s.venues.GetByID(*e.VenueID)
+		if err != nil {
+			return err
+		}
+		e.Venue = venue
+	}
+	return nil
+}
+
 func (s *EventService) ListUpcoming() ([]models.Event, error) {
-	return s.events.ListUpcoming()
+	return s.withTags(s.events.ListUpcoming())
+}
+
+// ListUpcomingByTag returns the published events to come with the tag.
+func (s *EventService) ListUpcomingByTag(tagID string) ([]models.Event, error) {
+	return s.withTags(s.events.ListUpcomingByTag(tagID))
 }
 
 func (s *EventService) ListAll() ([]models.Event, error) {
-	return s.events.ListAll()
+	return s.withTags(s.events.ListAll())
+}
+
+// Search returns a page of the events matching the query, and the number of
+// matches. Drafts are left out of public searches.
+func (s *EventService) Search(query string, public bool, page models.Page) ([]models.Event, int, error) {
+	var statuses []models.EventStatus
+	if public {
+		statuses = []models.EventStatus{models.EventPublished, models.EventArchived}
+	}
+	return s.ListPage(models.EventFilter{Query: query, Statuses: statuses}, page)
+}
+
+// ListPage returns a page of the events selected by the filter, and the
+// number of selected events.
+func (s *EventService) ListPage(f models.EventFilter, page models.Page) ([]models.Event, int, error) {
+	events, total, err := s.events.ListPage(f, page)
+	events, err = s.withTags(events, err)
+	return events, total, err
+}
+
+// ListUpcomingByVenue returns the published events to come at a venue.
+func (s *EventService) ListUpcomingByVenue(venueID string) ([]models.Event, error) {
+	return s.withTags(s.events.ListUpcomingByVenue(venueID))
+}
+
+// ListBySeries returns the occurrences of a series, oldest first.
+func (s *EventService) ListBySeries(seriesID string) ([]models.Event, error) {
+	return s.withTags(s.events.ListBySeries(seriesID))
+}
+
+// ListUpcomingBySeries returns the published occurrences to come of a series.
+func (s *EventService) ListUpcomingBySeries(seriesID string) ([]models.Event, error) {
+	return s.withTags(s.events.ListUpcomingBySeries(seriesID))
+}
+
+// ListBetween returns the events taking place in [from, to), oldest first.
+func (s *EventService) ListBetween(from, to time.Time) ([]models.Event, error) {
+	return s.withTags(s.events.ListBetween(from, to))
+}
+
+// ListEndedBefore returns the events ended before the time, oldest first.
+func (s *EventService) ListEndedBefore(t time.Time) ([]models.Event, error) {
+	return s.events.ListEndedBefore(t)
+}
+
+// withTags attaches their tags to listed events.
+func (s *EventService) withTags(events []models.Event, err error) ([]models.Event, error) {
+	if err != nil {
+		return nil, err
+	}
+	ptrs := make([]*models.Event, len(events))
+	for i := range events {
+		ptrs[i] = &events[i]
+	}
+	return events, s.attachTags(ptrs)
+}
+
+func (s *EventService) attachTags(events []*models.Event) error {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	tags, err := s.tags.ListByEvents(ids)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		e.Tags = tags[e.ID]
+	}
+	return nil
 }
 
 func (s *EventService) Delete(id string) error {
@@ -95,7 +227,7 @@ func (s *EventService) Delete(id string) error {
 }
 
 func (s *EventService) Clone(id, userID, suffix string) (*models.Event, error) {
-	original, err := s.events.GetByID(id)
+	original, err := s.GetByID(id)
 	if err != nil {
 		return nil, fmt.Errorf("get event for clone: %w", err)
 	}
@@ -108,14 +240,21 @@ func (s *EventService) Clone(id, userID, suffix string) (*models.Event, error) {
 		Description:          original.Description,
 		Location:             original.Location,
 		EventDate:            original.EventDate,
+		EndDate:              original.EndDate,
 		RegistrationDeadline: original.RegistrationDeadline,
 		MaxCapacity:          original.MaxCapacity,
 		AttendeeListPublic:   original.AttendeeListPublic,
 		RegistrationOpen:     false, // clones start closed
+		Status:               models.EventDraft,
 		ImagePath:            original.ImagePath,
 		BannerPath:           original.BannerPath,
 		Latitude:             original.Latitude,
 		Longitude:            original.Longitude,
+		VenueID:              original.VenueID,
+		DuplicatePolicy:      original.DuplicatePolicy,
+		ApprovalRequired:     original.ApprovalRequired,
+		MaxCompanions:        original.MaxCompanions,
+		Tags:                 original.Tags,
 		CreatedBy:            userID,
 	}
 
@@ -126,6 +265,45 @@ func (s *EventService) Clone(id, userID, suffix string) (*models.Event, error) {
 	return clone, nil
 }
 
+// ApplySchedule publishes the drafts and opens the registrations whose
+// scheduled time has come.
+func (s *EventService) ApplySchedule(now time.Time) error {
+	published, err := s.events.PublishDue(now)
+	if err != nil {
+		return err
+	}
+	opened, err := s.events.OpenRegistrationsDue(now)
+	if err != nil {
+		return err
+	}
+	if published > 0 || opened > 0 {
+		slog.Info("event schedule applied", "published", published, "opened", opened)
+	}
+	return nil
+}
+
+// RunScheduler applies the schedule at start and then at every interval,
+// until the context is canceled.
+func (s *EventService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.ApplySchedule(time.Now()); err != nil {
+			slog.Warn("could not apply the event schedule", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// UploadInUse reports whether an event still uses the uploaded file.
+func (s *EventService) UploadInUse(filename string) (bool, error) {
+	return s.events.UploadInUse(filename)
+}
+
 func (s *EventService) Count() (int, error) {
 	return s.events.Count()
 }
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/spreadsheet"
+)
+
+// AttendeeWorkbook builds a summary sheet with the counts of each event and
+// a sheet listing the attendees, with the same columns as the CSV export.
+// The event of each attendee is given when withEvent is set.
+func AttendeeWorkbook(ctx context.Context, events []models.Event, regsByEvent map[string][]models.Registration, withEvent bool) *spreadsheet.Workbook {
+	wb := &spreadsheet.Workbook{}
+
+	summary := wb.AddSheet(i18n.T(ctx, "export.sheet.summary"),
+		i18n.T(ctx, "export.col.event"),
+		i18n.T(ctx, "export.col.event_date"),
+		i18n.T(ctx, "export.col.location"),
+		i18n.T(ctx, "export.col.capacity"),
+		i18n.T(ctx, "export.col.registrations"),
+		i18n.T(ctx, "export.col.seats"),
+		i18n.T(ctx, "export.col.pending"),
+		i18n.T(ctx, "export.col.rejected"),
+		i18n.T(ctx, "export.col.companions"),
+	)
+
+	header := []string{
+		i18n.T(ctx, "csv.name"),
+		i18n.T(ctx, "csv.email"),
+		i18n.T(ctx, "csv.comment"),
+		i18n.T(ctx, "csv.registered_at"),
+		i18n.T(ctx, "csv.status"),
+		i18n.T(ctx, "csv.companions"),
+		i18n.T(ctx, "export.col.seats"),
+	}
+	if withEvent {
+		header = append([]string{i18n.T(ctx, "export.col.event"), i18n.T(ctx, "export.col.event_date")}, header...)
+	}
+	attendees := wb.AddSheet(i18n.T(ctx, "export.sheet.attendees"), header...)
+
+	for _, e := range events {
+		var capacity any
+		if e.MaxCapacity != nil {
+			capacity = *e.MaxCapacity
+		}
+		registrations, pending, rejected, companions := 0, 0, 0, 0
+		for _, reg := range regsByEvent[e.ID] {
+			switch reg.Status {
+			case models.StatusPending:
+				pending++
+			case models.StatusRejected:
+				rejected++
+			default:
+				registrations++
+				companions += len(reg.Companions)
+			}
+
+			names := make([]string, len(reg.Companions))
+			for i, c := range reg.Companions {
+				names[i] = c.Name
+			}
+			row := []any{
+				reg.Name, reg.Email, reg.Comment, reg.RegisteredAt,
+				i18n.T(ctx, "status."+string(reg.Status)), strings.Join(names, "; "), reg.Seats,
+			}
+			if withEvent {
+				row = append([]any{e.Title, e.EventDate}, row...)
+			}
+			attendees.AddRow(row...)
+		}
+		summary.AddRow(e.Title, e.EventDate, e.Place(), capacity, registrations, e.RegistrationCount, pending, rejected, companions)
+	}
+	return wb
+}
+
+// WriteAttendeesCSV writes the registrations to an event as CSV.
+func WriteAttendeesCSV(ctx context.Context, w io.Writer, regs []models.Registration) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		i18n.T(ctx, "csv.name"),
+		i18n.T(ctx, "csv.email"),
+		i18n.T(ctx, "csv.comment"),
+		i18n.T(ctx, "csv.registered_at"),
+		i18n.T(ctx, "csv.status"),
+		i18n.T(ctx, "csv.companions"),
+	})
+	for _, reg := range regs {
+		companions := make([]string, len(reg.Companions))
+		for i, c := range reg.Companions {
+			companions[i] = c.Name
+		}
+		writer.Write([]string{
+			reg.Name, reg.Email, reg.Comment, i18n.FormatDateTimeCSV(ctx, reg.RegisteredAt),
+			i18n.T(ctx, "status."+string(reg.Status)), strings.Join(companions, "; "),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
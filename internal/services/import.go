@@ -0,0 +1,440 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	netmail "net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/metrics"
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+// MaxImportRows bounds the number of rows of an attendee import.
+const MaxImportRows = 5000
+
+// ImportField is the registration field a CSV column is mapped to.
+type ImportField string
+
+const (
+	ImportIgnore       ImportField = ""
+	ImportName         ImportField = "name"
+	ImportEmail        ImportField = "email"
+	ImportComment      ImportField = "comment"
+	ImportRegisteredAt ImportField = "registered_at"
+	ImportStatus       ImportField = "status"
+	ImportCompanions   ImportField = "companions"
+)
+
+// ImportFields lists the fields a column can be mapped to, in the order of
+// the attendee export.
+var ImportFields = []ImportField{ImportName, ImportEmail, ImportComment, ImportRegisteredAt, ImportStatus, ImportCompanions}
+
+// ImportDateFormat is the order of the day and the month in the dates of an
+// import, such as 03/04/2030. Dates in ISO 8601 are read whatever the format.
+type ImportDateFormat string
+
+const (
+	ImportDayFirst   ImportDateFormat = "dmy"
+	ImportMonthFirst ImportDateFormat = "mdy"
+)
+
+// ImportDateFormats lists the date formats of an import.
+var ImportDateFormats = []ImportDateFormat{ImportDayFirst, ImportMonthFirst}
+
+// layouts returns the layouts of the dates in the format, then in ISO 8601.
+func (f ImportDateFormat) layouts() []string {
+	layouts := []string{"02/01/2006 15:04", "02/01/2006"}
+	if f == ImportMonthFirst {
+		layouts = []string{"01/02/2006 15:04", "01/02/2006"}
+	}
+	return append(layouts, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02")
+}
+
+// parse reads a date in the format or in ISO 8601, in local time unless it
+// has an offset.
+func (f ImportDateFormat) parse(s string) (time.Time, error) {
+	for _, layout := range f.layouts() {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// ImportOptions controls how rows are checked and saved.
+type ImportOptions struct {
+	DateFormat     ImportDateFormat
+	HasHeader      bool // the first row holds column titles
+	BypassCapacity bool // import even if the event is full
+	SkipDuplicates bool // leave out people already registered
+	SendEmails     bool // notify attendees who have an email
+}
+
+// ImportRow is a CSV row along with the registration read from it.
+type ImportRow struct {
+	Line         int
+	Registration models.Registration
+	Duplicate    bool
+	Err          error // why the row is left out, nil if it is imported
+}
+
+// ImportReport is the outcome of an import or of its dry run.
+type ImportReport struct {
+	Rows     []ImportRow
+	Imported int
+}
+
+// Valid returns the number of rows that are (or would be) imported.
+func (r *ImportReport) Valid() int {
+	n := 0
+	for _, row := range r.Rows {
+		if row.Err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Seats returns the number of seats taken by the valid rows.
+func (r *ImportReport) Seats() int {
+	n := 0
+	for _, row := range r.Rows {
+		if row.Err == nil {
+			n += row.Registration.Seats
+		}
+	}
+	return n
+}
+
+// Duplicates returns the number of rows matching an existing registration
+// or an earlier row.
+func (r *ImportReport) Duplicates() int {
+	n := 0
+	for _, row := range r.Rows {
+		if row.Duplicate {
+			n++
+		}
+	}
+	return n
+}
+
+// ParseImportCSV reads the records of a CSV file. Both the comma and the
+// semicolon used by spreadsheets in some locales are accepted as separators.
+func ParseImportCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read csv: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrImportInvalidCSV, err)
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		if len(records) == MaxImportRows+1 {
+			return nil, ErrImportTooManyRows
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return nil, ErrImportEmpty
+	}
+	return records, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// DetectImportMapping maps the columns of header to fields by recognizing
+// the titles of the attendee export in any language, or the field names
+// themselves. It reports whether any column was recognized, which tells
+// whether the row is a header at all.
+func DetectImportMapping(header []string) ([]ImportField, bool) {
+	mapping := make([]ImportField, len(header))
+	found := false
+	for i, title := range header {
+		for _, f := range ImportFields {
+			if i18n.Matches("csv."+string(f), title) || strings.EqualFold(strings.TrimSpace(title), string(f)) {
+				mapping[i] = f
+				found = true
+				break
+			}
+		}
+	}
+	return mapping, found
+}
+
+// DetectImportDateFormat guesses the date format from the values of the
+// column mapped to the registration date: a number above 12 is a day, which
+// tells the order. It falls back to the format of the locale when the dates
+// do not tell, or disagree.
+func DetectImportDateFormat(ctx context.Context, records [][]string, mapping []ImportField, hasHeader bool) ImportDateFormat {
+	fallback := ImportDayFirst
+	if i18n.Locale(ctx) == "en" {
+		fallback = ImportMonthFirst
+	}
+	column := slices.Index(mapping, ImportRegisteredAt)
+	if column < 0 {
+		return fallback
+	}
+
+	dayFirst, monthFirst := false, false
+	for i, record := range records {
+		if (i == 0 && hasHeader) || column >= len(record) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(record[column]), "/", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		first, err1 := strconv.Atoi(parts[0])
+		second, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		dayFirst = dayFirst || first > 12
+		monthFirst = monthFirst || second > 12
+	}
+	switch {
+	case dayFirst && !monthFirst:
+		return ImportDayFirst
+	case monthFirst && !dayFirst:
+		return ImportMonthFirst
+	}
+	return fallback
+}
+
+// PreviewImport checks the records against the event without saving
+// anything.
+func (s *RegistrationService) PreviewImport(ctx context.Context, eventID string, records [][]string, mapping []ImportField, opts ImportOptions) (*ImportReport, error) {
+	_, report, err := s.planImport(ctx, eventID, records, mapping, opts)
+	return report, err
+}
+
+// Import saves the valid rows in one transaction and notifies the attendees
+// if asked to. Invalid rows are left out and reported.
+func (s *RegistrationService) Import(ctx context.Context, eventID string, records [][]string, mapping []ImportField, opts ImportOptions) (*ImportReport, error) {
+	event, report, err := s.planImport(ctx, eventID, records, mapping, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var regs []models.Registration
+	for _, row := range report.Rows {
+		if row.Err == nil {
+			regs = append(regs, row.Registration)
+		}
+	}
+	if len(regs) == 0 {
+		return report, nil
+	}
+	if err := s.registrations.CreateMany(regs); err != nil {
+		return nil, fmt.Errorf("import registrations: %w", err)
+	}
+	report.Imported = len(regs)
+	for _, r := range regs {
+		metrics.Registrations.Inc("import", string(r.Status))
+	}
+	slog.InfoContext(ctx, "attendees imported", "event", event.Slug, "count", report.Imported)
+
+	if opts.SendEmails {
+		for i := range regs {
+			s.sendStatusMail(ctx, event, &regs[i])
+		}
+	}
+	return report, nil
+}
+
+// planImport reads the registrations from the records and decides which
+// ones can be imported. Companions are not limited to the event's maximum:
+// organizers importing a list are trusted with the size of groups.
+func (s *RegistrationService) planImport(ctx context.Context, eventID string, records [][]string, mapping []ImportField, opts ImportOptions) (*models.Event, *ImportReport, error) {
+	event, err := s.events.GetByID(eventID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get event: %w", err)
+	}
+	if event == nil {
+		return nil, nil, ErrEventNotFound
+	}
+	hasName := false
+	for _, f := range mapping {
+		hasName = hasName || f == ImportName
+	}
+	if !hasName {
+		return nil, nil, ErrImportNoNameColumn
+	}
+
+	existing, err := s.registrations.ListByEvent(eventID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list registrations: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, reg := range existing {
+		if reg.Status != models.StatusRejected {
+			seen[identityKey(reg.Email, reg.Name)] = true
+		}
+	}
+	seats, err := s.registrations.CountByEvent(eventID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("count registrations: %w", err)
+	}
+
+	report := &ImportReport{}
+	for i, record := range records {
+		if i == 0 && opts.HasHeader {
+			continue
+		}
+		row := ImportRow{Line: i + 1}
+		row.Registration, row.Err = readImportRecord(event, record, mapping, opts.DateFormat)
+
+		key := identityKey(row.Registration.Email, row.Registration.Name)
+		if row.Registration.Name != "" {
+			row.Duplicate = seen[key]
+			row.Registration.Duplicate = row.Duplicate
+		}
+		if row.Err == nil && row.Duplicate && (opts.SkipDuplicates || event.DuplicatePolicy == models.DuplicateReject) {
+			row.Err = ErrDuplicateRegistration
+		}
+
+		confirmed := row.Registration.Status == models.StatusConfirmed
+		if row.Err == nil && confirmed && event.MaxCapacity != nil && !opts.BypassCapacity && seats+row.Registration.Seats > *event.MaxCapacity {
+			row.Err = ErrRegistrationFull
+		}
+
+		if row.Err == nil {
+			seen[key] = true
+			if confirmed {
+				seats += row.Registration.Seats
+			}
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return event, report, nil
+}
+
+// readImportRecord builds a registration of the event from a record. Values
+// are read in the format of the attendee export, dates in the given format.
+// Without a status, the registration is pending if the event requires
+// approval, as it would be when registering, and confirmed otherwise.
+func readImportRecord(event *models.Event, record []string, mapping []ImportField, dates ImportDateFormat) (models.Registration, error) {
+	reg := models.Registration{
+		ID:           uuid.New().String(),
+		EventID:      event.ID,
+		CancelToken:  uuid.New().String(),
+		Status:       models.StatusConfirmed,
+		RegisteredAt: time.Now(),
+	}
+	if event.ApprovalRequired {
+		reg.Status = models.StatusPending
+	}
+	var companions []string
+	var rowErr error
+	for i, f := range mapping {
+		if i >= len(record) {
+			break
+		}
+		v := strings.TrimSpace(record[i])
+		switch f {
+		case ImportName:
+			reg.Name = v
+		case ImportEmail:
+			reg.Email = v
+		case ImportComment:
+			reg.Comment = v
+		case ImportRegisteredAt:
+			if v == "" {
+				continue
+			}
+			t, err := dates.parse(v)
+			if err != nil && rowErr == nil {
+				rowErr = ErrImportInvalidDate
+			}
+			if err == nil {
+				reg.RegisteredAt = t
+			}
+		case ImportStatus:
+			if v == "" {
+				continue
+			}
+			status, ok := parseImportStatus(v)
+			if !ok && rowErr == nil {
+				rowErr = ErrImportInvalidStatus
+			}
+			if ok {
+				reg.Status = status
+			}
+		case ImportCompanions:
+			for _, c := range strings.Split(v, ";") {
+				if c = strings.TrimSpace(c); c != "" {
+					companions = append(companions, c)
+				}
+			}
+		}
+	}
+
+	for i, c := range companions {
+		reg.Companions = append(reg.Companions, models.Companion{
+			ID:             uuid.New().String(),
+			RegistrationID: reg.ID,
+			Name:           c,
+			Position:       i,
+		})
+	}
+	reg.Seats = 1 + len(companions)
+
+	if reg.Name == "" {
+		return reg, ErrNameRequired
+	}
+	if reg.Email != "" {
+		if addr, err := netmail.ParseAddress(reg.Email); err != nil || addr.Address != reg.Email {
+			return reg, ErrInvalidEmail
+		}
+	}
+	return reg, rowErr
+}
+
+// parseImportStatus reads a status as exported in any language, or by name.
+func parseImportStatus(v string) (models.RegistrationStatus, bool) {
+	for _, status := range []models.RegistrationStatus{models.StatusConfirmed, models.StatusPending, models.StatusRejected} {
+		if i18n.Matches("status."+string(status), v) || strings.EqualFold(v, string(status)) {
+			return status, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/i18n"
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+func TestDetectImportDateFormat(t *testing.T) {
+	mapping := []ImportField{ImportName, ImportRegisteredAt}
+	tests := []struct {
+		name   string
+		locale string
+		dates  []string
+		want   ImportDateFormat
+	}{
+		{"day above 12", "en", []string{"03/04/2030 10:00", "25/04/2030 10:00"}, ImportDayFirst},
+		{"month above 12", "fr", []string{"03/04/2030", "04/25/2030"}, ImportMonthFirst},
+		{"ambiguous in French", "fr", []string{"03/04/2030"}, ImportDayFirst},
+		{"ambiguous in English", "en", []string{"03/04/2030"}, ImportMonthFirst},
+		{"contradictory", "fr", []string{"25/04/2030", "04/25/2030"}, ImportDayFirst},
+		{"ISO 8601 only", "en", []string{"2030-04-25"}, ImportMonthFirst},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := [][]string{{"Name", "Registration date"}}
+			for _, d := range tt.dates {
+				records = append(records, []string{"A", d})
+			}
+			ctx := i18n.WithLocale(context.Background(), tt.locale)
+			if got := DetectImportDateFormat(ctx, records, mapping, true); got != tt.want {
+				t.Errorf("DetectImportDateFormat(%q) = %q, want %q", tt.dates, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportDateFormatParse(t *testing.T) {
+	tests := []struct {
+		format ImportDateFormat
+		value  string
+		want   time.Time
+	}{
+		{ImportDayFirst, "03/04/2030 10:30", time.Date(2030, 4, 3, 10, 30, 0, 0, time.Local)},
+		{ImportMonthFirst, "03/04/2030 10:30", time.Date(2030, 3, 4, 10, 30, 0, 0, time.Local)},
+		{ImportMonthFirst, "03/04/2030", time.Date(2030, 3, 4, 0, 0, 0, 0, time.Local)},
+		{ImportDayFirst, "2030-03-04 10:30", time.Date(2030, 3, 4, 10, 30, 0, 0, time.Local)},
+		{ImportMonthFirst, "2030-03-04T10:30:15", time.Date(2030, 3, 4, 10, 30, 15, 0, time.Local)},
+		{ImportDayFirst, "2030-03-04T10:30:00Z", time.Date(2030, 3, 4, 10, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := tt.format.parse(tt.value)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%s: parse(%q) = %v, %v, want %v", tt.format, tt.value, got, err, tt.want)
+		}
+	}
+
+	if _, err := ImportDayFirst.parse("04/25/2030"); err == nil {
+		t.Error("month 25 accepted with the day first")
+	}
+}
+
+func TestReadImportRecordStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		approval bool
+		mapping  []ImportField
+		record   []string
+		want     models.RegistrationStatus
+	}{
+		{"no status column", false, []ImportField{ImportName}, []string{"Ada"}, models.StatusConfirmed},
+		{"no status column, approval required", true, []ImportField{ImportName}, []string{"Ada"}, models.StatusPending},
+		{"empty status, approval required", true, []ImportField{ImportName, ImportStatus}, []string{"Ada", ""}, models.StatusPending},
+		{"confirmed, approval required", true, []ImportField{ImportName, ImportStatus}, []string{"Ada", "confirmed"}, models.StatusConfirmed},
+		{"rejected", false, []ImportField{ImportName, ImportStatus}, []string{"Ada", "rejected"}, models.StatusRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.Event{ID: "event", ApprovalRequired: tt.approval}
+			reg, err := readImportRecord(event, tt.record, tt.mapping, ImportDayFirst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reg.Status != tt.want {
+				t.Errorf("status = %s, want %s", reg.Status, tt.want)
+			}
+		})
+	}
+}
@@ -3,27 +3,40 @@ package services
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/toulibre/libreregistration/internal/config"
-	"github.com/toulibre/libreregistration/internal/database"
 	"github.com/toulibre/libreregistration/internal/mail"
+	"github.com/toulibre/libreregistration/internal/metrics"
 	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/worker"
 )
 
+// resendInterval is the time before the confirmation of a registration can
+// be sent again, so that the form cannot flood an inbox.
+const resendInterval = 5 * time.Minute
+
 type RegistrationService struct {
-	registrations *database.RegistrationStore
-	events        *database.EventStore
+	registrations RegistrationStore
+	events        EventStore
+	sessions      SessionStore
 	cfg           *config.Config
+	workers       *worker.Supervisor
 }
 
-func NewRegistrationService(registrations *database.RegistrationStore, events *database.EventStore, cfg *config.Config) *RegistrationService {
-	return &RegistrationService{registrations: registrations, events: events, cfg: cfg}
+func NewRegistrationService(registrations RegistrationStore, events EventStore, sessions SessionStore, cfg *config.Config, workers *worker.Supervisor) *RegistrationService {
+	return &RegistrationService{registrations: registrations, events: events, sessions: sessions, cfg: cfg, workers: workers}
 }
 
-func (s *RegistrationService) Register(ctx context.Context, eventID, name, email, comment string) (*models.Registration, error) {
+// Register records a registration for the attendee and the named companions
+// coming with them, to the event and to the given sessions of its agenda.
+// Each person takes a seat.
+func (s *RegistrationService) Register(ctx context.Context, eventID, name, email, comment string, companions, sessionIDs []string) (*models.Registration, error) {
 	// Check event exists and is open
 	event, err := s.events.GetByID(eventID)
 	if err != nil {
@@ -32,7 +45,7 @@ func (s *RegistrationService) Register(ctx context.Context, eventID, name, email
 	if event == nil {
 		return nil, ErrEventNotFound
 	}
-	if !event.RegistrationOpen {
+	if !event.RegistrationOpen || event.Status != models.EventPublished {
 		return nil, ErrRegistrationNotOpen
 	}
 
@@ -41,16 +54,53 @@ func (s *RegistrationService) Register(ctx context.Context, eventID, name, email
 		return nil, ErrRegistrationDeadlinePassed
 	}
 
+	// Check companions
+	companionNames := make([]string, 0, len(companions))
+	for _, c := range companions {
+		if c = strings.TrimSpace(c); c != "" {
+			companionNames = append(companionNames, c)
+		}
+	}
+	if len(companionNames) > event.MaxCompanions {
+		return nil, ErrTooManyCompanions
+	}
+	seats := 1 + len(companionNames)
+
 	// Check capacity
 	if event.MaxCapacity != nil {
 		count, err := s.registrations.CountByEvent(eventID)
 		if err != nil {
 			return nil, fmt.Errorf("count registrations: %w", err)
 		}
-		if count >= *event.MaxCapacity {
+		if count+seats > *event.MaxCapacity {
 			return nil, ErrRegistrationFull
 		}
 	}
+	sessionIDs, err = s.checkSessions(eventID, sessionIDs, seats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check duplicates
+	duplicate := false
+	if event.DuplicatePolicy == models.DuplicateWarn || event.DuplicatePolicy == models.DuplicateReject {
+		existing, err := s.findByIdentity(eventID, email, name)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if event.DuplicatePolicy == models.DuplicateReject {
+				return nil, ErrDuplicateRegistration
+			}
+			duplicate = true
+		}
+	}
+
+	// Registrations to events requiring approval wait for review
+	status := models.StatusConfirmed
+	if event.ApprovalRequired {
+		status = models.StatusPending
+	}
 
 	reg := &models.Registration{
 		ID:           uuid.New().String(),
@@ -59,23 +109,138 @@ func (s *RegistrationService) Register(ctx context.Context, eventID, name, email
 		Email:        email,
 		Comment:      comment,
 		CancelToken:  uuid.New().String(),
+		Status:       status,
+		Seats:        seats,
 		RegisteredAt: time.Now(),
+		SessionIDs:   sessionIDs,
+		Duplicate:    duplicate,
+	}
+	for i, c := range companionNames {
+		reg.Companions = append(reg.Companions, models.Companion{
+			ID:             uuid.New().String(),
+			RegistrationID: reg.ID,
+			Name:           c,
+			Position:       i,
+		})
 	}
 
 	if err := s.registrations.Create(reg); err != nil {
 		return nil, fmt.Errorf("create registration: %w", err)
 	}
+	metrics.Registrations.Inc("public", string(reg.Status))
+	slog.InfoContext(ctx, "registration recorded", "event", event.Slug, "registration", reg.ID, "status", reg.Status, "email", reg.Email)
 
-	// Send confirmation email if email provided and SMTP configured
-	if email != "" && s.cfg.SMTPHost != "" {
-		cancelURL := fmt.Sprintf("%s/cancel/%s", s.cfg.BaseURL, reg.CancelToken)
-		go mail.SendConfirmation(s.cfg, ctx, email, event.Title, cancelURL)
-	}
+	s.sendStatusMail(ctx, event, reg)
 
 	return reg, nil
 }
 
-func (s *RegistrationService) Cancel(token string) (*models.Registration, error) {
+// Review approves or rejects registrations of an event and notifies the
+// attendees. Approvals stop with ErrRegistrationFull once the event is full,
+// or ErrSessionFull once a session of the registration is; the number of
+// registrations changed so far is returned along with it.
+func (s *RegistrationService) Review(ctx context.Context, eventID string, regIDs []string, status models.RegistrationStatus) (int, error) {
+	if status != models.StatusConfirmed && status != models.StatusRejected {
+		return 0, fmt.Errorf("review: invalid status %q", status)
+	}
+	event, err := s.events.GetByID(eventID)
+	if err != nil {
+		return 0, fmt.Errorf("get event: %w", err)
+	}
+	if event == nil {
+		return 0, ErrEventNotFound
+	}
+
+	changed := 0
+	for _, id := range regIDs {
+		reg, err := s.registrations.GetByID(id)
+		if err != nil {
+			return changed, fmt.Errorf("get registration: %w", err)
+		}
+		if reg == nil || reg.EventID != eventID || reg.Status == status {
+			continue
+		}
+
+		if status == models.StatusConfirmed && event.MaxCapacity != nil {
+			count, err := s.registrations.CountByEvent(eventID)
+			if err != nil {
+				return changed, fmt.Errorf("count registrations: %w", err)
+			}
+			if count+reg.Seats > *event.MaxCapacity {
+				return changed, ErrRegistrationFull
+			}
+		}
+		if status == models.StatusConfirmed {
+			if _, err := s.checkSessions(eventID, reg.SessionIDs, reg.Seats); err != nil {
+				return changed, err
+			}
+		}
+
+		if err := s.registrations.UpdateStatus(reg.ID, status); err != nil {
+			return changed, err
+		}
+		reg.Status = status
+		changed++
+
+		s.sendStatusMail(ctx, event, reg)
+	}
+	return changed, nil
+}
+
+// checkSessions checks that the sessions belong to the event, take
+// registrations and have seats left, and returns them without duplicates.
+func (s *RegistrationService) checkSessions(eventID string, sessionIDs []string, seats int) ([]string, error) {
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+	agenda, err := s.sessions.ListByEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, id := range sessionIDs {
+		if slices.Contains(ids, id) {
+			continue
+		}
+		i := slices.IndexFunc(agenda, func(se models.Session) bool { return se.ID == id })
+		if i < 0 || agenda[i].MaxCapacity == nil {
+			return nil, ErrSessionNotFound
+		}
+		if agenda[i].RegistrationCount+seats > *agenda[i].MaxCapacity {
+			return nil, ErrSessionFull
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// sendMail sends an email in the background, so that the request does not
+// wait for the SMTP server, while shutdown does.
+func (s *RegistrationService) sendMail(send func()) {
+	s.workers.Go("mail", func(context.Context) { send() })
+}
+
+// sendStatusMail tells the attendee where their registration stands, if they
+// gave an email and SMTP is configured. Confirmations of reviewed
+// registrations are worded as approvals.
+func (s *RegistrationService) sendStatusMail(ctx context.Context, event *models.Event, reg *models.Registration) {
+	if reg.Email == "" || s.cfg.SMTPHost == "" {
+		return
+	}
+	cancelURL := fmt.Sprintf("%s/cancel/%s", s.cfg.BaseURL, reg.CancelToken)
+	switch {
+	case reg.Status == models.StatusPending:
+		s.sendMail(func() { mail.SendApplicationReceived(s.cfg, ctx, reg.Email, event.Title, cancelURL) })
+	case reg.Status == models.StatusRejected:
+		s.sendMail(func() { mail.SendRejection(s.cfg, ctx, reg.Email, event.Title) })
+	case event.ApprovalRequired:
+		s.sendMail(func() { mail.SendApproval(s.cfg, ctx, reg.Email, event.Title, cancelURL) })
+	default:
+		s.sendMail(func() { mail.SendConfirmation(s.cfg, ctx, reg.Email, event.Title, cancelURL) })
+	}
+}
+
+func (s *RegistrationService) Cancel(ctx context.Context, token string) (*models.Registration, error) {
 	reg, err := s.registrations.GetByCancelToken(token)
 	if err != nil {
 		return nil, fmt.Errorf("get registration: %w", err)
@@ -84,15 +249,147 @@ func (s *RegistrationService) Cancel(token string) (*models.Registration, error)
 		return nil, nil
 	}
 
-	if err := s.registrations.DeleteByToken(token); err != nil {
-		return nil, fmt.Errorf("delete registration: %w", err)
+	if err := s.registrations.CancelByToken(token, time.Now()); err != nil {
+		return nil, fmt.Errorf("cancel registration: %w", err)
 	}
+	metrics.Cancellations.Inc()
+	slog.InfoContext(ctx, "registration cancelled", "registration", reg.ID, "email", reg.Email)
 
 	return reg, nil
 }
 
+// ResendConfirmation sends the confirmation email again for the registration
+// matching email, if any, and if not sent again in the last few minutes. It
+// reports nothing to avoid revealing who registered.
+func (s *RegistrationService) ResendConfirmation(ctx context.Context, eventID, email string) error {
+	if email == "" || s.cfg.SMTPHost == "" {
+		return nil
+	}
+	event, err := s.events.GetByID(eventID)
+	if err != nil {
+		return fmt.Errorf("get event: %w", err)
+	}
+	if event == nil {
+		return ErrEventNotFound
+	}
+	reg, err := s.findByIdentity(eventID, email, "")
+	if err != nil {
+		return err
+	}
+	if reg == nil {
+		return nil
+	}
+	now := time.Now()
+	resent, err := s.registrations.MarkResent(reg.ID, now, now.Add(-resendInterval))
+	if err != nil {
+		return err
+	}
+	if !resent {
+		slog.InfoContext(ctx, "confirmation resent recently, skipped", "registration", reg.ID)
+		return nil
+	}
+	s.sendStatusMail(ctx, event, reg)
+	return nil
+}
+
+// ListByEvent returns all the registrations of an event, flagging duplicates.
 func (s *RegistrationService) ListByEvent(eventID string) ([]models.Registration, error) {
-	return s.registrations.ListByEvent(eventID)
+	regs, err := s.registrations.ListByEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	flagDuplicates(regs)
+	return regs, nil
+}
+
+// Duplicates returns the IDs of the registrations to an event flagged as
+// duplicates by ListByEvent, without loading the whole registrations.
+func (s *RegistrationService) Duplicates(eventID string) (map[string]bool, error) {
+	regs, err := s.registrations.ListIdentities(eventID)
+	if err != nil {
+		return nil, err
+	}
+	flagDuplicates(regs)
+	duplicates := make(map[string]bool)
+	for _, reg := range regs {
+		if reg.Duplicate {
+			duplicates[reg.ID] = true
+		}
+	}
+	return duplicates, nil
+}
+
+// flagDuplicates flags the registrations that are not rejected and have the
+// same identity as another one.
+func flagDuplicates(regs []models.Registration) {
+	seen := make(map[string]int)
+	for i := range regs {
+		if regs[i].Status == models.StatusRejected {
+			continue
+		}
+		key := identityKey(regs[i].Email, regs[i].Name)
+		if first, ok := seen[key]; ok {
+			regs[first].Duplicate = true
+			regs[i].Duplicate = true
+			continue
+		}
+		seen[key] = i
+	}
+}
+
+// CountByStatus returns the number of registrations to an event and of their
+// seats, by status.
+func (s *RegistrationService) CountByStatus(eventID string) (models.RegistrationCounts, error) {
+	return s.registrations.CountByStatus(eventID)
+}
+
+// ListPage returns a page of the registrations to the event selected by the
+// filter, and the number of selected registrations. Duplicates are not
+// flagged.
+func (s *RegistrationService) ListPage(eventID string, f models.RegistrationFilter, page models.Page) ([]models.Registration, int, error) {
+	return s.registrations.ListPage(eventID, f, page)
+}
+
+// ListConfirmedByEvent returns the confirmed registrations of an event, as
+// shown on the public attendee list.
+func (s *RegistrationService) ListConfirmedByEvent(eventID string) ([]models.Registration, error) {
+	regs, err := s.registrations.ListByEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	confirmed := regs[:0]
+	for _, reg := range regs {
+		if reg.Status == models.StatusConfirmed {
+			confirmed = append(confirmed, reg)
+		}
+	}
+	return confirmed, nil
+}
+
+// findByIdentity returns the first registration of the event that is not
+// rejected and has the same normalized email, or the same normalized name
+// when no email is given.
+func (s *RegistrationService) findByIdentity(eventID, email, name string) (*models.Registration, error) {
+	regs, err := s.registrations.ListByEvent(eventID)
+	if err != nil {
+		return nil, fmt.Errorf("list registrations: %w", err)
+	}
+	key := identityKey(email, name)
+	for i := range regs {
+		if regs[i].Status != models.StatusRejected && identityKey(regs[i].Email, regs[i].Name) == key {
+			return &regs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// identityKey identifies a person for duplicate detection: the normalized
+// email when present, otherwise the normalized name.
+func identityKey(email, name string) string {
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		return "email:" + email
+	}
+	return "name:" + strings.ToLower(strings.Join(strings.Fields(name), " "))
 }
 
 func (s *RegistrationService) DeleteRegistration(id string) error {
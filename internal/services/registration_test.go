@@ -0,0 +1,122 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/services"
+)
+
+func TestRegisterCapacity(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	capacity := 3
+	event := f.event(t, "meetup", func(e *models.Event) {
+		e.MaxCapacity = &capacity
+		e.MaxCompanions = 2
+	})
+
+	f.register(t, event, "Ada", "ada@example.org", "Charles")
+	if _, err := f.registrations.Register(ctx, event.ID, "Grace", "grace@example.org", "", []string{"Alan"}, nil); !errors.Is(err, services.ErrRegistrationFull) {
+		t.Fatalf("Register beyond capacity: error = %v, want %v", err, services.ErrRegistrationFull)
+	}
+	f.register(t, event, "Grace", "grace@example.org")
+	if _, err := f.registrations.Register(ctx, event.ID, "Alan", "alan@example.org", "", nil, nil); !errors.Is(err, services.ErrRegistrationFull) {
+		t.Fatalf("Register to a full event: error = %v, want %v", err, services.ErrRegistrationFull)
+	}
+
+	// Pending registrations take no seat until approved
+	capacity = 1
+	approval := f.event(t, "workshop", func(e *models.Event) {
+		e.MaxCapacity = &capacity
+		e.ApprovalRequired = true
+	})
+	first := f.register(t, approval, "Ada", "ada@example.org")
+	second := f.register(t, approval, "Grace", "grace@example.org")
+	if first.Status != models.StatusPending || second.Status != models.StatusPending {
+		t.Fatalf("statuses = %s, %s, want pending", first.Status, second.Status)
+	}
+	if _, err := f.registrations.Review(ctx, approval.ID, []string{first.ID}, models.StatusConfirmed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.registrations.Review(ctx, approval.ID, []string{second.ID}, models.StatusConfirmed); !errors.Is(err, services.ErrRegistrationFull) {
+		t.Fatalf("approving beyond capacity: error = %v, want %v", err, services.ErrRegistrationFull)
+	}
+}
+
+func TestRegisterDuplicates(t *testing.T) {
+	tests := []struct {
+		policy        models.DuplicatePolicy
+		wantErr       error
+		wantDuplicate bool
+	}{
+		{models.DuplicateAllow, nil, false},
+		{models.DuplicateWarn, nil, true},
+		{models.DuplicateReject, services.ErrDuplicateRegistration, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			event := f.event(t, "meetup", func(e *models.Event) { e.DuplicatePolicy = tt.policy })
+			f.register(t, event, "Ada", " Ada@Example.org ")
+			f.register(t, event, "Grace", "")
+
+			// Same email, whatever the name and case
+			reg, err := f.registrations.Register(ctx, event.ID, "Ada Lovelace", "ada@example.org", "", nil, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Register error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && reg.Duplicate != tt.wantDuplicate {
+				t.Errorf("Duplicate = %v, want %v", reg.Duplicate, tt.wantDuplicate)
+			}
+
+			// Same name, without an email
+			reg, err = f.registrations.Register(ctx, event.ID, " grace ", "", "", nil, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Register without email: error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && reg.Duplicate != tt.wantDuplicate {
+				t.Errorf("Duplicate without email = %v, want %v", reg.Duplicate, tt.wantDuplicate)
+			}
+
+			// Someone else
+			reg = f.register(t, event, "Alan", "alan@example.org")
+			if reg.Duplicate {
+				t.Error("different person flagged as a duplicate")
+			}
+		})
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	event := f.event(t, "meetup", func(e *models.Event) { e.DuplicatePolicy = models.DuplicateWarn })
+	first := f.register(t, event, "Ada", "ada@example.org")
+	second := f.register(t, event, "Ada Lovelace", "ADA@example.org")
+	f.register(t, event, "Grace", "grace@example.org")
+	rejected := f.register(t, event, "Grace Hopper", "grace@example.org")
+	if _, err := f.registrations.Review(ctx, event.ID, []string{rejected.ID}, models.StatusRejected); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates, err := f.registrations.Duplicates(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(duplicates) != 2 || !duplicates[first.ID] || !duplicates[second.ID] {
+		t.Errorf("Duplicates = %v, want %s and %s", duplicates, first.ID, second.ID)
+	}
+	regs, err := f.registrations.ListByEvent(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, reg := range regs {
+		if reg.Duplicate != duplicates[reg.ID] {
+			t.Errorf("%s flagged %v by ListByEvent, %v by Duplicates", reg.Name, reg.Duplicate, duplicates[reg.ID])
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/recurrence"
+	"github.com/toulibre/libreregistration/internal/slug"
+)
+
+// Bounds of the number of days occurrences are generated ahead.
+const (
+	DefaultHorizonDays = 90
+	maxHorizonDays     = 366
+)
+
+// occurrenceLayout is the format of the occurrence dates.
+const occurrenceLayout = "2006-01-02"
+
+type SeriesService struct {
+	series SeriesStore
+	events *EventService
+}
+
+func NewSeriesService(series SeriesStore, events *EventService) *SeriesService {
+	return &SeriesService{series: series, events: events}
+}
+
+func (s *SeriesService) GetByID(id string) (*models.Series, error) {
+	return s.series.GetByID(id)
+}
+
+func (s *SeriesService) GetBySlug(slug string) (*models.Series, error) {
+	return s.series.GetBySlug(slug)
+}
+
+func (s *SeriesService) List() ([]models.Series, error) {
+	return s.series.ListAll()
+}
+
+// Check validates a rule, exceptions and horizon without saving them.
+func (s *SeriesService) Check(rule, exceptions string, horizonDays int) error {
+	return setSchedule(&models.Series{}, rule, exceptions, horizonDays)
+}
+
+// Create makes the event the first occurrence of a new series, and generates
+// the next occurrences. Exceptions are dates separated by commas or spaces.
+func (s *SeriesService) Create(first *models.Event, rule, exceptions string, horizonDays int, now time.Time) (*models.Series, error) {
+	sr := &models.Series{
+		ID:        uuid.New().String(),
+		Title:     first.Title,
+		StartsAt:  first.EventDate,
+		CreatedBy: first.CreatedBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := setSchedule(sr, rule, exceptions, horizonDays); err != nil {
+		return nil, err
+	}
+
+	// Ensure unique slug
+	base := slug.Generate(sr.Title)
+	for i := 1; ; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		exists, err := s.series.SlugExists(candidate)
+		if err != nil {
+			return nil, fmt.Errorf("check slug: %w", err)
+		}
+		if !exists {
+			sr.Slug = candidate
+			break
+		}
+	}
+
+	if err := s.series.Create(sr); err != nil {
+		return nil, err
+	}
+	first.SeriesID = &sr.ID
+	first.OccurrenceDate = first.EventDate.In(time.Local).Format(occurrenceLayout)
+	if err := s.events.Update(first); err != nil {
+		return nil, err
+	}
+	return sr, s.generate(sr, now)
+}
+
+// Update changes the rule, exceptions and horizon of a series. The
+// occurrences to come that no longer match are deleted, unless people
+// registered to them, and the missing ones are generated.
+func (s *SeriesService) Update(id, rule, exceptions string, horizonDays int, now time.Time) error {
+	sr, err := s.series.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if sr == nil {
+		return ErrSeriesNotFound
+	}
+	if err := setSchedule(sr, rule, exceptions, horizonDays); err != nil {
+		return err
+	}
+	sr.UpdatedAt = now
+	if err := s.series.Update(sr); err != nil {
+		return err
+	}
+
+	occurrences, err := s.events.ListBySeries(sr.ID)
+	if err != nil {
+		return err
+	}
+	if len(occurrences) > 0 {
+		last := occurrences[len(occurrences)-1].EventDate
+		slots, err := occurrenceDates(sr, now, last.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		for _, o := range occurrences {
+			if o.EventDate.Before(now) || slots[o.OccurrenceDate] || o.RegistrationCount+o.PendingCount > 0 {
+				continue
+			}
+			if err := s.events.Delete(o.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return s.generate(sr, now)
+}
+
+// Delete ends a series. Its occurrences are kept as standalone events.
+func (s *SeriesService) Delete(id string) error {
+	return s.series.Delete(id)
+}
+
+// SkipOccurrence adds the date of the occurrence to the exceptions of its
+// series, so that it is not generated again once deleted.
+func (s *SeriesService) SkipOccurrence(e *models.Event) error {
+	if e.SeriesID == nil {
+		return nil
+	}
+	sr, err := s.series.GetByID(*e.SeriesID)
+	if err != nil || sr == nil {
+		return err
+	}
+	if slices.Contains(sr.Exceptions, e.OccurrenceDate) {
+		return nil
+	}
+	sr.Exceptions = append(sr.Exceptions, e.OccurrenceDate)
+	slices.Sort(sr.Exceptions)
+	sr.UpdatedAt = time.Now()
+	return s.series.Update(sr)
+}
+
+// UpdateFuture applies the details of an occurrence to the later occurrences
+// of its series. They keep their date, with the time of day of the
+// occurrence, and their status.
+func (s *SeriesService) UpdateFuture(e *models.Event) error {
+	if e.SeriesID == nil {
+		return nil
+	}
+	sr, err := s.series.GetByID(*e.SeriesID)
+	if err != nil || sr == nil {
+		return err
+	}
+	occurrences, err := s.events.ListBySeries(sr.ID)
+	if err != nil {
+		return err
+	}
+	for i := range occurrences {
+		o := &occurrences[i]
+		if o.ID == e.ID || o.OccurrenceDate <= e.OccurrenceDate {
+			continue
+		}
+		date := atTimeOf(o.EventDate, e.EventDate)
+		o.Title = e.Title
+		o.Description = e.Description
+		o.Location = e.Location
+		o.EventDate = date
+		o.EndDate = shift(e.EndDate, e.EventDate, date)
+		o.RegistrationDeadline = shift(e.RegistrationDeadline, e.EventDate, date)
+		o.MaxCapacity = e.MaxCapacity
+		o.AttendeeListPublic = e.AttendeeListPublic
+		o.RegistrationOpen = e.RegistrationOpen
+		o.RegistrationOpensAt = shift(e.RegistrationOpensAt, e.EventDate, date)
+		o.ImagePath = e.ImagePath
+		o.BannerPath = e.BannerPath
+		o.Latitude = e.Latitude
+		o.Longitude = e.Longitude
+		o.VenueID = e.VenueID
+		o.DuplicatePolicy = e.DuplicatePolicy
+		o.ApprovalRequired = e.ApprovalRequired
+		o.MaxCompanions = e.MaxCompanions
+		o.Tags = e.Tags
+		if err := s.events.Update(o); err != nil {
+			return err
+		}
+	}
+
+	sr.Title = e.Title
+	sr.UpdatedAt = time.Now()
+	return s.series.Update(sr)
+}
+
+// Generate creates the missing occurrences of all the series, up to their
+// horizon.
+func (s *SeriesService) Generate(now time.Time) error {
+	all, err := s.series.ListAll()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range all {
+		if err := s.generate(&all[i], now); err != nil {
+			errs = append(errs, fmt.Errorf("series %s: %w", all[i].Slug, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunGenerator generates the occurrences at start and then at every
+// interval, until the context is canceled.
+func (s *SeriesService) RunGenerator(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Generate(time.Now()); err != nil {
+			slog.Warn("could not generate the series occurrences", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// generate creates the occurrences of the series missing between now and its
+// horizon, as copies of the latest occurrence.
+func (s *SeriesService) generate(sr *models.Series, now time.Time) error {
+	occurrences, err := s.events.ListBySeries(sr.ID)
+	if err != nil {
+		return err
+	}
+	if len(occurrences) == 0 {
+		// Nothing left to copy
+		return nil
+	}
+	model := occurrences[len(occurrences)-1]
+	existing := make(map[string]bool)
+	for _, o := range occurrences {
+		existing[o.OccurrenceDate] = true
+	}
+
+	slots, err := occurrenceDates(sr, now, now.AddDate(0, 0, sr.HorizonDays))
+	if err != nil {
+		return err
+	}
+	dates := make([]string, 0, len(slots))
+	for date := range slots {
+		if !existing[date] {
+			dates = append(dates, date)
+		}
+	}
+	slices.Sort(dates)
+
+	for _, date := range dates {
+		day, _ := time.ParseInLocation(occurrenceLayout, date, time.Local)
+		e := occurrenceOf(sr, &model, atTimeOf(day, model.EventDate))
+		if err := s.events.Create(e); err != nil {
+			return fmt.Errorf("create occurrence %s: %w", date, err)
+		}
+	}
+	if len(dates) > 0 {
+		slog.Info("series occurrences generated", "series", sr.Slug, "count", len(dates))
+	}
+	return nil
+}
+
+// occurrenceOf returns a new occurrence of the series on date, copying the
+// model occurrence.
+func occurrenceOf(sr *models.Series, model *models.Event, date time.Time) *models.Event {
+	e := &models.Event{
+		Title:                model.Title,
+		Slug:                 sr.Slug + "-" + date.Format(occurrenceLayout),
+		Description:          model.Description,
+		Location:             model.Location,
+		EventDate:            date,
+		EndDate:              shift(model.EndDate, model.EventDate, date),
+		RegistrationDeadline: shift(model.RegistrationDeadline, model.EventDate, date),
+		MaxCapacity:          model.MaxCapacity,
+		AttendeeListPublic:   model.AttendeeListPublic,
+		RegistrationOpen:     model.RegistrationOpen,
+		RegistrationOpensAt:  shift(model.RegistrationOpensAt, model.EventDate, date),
+		Status:               models.EventPublished,
+		ImagePath:            model.ImagePath,
+		BannerPath:           model.BannerPath,
+		Latitude:             model.Latitude,
+		Longitude:            model.Longitude,
+		VenueID:              model.VenueID,
+		DuplicatePolicy:      model.DuplicatePolicy,
+		ApprovalRequired:     model.ApprovalRequired,
+		MaxCompanions:        model.MaxCompanions,
+		Tags:                 model.Tags,
+		SeriesID:             &sr.ID,
+		OccurrenceDate:       date.Format(occurrenceLayout),
+		CreatedBy:            sr.CreatedBy,
+	}
+	if model.Status == models.EventDraft {
+		e.Status = models.EventDraft
+		e.PublishAt = shift(model.PublishAt, model.EventDate, date)
+	}
+	return e
+}
+
+// occurrenceDates returns the dates of the occurrences of the series in
+// [from, to), exceptions left out.
+func occurrenceDates(sr *models.Series, from, to time.Time) (map[string]bool, error) {
+	rule, err := recurrence.Parse(sr.Rule, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	dates := make(map[string]bool)
+	for _, t := range rule.Between(sr.StartsAt.In(time.Local), from, to) {
+		if date := t.Format(occurrenceLayout); !slices.Contains(sr.Exceptions, date) {
+			dates[date] = true
+		}
+	}
+	return dates, nil
+}
+
+// setSchedule validates and sets the rule, exceptions and horizon of a
+// series.
+func setSchedule(sr *models.Series, rule, exceptions string, horizonDays int) error {
+	r, err := recurrence.Parse(rule, time.Local)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	dates, err := ParseExceptions(exceptions)
+	if err != nil {
+		return err
+	}
+	if horizonDays < 1 || horizonDays > maxHorizonDays {
+		return ErrInvalidHorizon
+	}
+	sr.Rule = r.String()
+	sr.Exceptions = dates
+	sr.HorizonDays = horizonDays
+	return nil
+}
+
+// ParseExceptions parses dates as YYYY-MM-DD separated by commas or spaces,
+// and returns them sorted without duplicates.
+func ParseExceptions(input string) ([]string, error) {
+	var dates []string
+	for _, v := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\r' || r == '\t' }) {
+		if _, err := time.Parse(occurrenceLayout, v); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidExceptionDate, v)
+		}
+		dates = append(dates, v)
+	}
+	slices.Sort(dates)
+	return slices.Compact(dates), nil
+}
+
+// atTimeOf returns the day of date at the time of day of clock, in local
+// time.
+func atTimeOf(date, clock time.Time) time.Time {
+	d, c := date.In(time.Local), clock.In(time.Local)
+	return time.Date(d.Year(), d.Month(), d.Day(), c.Hour(), c.Minute(), c.Second(), 0, time.Local)
+}
+
+// shift returns t moved along with an event from one date to another, or nil.
+func shift(t *time.Time, from, to time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := to.Add(t.Sub(from))
+	return &v
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toulibre/libreregistration/internal/frab"
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+type SessionService struct {
+	sessions SessionStore
+}
+
+func NewSessionService(sessions SessionStore) *SessionService {
+	return &SessionService{sessions: sessions}
+}
+
+func (s *SessionService) GetByID(id string) (*models.Session, error) {
+	return s.sessions.GetByID(id)
+}
+
+func (s *SessionService) ListByEvent(eventID string) ([]models.Session, error) {
+	return s.sessions.ListByEvent(eventID)
+}
+
+// AttendeeNames returns the names of the confirmed attendees of the sessions
+// of an event, by session.
+func (s *SessionService) AttendeeNames(eventID string) (map[string][]string, error) {
+	return s.sessions.AttendeeNames(eventID)
+}
+
+func (s *SessionService) Create(se *models.Session) error {
+	if err := validateSession(se); err != nil {
+		return err
+	}
+	se.ID = uuid.New().String()
+	se.CreatedAt = time.Now()
+	return s.sessions.Create(se)
+}
+
+func (s *SessionService) Update(se *models.Session) error {
+	if err := validateSession(se); err != nil {
+		return err
+	}
+	return s.sessions.Update(se)
+}
+
+func (s *SessionService) Delete(id string) error {
+	return s.sessions.Delete(id)
+}
+
+// Import replaces the agenda of an event with the sessions of a Frab
+// schedule, and returns their number. Sessions exported from the event are
+// matched by their GUID and keep their capacity and registrations.
+func (s *SessionService) Import(eventID string, r io.Reader) (int, error) {
+	imported, err := frab.Parse(r, time.Local)
+	if err != nil {
+		if errors.Is(err, frab.ErrInvalid) {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+		return 0, err
+	}
+
+	existing, err := s.sessions.ListByEvent(eventID)
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]models.Session, len(existing))
+	for _, se := range existing {
+		known[se.ID] = se
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	for i := range imported {
+		se := &imported[i]
+		se.EventID = eventID
+		if prev, ok := known[se.ID]; ok && !seen[se.ID] {
+			se.MaxCapacity = prev.MaxCapacity
+			se.CreatedAt = prev.CreatedAt
+		} else {
+			se.ID = uuid.New().String()
+			se.CreatedAt = now
+		}
+		seen[se.ID] = true
+		if err := validateSession(se); err != nil {
+			return 0, fmt.Errorf("%w: %q: %v", ErrInvalidSchedule, se.Title, err)
+		}
+	}
+
+	if err := s.sessions.Replace(eventID, imported); err != nil {
+		return 0, err
+	}
+	return len(imported), nil
+}
+
+// Export writes the agenda of an event as a Frab schedule. url is the
+// address of the public page of the event.
+func (s *SessionService) Export(w io.Writer, event *models.Event, url string) error {
+	sessions, err := s.sessions.ListByEvent(event.ID)
+	if err != nil {
+		return err
+	}
+	return frab.Export(event, sessions, url).Write(w)
+}
+
+func validateSession(se *models.Session) error {
+	se.Title = strings.TrimSpace(se.Title)
+	se.Speaker = strings.TrimSpace(se.Speaker)
+	se.Room = strings.TrimSpace(se.Room)
+	if se.Title == "" {
+		return ErrSessionTitleRequired
+	}
+	if !se.EndsAt.After(se.StartsAt) {
+		return ErrInvalidSessionTime
+	}
+	return nil
+}
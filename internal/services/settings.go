@@ -1,15 +1,14 @@
 package services
 
 import (
-	"github.com/toulibre/libreregistration/internal/database"
 	"github.com/toulibre/libreregistration/internal/models"
 )
 
 type SettingsService struct {
-	settings *database.SettingStore
+	settings SettingStore
 }
 
-func NewSettingsService(settings *database.SettingStore) *SettingsService {
+func NewSettingsService(settings SettingStore) *SettingsService {
 	return &SettingsService{settings: settings}
 }
 
@@ -25,6 +24,12 @@ func (s *SettingsService) GetSiteSettings() (siteName, accentColor string) {
 	return
 }
 
+// CaptchaProvider returns the name of the configured anti-spam provider.
+func (s *SettingsService) CaptchaProvider() string {
+	name, _ := s.settings.Get("captcha_provider")
+	return name
+}
+
 func (s *SettingsService) GetAll() ([]models.Setting, error) {
 	return s.settings.GetAll()
 }
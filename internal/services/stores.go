@@ -0,0 +1,114 @@
+package services
+
+import (
+	"time"
+
+	"github.com/toulibre/libreregistration/internal/models"
+)
+
+// The stores the services keep their data in. They are implemented on SQL
+// databases by package database, and in memory by package database/memory
+// for tests; package database/storetest checks that both behave the same.
+//
+// Getters return nil, and no error, when nothing matches.
+
+type UserStore interface {
+	GetByUsername(username string) (*models.User, error)
+	GetByID(id string) (*models.User, error)
+	Create(u *models.User) error
+	List() ([]models.User, error)
+	Delete(id string) error
+	Count() (int, error)
+	UpdatePassword(id string, passwordHash string) error
+	UpdateRole(id string, role models.Role) error
+}
+
+type EventStore interface {
+	Create(e *models.Event) error
+	Update(e *models.Event) error
+	GetByID(id string) (*models.Event, error)
+	GetBySlug(slug string) (*models.Event, error)
+	SlugExists(slug string) (bool, error)
+	ListUpcoming() ([]models.Event, error)
+	ListUpcomingByTag(tagID string) ([]models.Event, error)
+	ListUpcomingByVenue(venueID string) ([]models.Event, error)
+	ListBySeries(seriesID string) ([]models.Event, error)
+	ListUpcomingBySeries(seriesID string) ([]models.Event, error)
+	ListBetween(from, to time.Time) ([]models.Event, error)
+	ListEndedBefore(t time.Time) ([]models.Event, error)
+	ListAll() ([]models.Event, error)
+	ListPage(f models.EventFilter, page models.Page) ([]models.Event, int, error)
+	PublishDue(now time.Time) (int64, error)
+	OpenRegistrationsDue(now time.Time) (int64, error)
+	Delete(id string) error
+	UploadInUse(filename string) (bool, error)
+	Count() (int, error)
+	CountUpcoming() (int, error)
+}
+
+type RegistrationStore interface {
+	Create(r *models.Registration) error
+	CreateMany(regs []models.Registration) error
+	GetByID(id string) (*models.Registration, error)
+	GetByCancelToken(token string) (*models.Registration, error)
+	ListByEvent(eventID string) ([]models.Registration, error)
+	ListPage(eventID string, f models.RegistrationFilter, page models.Page) ([]models.Registration, int, error)
+	Update(r *models.Registration) error
+	UpdateStatus(id string, status models.RegistrationStatus) error
+	MarkResent(id string, at, since time.Time) (bool, error)
+	Delete(id string) error
+	CancelByToken(token string, at time.Time) error
+	ListAll() ([]models.Registration, error)
+	ListCancellations() ([]models.Cancellation, error)
+	CountByEvent(eventID string) (int, error)
+	CountByStatus(eventID string) (models.RegistrationCounts, error)
+	ListIdentities(eventID string) ([]models.Registration, error)
+	TotalCount() (int, error)
+}
+
+type SessionStore interface {
+	Create(se *models.Session) error
+	Update(se *models.Session) error
+	GetByID(id string) (*models.Session, error)
+	ListByEvent(eventID string) ([]models.Session, error)
+	AttendeeNames(eventID string) (map[string][]string, error)
+	Delete(id string) error
+	Replace(eventID string, sessions []models.Session) error
+}
+
+type TagStore interface {
+	ListAll() ([]models.Tag, error)
+	ListUpcoming() ([]models.Tag, error)
+	GetByID(id string) (*models.Tag, error)
+	GetBySlug(slug string) (*models.Tag, error)
+	ListByEvents(eventIDs []string) (map[string][]models.Tag, error)
+	SetEventTags(eventID string, tags []models.Tag) error
+	Update(t *models.Tag) error
+	Delete(id string) error
+}
+
+type SeriesStore interface {
+	Create(sr *models.Series) error
+	Update(sr *models.Series) error
+	GetByID(id string) (*models.Series, error)
+	GetBySlug(slug string) (*models.Series, error)
+	SlugExists(slug string) (bool, error)
+	ListAll() ([]models.Series, error)
+	Delete(id string) error
+}
+
+type VenueStore interface {
+	Create(v *models.Venue) error
+	Update(v *models.Venue) error
+	GetByID(id string) (*models.Venue, error)
+	GetBySlug(slug string) (*models.Venue, error)
+	SlugExists(slug string) (bool, error)
+	ListAll() ([]models.Venue, error)
+	Delete(id string) error
+}
+
+type SettingStore interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+	GetAll() ([]models.Setting, error)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/slug"
+)
+
+// maxTagLength bounds the length of tag names, in characters.
+const maxTagLength = 50
+
+type TagService struct {
+	tags TagStore
+}
+
+func NewTagService(tags TagStore) *TagService {
+	return &TagService{tags: tags}
+}
+
+// List returns all the tags with their number of events.
+func (s *TagService) List() ([]models.Tag, error) {
+	return s.tags.ListAll()
+}
+
+// ListUpcoming returns the tags of the published events to come.
+func (s *TagService) ListUpcoming() ([]models.Tag, error) {
+	return s.tags.ListUpcoming()
+}
+
+func (s *TagService) GetBySlug(slug string) (*models.Tag, error) {
+	return s.tags.GetBySlug(slug)
+}
+
+// Rename changes the name of a tag, and its slug accordingly.
+func (s *TagService) Rename(id, name string) error {
+	tag, err := s.tags.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if tag == nil {
+		return ErrTagNotFound
+	}
+	renamed := normalizeTags([]models.Tag{{Name: name}})
+	if len(renamed) == 0 {
+		return ErrNameRequired
+	}
+	other, err := s.tags.GetBySlug(renamed[0].Slug)
+	if err != nil {
+		return err
+	}
+	if other != nil && other.ID != tag.ID {
+		return ErrTagExists
+	}
+	tag.Name, tag.Slug = renamed[0].Name, renamed[0].Slug
+	return s.tags.Update(tag)
+}
+
+// Delete removes the tag from all events and deletes it.
+func (s *TagService) Delete(id string) error {
+	return s.tags.Delete(id)
+}
+
+// ParseTags splits a comma-separated list of tag names.
+func ParseTags(input string) []models.Tag {
+	var tags []models.Tag
+	for _, name := range strings.Split(input, ",") {
+		tags = append(tags, models.Tag{Name: name})
+	}
+	return normalizeTags(tags)
+}
+
+// normalizeTags trims the names of the tags and gives them a slug, dropping
+// the tags without one and the duplicates. New tags get an ID.
+func normalizeTags(tags []models.Tag) []models.Tag {
+	seen := make(map[string]bool)
+	var out []models.Tag
+	for _, t := range tags {
+		t.Name = strings.Join(strings.Fields(t.Name), " ")
+		if r := []rune(t.Name); len(r) > maxTagLength {
+			t.Name = strings.TrimSpace(string(r[:maxTagLength]))
+		}
+		t.Slug = slug.Generate(t.Name)
+		if t.Slug == "" || seen[t.Slug] {
+			continue
+		}
+		seen[t.Slug] = true
+		if t.ID == "" {
+			t.ID = uuid.New().String()
+		}
+		out = append(out, t)
+	}
+	return out
+}
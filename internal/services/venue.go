@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toulibre/libreregistration/internal/models"
+	"github.com/toulibre/libreregistration/internal/slug"
+)
+
+type VenueService struct {
+	venues VenueStore
+}
+
+func NewVenueService(venues VenueStore) *VenueService {
+	return &VenueService{venues: venues}
+}
+
+// List returns all the venues by name.
+func (s *VenueService) List() ([]models.Venue, error) {
+	return s.venues.ListAll()
+}
+
+func (s *VenueService) GetByID(id string) (*models.Venue, error) {
+	return s.venues.GetByID(id)
+}
+
+func (s *VenueService) GetBySlug(slug string) (*models.Venue, error) {
+	return s.venues.GetBySlug(slug)
+}
+
+func (s *VenueService) Create(v *models.Venue) error {
+	if err := validateVenue(v); err != nil {
+		return err
+	}
+	v.ID = uuid.New().String()
+	if err := s.setSlug(v); err != nil {
+		return err
+	}
+	now := time.Now()
+	v.CreatedAt = now
+	v.UpdatedAt = now
+	return s.venues.Create(v)
+}
+
+// Update saves a venue. Its slug follows its name.
+func (s *VenueService) Update(v *models.Venue) error {
+	if err := validateVenue(v); err != nil {
+		return err
+	}
+	existing, err := s.venues.GetByID(v.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrVenueNotFound
+	}
+	v.Slug = existing.Slug
+	if v.Name != existing.Name {
+		if err := s.setSlug(v); err != nil {
+			return err
+		}
+	}
+	v.CreatedAt = existing.CreatedAt
+	v.UpdatedAt = time.Now()
+	return s.venues.Update(v)
+}
+
+// Delete deletes a venue. Its events keep its name and coordinates.
+func (s *VenueService) Delete(id string) error {
+	return s.venues.Delete(id)
+}
+
+// setSlug gives the venue a unique slug from its name.
+func (s *VenueService) setSlug(v *models.Venue) error {
+	base := slug.Generate(v.Name)
+	if base == "" {
+		base = "venue"
+	}
+	for i := 1; ; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		if candidate == v.Slug {
+			return nil
+		}
+		exists, err := s.venues.SlugExists(candidate)
+		if err != nil {
+			return fmt.Errorf("check slug: %w", err)
+		}
+		if !exists {
+			v.Slug = candidate
+			return nil
+		}
+	}
+}
+
+func validateVenue(v *models.Venue) error {
+	v.Name = strings.Join(strings.Fields(v.Name), " ")
+	v.Address = strings.TrimSpace(v.Address)
+	v.Accessibility = strings.TrimSpace(v.Accessibility)
+	if v.Name == "" {
+		return ErrVenueNameRequired
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ODSContentType is the media type of files written by WriteODS.
+const ODSContentType = "application/vnd.oasis.opendocument.spreadsheet"
+
+// WriteODS writes the workbook as an OpenDocument spreadsheet.
+func WriteODS(w io.Writer, wb *Workbook) error {
+	z := zip.NewWriter(w)
+
+	// The mimetype must come first and be stored uncompressed
+	fw, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, ODSContentType); err != nil {
+		return err
+	}
+
+	fw, err = z.Create("META-INF/manifest.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, odsManifest); err != nil {
+		return err
+	}
+
+	fw, err = z.Create("content.xml")
+	if err != nil {
+		return err
+	}
+	if err := writeODSContent(fw, wb); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func writeODSContent(w io.Writer, wb *Workbook) error {
+	b := bufio.NewWriter(w)
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<office:document-content ` +
+		`xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" ` +
+		`xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0" ` +
+		`xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" ` +
+		`xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" ` +
+		`xmlns:number="urn:oasis:names:tc:opendocument:xmlns:datastyle:1.0" ` +
+		`xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0" ` +
+		`office:version="1.2">`)
+
+	b.WriteString(`<office:automatic-styles>`)
+	b.WriteString(`<number:date-style style:name="N1">` +
+		`<number:year number:style="long"/><number:text>-</number:text>` +
+		`<number:month number:style="long"/><number:text>-</number:text>` +
+		`<number:day number:style="long"/><number:text> </number:text>` +
+		`<number:hours number:style="long"/><number:text>:</number:text>` +
+		`<number:minutes number:style="long"/>` +
+		`</number:date-style>`)
+	b.WriteString(`<style:style style:name="ce1" style:family="table-cell"><style:text-properties fo:font-weight="bold"/></style:style>`)
+	b.WriteString(`<style:style style:name="ce2" style:family="table-cell" style:data-style-name="N1"/>`)
+	for i, sheet := range wb.Sheets {
+		for c, width := range sheet.columnWidths() {
+			// About 0.2 cm per character
+			fmt.Fprintf(b, `<style:style style:name="co%d_%d" style:family="table-column"><style:table-column-properties style:column-width="%.2fcm"/></style:style>`,
+				i+1, c+1, float64(width)*0.2)
+		}
+	}
+	b.WriteString(`</office:automatic-styles>`)
+
+	b.WriteString(`<office:body><office:spreadsheet>`)
+	names := wb.sheetNames()
+	for i, sheet := range wb.Sheets {
+		fmt.Fprintf(b, `<table:table table:name="%s">`, escape(names[i]))
+		for c := range sheet.columnWidths() {
+			fmt.Fprintf(b, `<table:table-column table:style-name="co%d_%d"/>`, i+1, c+1)
+		}
+		if len(sheet.Header) > 0 {
+			b.WriteString(`<table:table-header-rows><table:table-row>`)
+			for _, h := range sheet.Header {
+				writeODSCell(b, h, "ce1")
+			}
+			b.WriteString(`</table:table-row></table:table-header-rows>`)
+		}
+		for _, row := range sheet.Rows {
+			b.WriteString(`<table:table-row>`)
+			for _, v := range row {
+				writeODSCell(b, v, "")
+			}
+			b.WriteString(`</table:table-row>`)
+		}
+		b.WriteString(`</table:table>`)
+	}
+	b.WriteString(`</office:spreadsheet></office:body></office:document-content>`)
+	return b.Flush()
+}
+
+func writeODSCell(b *bufio.Writer, v any, style string) {
+	attr := ""
+	if style != "" {
+		attr = ` table:style-name="` + style + `"`
+	}
+	switch v := v.(type) {
+	case nil:
+		b.WriteString(`<table:table-cell/>`)
+	case string:
+		if v == "" {
+			b.WriteString(`<table:table-cell/>`)
+			return
+		}
+		fmt.Fprintf(b, `<table:table-cell office:value-type="string"%s>`, attr)
+		for _, line := range strings.Split(v, "\n") {
+			fmt.Fprintf(b, `<text:p>%s</text:p>`, escape(line))
+		}
+		b.WriteString(`</table:table-cell>`)
+	case int:
+		fmt.Fprintf(b, `<table:table-cell office:value-type="float" office:value="%d"%s><text:p>%d</text:p></table:table-cell>`, v, attr, v)
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		fmt.Fprintf(b, `<table:table-cell office:value-type="float" office:value="%s"%s><text:p>%s</text:p></table:table-cell>`, s, attr, s)
+	case bool:
+		fmt.Fprintf(b, `<table:table-cell office:value-type="boolean" office:boolean-value="%t"%s><text:p>%t</text:p></table:table-cell>`, v, attr, v)
+	case time.Time:
+		if v.IsZero() {
+			b.WriteString(`<table:table-cell/>`)
+			return
+		}
+		fmt.Fprintf(b, `<table:table-cell office:value-type="date" office:date-value="%s" table:style-name="ce2"><text:p>%s</text:p></table:table-cell>`,
+			v.Format("2006-01-02T15:04:05"), v.Format("2006-01-02 15:04"))
+	default:
+		fmt.Fprintf(b, `<table:table-cell office:value-type="string"%s><text:p>%s</text:p></table:table-cell>`, attr, escape(fmt.Sprint(v)))
+	}
+}
+
+const odsManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="application/vnd.oasis.opendocument.spreadsheet"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`
@@ -0,0 +1,101 @@
+// Package spreadsheet writes simple workbooks in the Office Open XML (XLSX)
+// and OpenDocument (ODS) formats, without any dependency.
+package spreadsheet
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Workbook is a list of sheets.
+type Workbook struct {
+	Sheets []*Sheet
+}
+
+// Sheet is a table with a bold header row. Row values may be strings,
+// integers, floats, booleans, times or nil for an empty cell; times are
+// written as typed date cells.
+type Sheet struct {
+	Name   string
+	Header []string
+	Rows   [][]any
+}
+
+// AddSheet appends a sheet to the workbook and returns it.
+func (wb *Workbook) AddSheet(name string, header ...string) *Sheet {
+	s := &Sheet{Name: name, Header: header}
+	wb.Sheets = append(wb.Sheets, s)
+	return s
+}
+
+// AddRow appends a row of values to the sheet.
+func (s *Sheet) AddRow(values ...any) {
+	s.Rows = append(s.Rows, values)
+}
+
+// sheetNames returns valid and unique sheet names: at most 31 characters,
+// without the characters spreadsheet applications reject.
+func (wb *Workbook) sheetNames() []string {
+	names := make([]string, len(wb.Sheets))
+	used := make(map[string]bool)
+	for i, s := range wb.Sheets {
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return '_'
+			}
+			return r
+		}, strings.TrimSpace(s.Name))
+		if name == "" {
+			name = "Sheet"
+		}
+		name = truncate(name, 31)
+		base := name
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := " (" + strconv.Itoa(n) + ")"
+			name = truncate(base, 31-len(suffix)) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// columnWidths estimates the width of each column in characters.
+func (s *Sheet) columnWidths() []int {
+	var widths []int
+	grow := func(i, w int) {
+		for len(widths) <= i {
+			widths = append(widths, 8)
+		}
+		widths[i] = min(max(widths[i], w+2), 60)
+	}
+	for i, h := range s.Header {
+		grow(i, utf8.RuneCountInString(h))
+	}
+	for _, row := range s.Rows {
+		for i, v := range row {
+			switch v := v.(type) {
+			case string:
+				longest := 0
+				for _, line := range strings.Split(v, "\n") {
+					longest = max(longest, utf8.RuneCountInString(line))
+				}
+				grow(i, longest)
+			case time.Time:
+				grow(i, 16)
+			default:
+				grow(i, 6)
+			}
+		}
+	}
+	return widths
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
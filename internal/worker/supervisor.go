@@ -0,0 +1,69 @@
+// Package worker runs the background jobs of the application, such as the
+// schedulers and the mail sends, so that they can be stopped and waited for
+// on shutdown.
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Supervisor runs jobs in goroutines until it is stopped.
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func NewSupervisor() *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{ctx: ctx, cancel: cancel}
+}
+
+// Go runs a job in a goroutine. Its context is canceled when the supervisor
+// stops: long-running jobs must then return, short ones such as a mail send
+// may just finish. Jobs started once the supervisor is stopped are dropped,
+// and panics are logged rather than crashing the server.
+func (s *Supervisor) Go(name string, job func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		slog.Warn("job dropped after shutdown", "job", name)
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if v := recover(); v != nil {
+				slog.Error("job panicked", "job", name, "panic", v)
+			}
+		}()
+		job(s.ctx)
+	}()
+}
+
+// Stop cancels the context of the jobs and waits for them to return, or for
+// ctx to be done, in which case it returns the error of ctx.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/toulibre/libreregistration/internal/middleware"
 	"github.com/toulibre/libreregistration/internal/models"
 	"github.com/toulibre/libreregistration/internal/services"
+	"github.com/toulibre/libreregistration/internal/worker"
 )
 
 const (
@@ -67,6 +68,10 @@ func run() error {
 	eventStore := database.NewEventStore(db)
 	registrationStore := database.NewRegistrationStore(db)
 	settingStore := database.NewSettingStore(db)
+	tagStore := database.NewTagStore(db)
+	seriesStore := database.NewSeriesStore(db)
+	eventSessionStore := database.NewSessionStore(db)
+	venueStore := database.NewVenueStore(db)
 
 	cfg := &config.Config{
 		Port:          port,
@@ -77,9 +82,13 @@ func run() error {
 	}
 
 	authService := services.NewAuthService(userStore)
-	eventService := services.NewEventService(eventStore)
-	registrationService := services.NewRegistrationService(registrationStore, eventStore, cfg)
+	eventService := services.NewEventService(eventStore, tagStore, eventSessionStore, venueStore)
+	tagService := services.NewTagService(tagStore)
+	registrationService := services.NewRegistrationService(registrationStore, eventStore, eventSessionStore, cfg, worker.NewSupervisor())
 	settingsService := services.NewSettingsService(settingStore)
+	seriesService := services.NewSeriesService(seriesStore, eventService)
+	venueService := services.NewVenueService(venueStore)
+	analyticsService := services.NewAnalyticsService(eventStore, registrationStore)
 
 	// Seed test data
 	if err := seedData(authService, eventService, registrationService); err != nil {
@@ -87,7 +96,7 @@ func run() error {
 	}
 
 	// Start HTTP server
-	srv := startServer(cfg, authService, eventService, registrationService, settingsService, uploadDir)
+	srv := startServer(cfg, authService, eventService, registrationService, tagService, seriesService, venueService, analyticsService, settingsService, uploadDir)
 	defer srv.Close()
 
 	waitForServer()
@@ -122,6 +131,7 @@ func seedData(auth *services.AuthService, events *services.EventService, regs *s
 	lng1 := 1.4468
 	event1 := &models.Event{
 		Title: "Rencontres du Logiciel Libre 2026",
+		Tags:  []models.Tag{{Name: "Conférence"}, {Name: "Rencontre"}},
 		Description: `Venez découvrir le monde du logiciel libre lors de notre rencontre annuelle !
 
 ## Programme
@@ -149,6 +159,7 @@ func seedData(auth *services.AuthService, events *services.EventService, regs *s
 	capacity2 := 20
 	event2 := &models.Event{
 		Title: "Atelier Git & GitHub pour débutants",
+		Tags:  []models.Tag{{Name: "Atelier"}},
 		Description: `Initiez-vous à Git et GitHub lors de cet atelier pratique.
 
 ## Ce que vous apprendrez
@@ -171,6 +182,7 @@ func seedData(auth *services.AuthService, events *services.EventService, regs *s
 	// Event 3: conference, no capacity limit
 	event3 := &models.Event{
 		Title: "Conférence LibreOffice : trucs et astuces",
+		Tags:  []models.Tag{{Name: "Conférence"}},
 		Description: `Découvrez les fonctionnalités méconnues de LibreOffice avec notre intervenant spécialisé.
 
 ## Au programme
@@ -220,7 +232,7 @@ func seedData(auth *services.AuthService, events *services.EventService, regs *s
 	}
 
 	for _, a := range attendees {
-		if _, err := regs.Register(ctx, a.eventID, a.name, a.email, a.comment); err != nil {
+		if _, err := regs.Register(ctx, a.eventID, a.name, a.email, a.comment, nil, nil); err != nil {
 			return fmt.Errorf("register %q: %w", a.name, err)
 		}
 	}
@@ -229,7 +241,7 @@ func seedData(auth *services.AuthService, events *services.EventService, regs *s
 	return nil
 }
 
-func startServer(cfg *config.Config, auth *services.AuthService, events *services.EventService, regs *services.RegistrationService, settings *services.SettingsService, uploadDir string) *http.Server {
+func startServer(cfg *config.Config, auth *services.AuthService, events *services.EventService, regs *services.RegistrationService, tags *services.TagService, series *services.SeriesService, venues *services.VenueService, analytics *services.AnalyticsService, settings *services.SettingsService, uploadDir string) *http.Server {
 	sessionStore := sessions.NewCookieStore([]byte(cfg.SessionSecret))
 	sessionStore.Options = &sessions.Options{
 		Path:     "/",
@@ -238,9 +250,9 @@ func startServer(cfg *config.Config, auth *services.AuthService, events *service
 	}
 
 	authHandler := handlers.NewAuthHandler(auth, settings)
-	eventHandler := handlers.NewEventHandler(events, regs, settings, uploadDir)
+	eventHandler := handlers.NewEventHandler(events, regs, tags, series, venues, auth, settings, uploadDir)
 	registrationHandler := handlers.NewRegistrationHandler(regs, events, settings)
-	adminHandler := handlers.NewAdminHandler(events, regs, auth, settings)
+	adminHandler := handlers.NewAdminHandler(events, regs, analytics, auth, settings, uploadDir)
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logging)
@@ -254,6 +266,8 @@ func startServer(cfg *config.Config, auth *services.AuthService, events *service
 
 	r.Get("/", eventHandler.Home)
 	r.Get("/event/{slug}", eventHandler.Show)
+	r.Get("/tag/{slug}", eventHandler.Tag)
+	r.Get("/search", eventHandler.Search)
 	r.Post("/event/{slug}/register", registrationHandler.Register)
 	r.Get("/cancel/{token}", registrationHandler.Cancel)
 
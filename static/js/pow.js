@@ -0,0 +1,58 @@
+// Solves the proof-of-work anti-spam challenge of the forms of the page:
+// find a nonce such that SHA-256(token + ":" + nonce) starts with the
+// requested number of zero bits. See internal/captcha/pow.go. The forms share
+// the challenge of the session, which is solved once.
+(function () {
+  const forms = document.querySelectorAll("form[data-pow-challenge]");
+  if (forms.length === 0) {
+    return;
+  }
+
+  const token = forms[0].getAttribute("data-pow-challenge");
+  const difficulty = parseInt(forms[0].getAttribute("data-pow-difficulty"), 10);
+  const encoder = new window.TextEncoder();
+
+  function leadingZeroBits(bytes) {
+    let n = 0;
+    for (const b of bytes) {
+      if (b === 0) {
+        n += 8;
+        continue;
+      }
+      return n + Math.clz32(b) - 24;
+    }
+    return n;
+  }
+
+  async function solve() {
+    for (let nonce = 0; ; nonce++) {
+      const digest = await window.crypto.subtle.digest("SHA-256", encoder.encode(token + ":" + nonce));
+      if (leadingZeroBits(new Uint8Array(digest)) >= difficulty) {
+        return String(nonce);
+      }
+    }
+  }
+
+  for (const form of forms) {
+    const submit = form.querySelector("button[type=submit]");
+    if (submit) {
+      submit.disabled = true;
+    }
+  }
+  solve().then(function (nonce) {
+    for (const form of forms) {
+      const input = form.querySelector("input[name=pow_nonce]");
+      const status = form.querySelector("[data-pow-status]");
+      const submit = form.querySelector("button[type=submit]");
+      if (input) {
+        input.value = nonce;
+      }
+      if (status) {
+        status.textContent = status.getAttribute("data-done");
+      }
+      if (submit) {
+        submit.disabled = false;
+      }
+    }
+  });
+})();
@@ -0,0 +1,32 @@
+// Autocompletes the last name of a comma-separated tag list: the options of
+// the datalist are prefixed with the tags already typed, so that picking one
+// keeps them.
+(function () {
+  const input = document.querySelector("input[data-tag-input]");
+  if (!input || !input.list) {
+    return;
+  }
+
+  const list = input.list;
+  const names = Array.from(list.options, (o) => o.value);
+
+  function update() {
+    const parts = input.value.split(",");
+    parts.pop();
+    const typed = parts.map((p) => p.trim().toLowerCase()).filter((p) => p !== "");
+    const prefix = parts.length ? parts.join(",").trim() + ", " : "";
+
+    list.replaceChildren(
+      ...names
+        .filter((name) => !typed.includes(name.toLowerCase()))
+        .map((name) => {
+          const option = document.createElement("option");
+          option.value = prefix + name;
+          return option;
+        })
+    );
+  }
+
+  input.addEventListener("input", update);
+  update();
+})();